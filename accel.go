@@ -0,0 +1,885 @@
+package atos
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	appleHashMagic = 0x48415348 // "HASH"
+	appleHashDJB   = 0
+
+	dwAtomDIEOffset = 1 // DW_ATOM_die_offset
+	dwAtomCUOffset  = 2 // DW_ATOM_cu_offset
+	dwAtomDIETag    = 3 // DW_ATOM_die_tag
+
+	dwIdxCompileUnit = 1 // DW_IDX_compile_unit
+	dwIdxDIEOffset   = 3 // DW_IDX_die_offset
+)
+
+// DWARF forms used by the accelerator tables
+const (
+	dwFormData2        = 0x05
+	dwFormData4        = 0x06
+	dwFormData8        = 0x07
+	dwFormData1        = 0x0b
+	dwFormFlag         = 0x0c
+	dwFormSdata        = 0x0d
+	dwFormUdata        = 0x0f
+	dwFormRef1         = 0x11
+	dwFormRef2         = 0x12
+	dwFormRef4         = 0x13
+	dwFormRef8         = 0x14
+	dwFormRefUdata     = 0x15
+	dwFormFlagPresent  = 0x19
+	dwFormData16       = 0x1e
+	dwFormRefSig8      = 0x20
+	dwFormImplicitCons = 0x21
+)
+
+// djbHash is the hash function of both the Apple accelerator tables and .debug_names
+func djbHash(s string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(s); i++ {
+		h = h*33 + uint32(s[i])
+	}
+	return h
+}
+
+// caseFoldingDJBHash is the .debug_names hash, which folds the ASCII letters to lower case
+func caseFoldingDJBHash(s string) uint32 {
+	h := uint32(5381)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		h = h*33 + uint32(c)
+	}
+	return h
+}
+
+// readForm reads an attribute value of the fixed set of forms the accelerator tables use
+func readForm(br *bytesReader, form uint64, order binary.ByteOrder) (uint64, error) {
+	switch form {
+	case dwFormData1, dwFormRef1, dwFormFlag:
+		b, err := br.ReadByte()
+		return uint64(b), err
+	case dwFormData2, dwFormRef2:
+		v, err := br.Uint16(order)
+		return uint64(v), err
+	case dwFormData4, dwFormRef4:
+		v, err := br.Uint32(order)
+		return uint64(v), err
+	case dwFormData8, dwFormRef8, dwFormRefSig8:
+		return br.Uint64(order)
+	case dwFormUdata, dwFormRefUdata:
+		return br.ReadULEB128()
+	case dwFormSdata:
+		v, err := br.ReadSLEB128()
+		return uint64(v), err
+	case dwFormData16:
+		_, err := br.Skip(16)
+		return 0, err
+	case dwFormFlagPresent, dwFormImplicitCons:
+		return 1, nil
+	}
+	return 0, fmt.Errorf("unsupported form 0x%x in accelerator table", form)
+}
+
+func cString(str []byte, offset uint64) (string, error) {
+	if offset >= uint64(len(str)) {
+		return "", fmt.Errorf("string offset 0x%x out of range", offset)
+	}
+	end := bytes.IndexByte(str[offset:], 0)
+	if end < 0 {
+		return "", io.ErrUnexpectedEOF
+	}
+	return string(str[offset : offset+uint64(end)]), nil
+}
+
+type appleAtom struct {
+	typ  uint16
+	form uint16
+}
+
+// AppleAccelTable is an Apple accelerator table, i.e. __apple_names, __apple_types or __apple_objc,
+// which maps names to the .debug_info offsets of their DIEs
+type AppleAccelTable struct {
+	data          []byte
+	str           []byte // __debug_str
+	order         binary.ByteOrder
+	bucketCount   uint32
+	hashesCount   uint32
+	dieOffsetBase uint32
+	atoms         []appleAtom
+	bucketsOff    int
+}
+
+// ParseAppleAccelTable parses an Apple accelerator table, str is the content of __debug_str
+func ParseAppleAccelTable(data, str []byte, order binary.ByteOrder) (*AppleAccelTable, error) {
+	br := newBytesReader(data)
+	magic, err := br.Uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	if magic != appleHashMagic {
+		return nil, fmt.Errorf("invalid Apple accelerator table magic: 0x%x", magic)
+	}
+	version, _ := br.Uint16(order)
+	hashFunc, _ := br.Uint16(order)
+	if version != 1 || hashFunc != appleHashDJB {
+		return nil, fmt.Errorf("unsupported Apple accelerator table version %d or hash function %d", version, hashFunc)
+	}
+	t := &AppleAccelTable{data: data, str: str, order: order}
+	t.bucketCount, _ = br.Uint32(order)
+	t.hashesCount, _ = br.Uint32(order)
+	headerDataLen, err := br.Uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	headerDataStart := br.Offset()
+	t.dieOffsetBase, _ = br.Uint32(order)
+	atomCount, err := br.Uint32(order)
+	if err != nil {
+		return nil, err
+	}
+	for i := uint32(0); i < atomCount; i++ {
+		typ, _ := br.Uint16(order)
+		form, err := br.Uint16(order)
+		if err != nil {
+			return nil, err
+		}
+		t.atoms = append(t.atoms, appleAtom{typ: typ, form: form})
+	}
+	t.bucketsOff = headerDataStart + int(headerDataLen)
+	if uint64(t.bucketsOff)+4*uint64(t.bucketCount)+8*uint64(t.hashesCount) > uint64(len(data)) {
+		return nil, errors.New("the Apple accelerator table is truncated")
+	}
+	return t, nil
+}
+
+func (t *AppleAccelTable) u32(off int) uint32 {
+	return t.order.Uint32(t.data[off : off+4])
+}
+
+// AppleAccelEntry is an entry of an Apple accelerator table, Tag is only set if the table has DW_ATOM_die_tag
+type AppleAccelEntry struct {
+	Offset dwarf.Offset
+	Tag    dwarf.Tag
+}
+
+// Lookup returns the DIEs of the name
+func (t *AppleAccelTable) Lookup(name string) ([]AppleAccelEntry, error) {
+	if t.bucketCount == 0 {
+		return nil, nil
+	}
+	hash := djbHash(name)
+	hashesOff := t.bucketsOff + 4*int(t.bucketCount)
+	offsetsOff := hashesOff + 4*int(t.hashesCount)
+
+	idx := t.u32(t.bucketsOff + 4*int(hash%t.bucketCount))
+	if idx == 0xffffffff {
+		return nil, nil
+	}
+	var entries []AppleAccelEntry
+	for ; idx < t.hashesCount; idx++ {
+		h := t.u32(hashesOff + 4*int(idx))
+		if h%t.bucketCount != hash%t.bucketCount {
+			break // went into the next bucket
+		}
+		if h != hash {
+			continue
+		}
+		found, err := t.readHashData(int(t.u32(offsetsOff+4*int(idx))), func(s string) bool { return s == name })
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// Entries returns the DIEs of all the names
+func (t *AppleAccelTable) Entries() ([]AppleAccelEntry, error) {
+	offsetsOff := t.bucketsOff + 4*int(t.bucketCount) + 4*int(t.hashesCount)
+	var entries []AppleAccelEntry
+	for idx := 0; idx < int(t.hashesCount); idx++ {
+		found, err := t.readHashData(int(t.u32(offsetsOff+4*idx)), func(string) bool { return true })
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// readHashData reads the chain of names sharing a hash value, and returns the entries of the names matching
+func (t *AppleAccelTable) readHashData(off int, match func(string) bool) ([]AppleAccelEntry, error) {
+	br := newBytesReader(t.data)
+	if _, err := br.Seek(int64(off), io.SeekStart); err != nil {
+		return nil, err
+	}
+	var entries []AppleAccelEntry
+	for {
+		strOff, err := br.Uint32(t.order)
+		if err != nil {
+			return entries, err
+		}
+		if strOff == 0 {
+			return entries, nil
+		}
+		s, err := cString(t.str, uint64(strOff))
+		if err != nil {
+			return entries, err
+		}
+		count, err := br.Uint32(t.order)
+		if err != nil {
+			return entries, err
+		}
+		for i := uint32(0); i < count; i++ {
+			var entry AppleAccelEntry
+			for _, atom := range t.atoms {
+				v, err := readForm(br, uint64(atom.form), t.order)
+				if err != nil {
+					return entries, err
+				}
+				switch atom.typ {
+				case dwAtomDIEOffset:
+					entry.Offset = dwarf.Offset(v + uint64(t.dieOffsetBase))
+				case dwAtomDIETag:
+					entry.Tag = dwarf.Tag(v)
+				}
+			}
+			if match(s) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+}
+
+type debugNamesAbbrev struct {
+	tag   dwarf.Tag
+	attrs [][2]uint64 // index and form pairs
+}
+
+// debugNamesUnit is a name index of a DWARF 5 .debug_names section
+type debugNamesUnit struct {
+	is64        bool
+	cuOffsets   []uint64
+	bucketCount uint32
+	nameCount   uint32
+	buckets     int // the offsets of the arrays in the section
+	hashes      int
+	strOffsets  int
+	entryOffs   int
+	entryPool   int
+	abbrevs     map[uint64]*debugNamesAbbrev
+}
+
+// DebugNames is a DWARF 5 .debug_names section which maps names to DIEs
+type DebugNames struct {
+	data  []byte
+	str   []byte // .debug_str
+	order binary.ByteOrder
+	units []*debugNamesUnit
+}
+
+// ParseDebugNames parses a .debug_names section, str is the content of .debug_str
+func ParseDebugNames(data, str []byte, order binary.ByteOrder) (*DebugNames, error) {
+	dn := &DebugNames{data: data, str: str, order: order}
+	br := newBytesReader(data)
+	for br.Len() > 0 {
+		u := &debugNamesUnit{abbrevs: make(map[uint64]*debugNamesAbbrev)}
+		length, err := br.Uint32(order)
+		if err != nil {
+			return dn, err
+		}
+		unitLength := uint64(length)
+		if length == 0xffffffff {
+			u.is64 = true
+			if unitLength, err = br.Uint64(order); err != nil {
+				return dn, err
+			}
+		}
+		unitEnd := uint64(br.Offset()) + unitLength
+		if unitEnd > uint64(len(data)) {
+			return dn, errors.New("the .debug_names unit is truncated")
+		}
+
+		version, _ := br.Uint16(order)
+		if version != 5 {
+			return dn, fmt.Errorf("unsupported .debug_names version %d", version)
+		}
+		_, _ = br.Uint16(order) // padding
+		cuCount, _ := br.Uint32(order)
+		localTUCount, _ := br.Uint32(order)
+		foreignTUCount, _ := br.Uint32(order)
+		u.bucketCount, _ = br.Uint32(order)
+		u.nameCount, _ = br.Uint32(order)
+		abbrevSize, _ := br.Uint32(order)
+		augSize, err := br.Uint32(order)
+		if err != nil {
+			return dn, err
+		}
+		if _, err = br.Skip(int(augSize)); err != nil {
+			return dn, err
+		}
+
+		offSize := 4
+		if u.is64 {
+			offSize = 8
+		}
+		for i := uint32(0); i < cuCount; i++ {
+			off, err := readOffset(br, order, u.is64)
+			if err != nil {
+				return dn, err
+			}
+			u.cuOffsets = append(u.cuOffsets, off)
+		}
+		// the type units are not used for looking up functions
+		u.buckets = br.Offset() + offSize*int(localTUCount) + 8*int(foreignTUCount)
+		u.hashes = u.buckets + 4*int(u.bucketCount)
+		u.strOffsets = u.hashes
+		if u.bucketCount > 0 {
+			u.strOffsets += 4 * int(u.nameCount)
+		}
+		u.entryOffs = u.strOffsets + offSize*int(u.nameCount)
+		abbrevStart := u.entryOffs + offSize*int(u.nameCount)
+		u.entryPool = abbrevStart + int(abbrevSize)
+		if uint64(u.entryPool) > unitEnd {
+			return dn, errors.New("the .debug_names unit is truncated")
+		}
+
+		abr := newBytesReader(data[:u.entryPool])
+		if _, err = abr.Seek(int64(abbrevStart), io.SeekStart); err != nil {
+			return dn, err
+		}
+		for {
+			code, err := abr.ReadULEB128()
+			if err != nil {
+				return dn, fmt.Errorf("unable to read .debug_names abbreviations: %w", err)
+			}
+			if code == 0 {
+				break
+			}
+			tag, err := abr.ReadULEB128()
+			if err != nil {
+				return dn, err
+			}
+			abbrev := &debugNamesAbbrev{tag: dwarf.Tag(tag)}
+			for {
+				idx, err := abr.ReadULEB128()
+				if err != nil {
+					return dn, err
+				}
+				form, err := abr.ReadULEB128()
+				if err != nil {
+					return dn, err
+				}
+				if idx == 0 && form == 0 {
+					break
+				}
+				abbrev.attrs = append(abbrev.attrs, [2]uint64{idx, form})
+			}
+			u.abbrevs[code] = abbrev
+		}
+
+		dn.units = append(dn.units, u)
+		if _, err = br.Seek(int64(unitEnd), io.SeekStart); err != nil {
+			return dn, err
+		}
+	}
+	return dn, nil
+}
+
+func readOffset(br *bytesReader, order binary.ByteOrder, is64 bool) (uint64, error) {
+	if is64 {
+		return br.Uint64(order)
+	}
+	v, err := br.Uint32(order)
+	return uint64(v), err
+}
+
+// DebugNamesEntry is an entry of .debug_names
+type DebugNamesEntry struct {
+	Offset dwarf.Offset
+	Tag    dwarf.Tag
+}
+
+// Lookup returns the DIEs of the name from all the name indexes
+func (dn *DebugNames) Lookup(name string) ([]DebugNamesEntry, error) {
+	var entries []DebugNamesEntry
+	for _, u := range dn.units {
+		found, err := dn.lookupUnit(u, name)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+func (dn *DebugNames) lookupUnit(u *debugNamesUnit, name string) ([]DebugNamesEntry, error) {
+	br := newBytesReader(dn.data)
+	at := func(off int) *bytesReader {
+		_, _ = br.Seek(int64(off), io.SeekStart)
+		return br
+	}
+	offSize := 4
+	if u.is64 {
+		offSize = 8
+	}
+
+	// without a hash table, the names have to be compared one by one
+	first, last := uint32(1), u.nameCount
+	hash := caseFoldingDJBHash(name)
+	if u.bucketCount > 0 {
+		idx, err := at(u.buckets + 4*int(hash%u.bucketCount)).Uint32(dn.order)
+		if err != nil {
+			return nil, err
+		}
+		if idx == 0 {
+			return nil, nil
+		}
+		first = idx
+	}
+
+	var entries []DebugNamesEntry
+	for i := first; i <= last; i++ {
+		if u.bucketCount > 0 {
+			h, err := at(u.hashes + 4*int(i-1)).Uint32(dn.order)
+			if err != nil {
+				return entries, err
+			}
+			if h%u.bucketCount != hash%u.bucketCount {
+				break
+			}
+			if h != hash {
+				continue
+			}
+		}
+		strOff, err := readOffset(at(u.strOffsets+offSize*int(i-1)), dn.order, u.is64)
+		if err != nil {
+			return entries, err
+		}
+		if s, err := cString(dn.str, strOff); err != nil || s != name {
+			continue
+		}
+		entryOff, err := readOffset(at(u.entryOffs+offSize*int(i-1)), dn.order, u.is64)
+		if err != nil {
+			return entries, err
+		}
+		found, err := dn.readEntries(u, u.entryPool+int(entryOff))
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, found...)
+	}
+	return entries, nil
+}
+
+// Entries returns the DIEs of all the names from all the name indexes
+func (dn *DebugNames) Entries() ([]DebugNamesEntry, error) {
+	br := newBytesReader(dn.data)
+	var entries []DebugNamesEntry
+	for _, u := range dn.units {
+		offSize := 4
+		if u.is64 {
+			offSize = 8
+		}
+		for i := 0; i < int(u.nameCount); i++ {
+			if _, err := br.Seek(int64(u.entryOffs+offSize*i), io.SeekStart); err != nil {
+				return entries, err
+			}
+			entryOff, err := readOffset(br, dn.order, u.is64)
+			if err != nil {
+				return entries, err
+			}
+			found, err := dn.readEntries(u, u.entryPool+int(entryOff))
+			if err != nil {
+				return entries, err
+			}
+			entries = append(entries, found...)
+		}
+	}
+	return entries, nil
+}
+
+// readEntries reads the entry list of a name, which is terminated by a zero abbreviation code
+func (dn *DebugNames) readEntries(u *debugNamesUnit, off int) ([]DebugNamesEntry, error) {
+	br := newBytesReader(dn.data)
+	if _, err := br.Seek(int64(off), io.SeekStart); err != nil {
+		return nil, err
+	}
+	var entries []DebugNamesEntry
+	for {
+		code, err := br.ReadULEB128()
+		if err != nil {
+			return entries, err
+		}
+		if code == 0 {
+			return entries, nil
+		}
+		abbrev, ok := u.abbrevs[code]
+		if !ok {
+			return entries, fmt.Errorf("unknown .debug_names abbreviation code %d", code)
+		}
+		var cuIndex, dieOffset uint64
+		hasDIE := false
+		for _, attr := range abbrev.attrs {
+			v, err := readForm(br, attr[1], dn.order)
+			if err != nil {
+				return entries, err
+			}
+			switch attr[0] {
+			case dwIdxCompileUnit:
+				cuIndex = v
+			case dwIdxDIEOffset:
+				dieOffset, hasDIE = v, true
+			}
+		}
+		// DW_IDX_compile_unit can be omitted if there is only one CU
+		if !hasDIE || cuIndex >= uint64(len(u.cuOffsets)) {
+			continue
+		}
+		entries = append(entries, DebugNamesEntry{
+			Offset: dwarf.Offset(u.cuOffsets[cuIndex] + dieOffset),
+			Tag:    abbrev.tag,
+		})
+	}
+}
+
+// loadAccelTables parses the accelerator tables, a broken table is ignored and the lookups fall back to scanning the DIEs
+func (d *dwarfImage) loadAccelTables(secs *dwarfSections) {
+	str := secs.data["debug_str"]
+	apple := func(name string) *AppleAccelTable {
+		b, ok := secs.data[name]
+		if !ok {
+			return nil
+		}
+		t, err := ParseAppleAccelTable(b, str, secs.order)
+		if err != nil {
+			Log.Debugf("unable to parse %s: %v", name, err)
+			return nil
+		}
+		return t
+	}
+	d.appleNames = apple("apple_names")
+	d.appleTypes = apple("apple_types")
+	d.appleObjC = apple("apple_objc")
+	if b, ok := secs.data["debug_names"]; ok {
+		dn, err := ParseDebugNames(b, str, secs.order)
+		if err != nil {
+			Log.Debugf("unable to parse debug_names: %v", err)
+		}
+		if dn != nil && len(dn.units) > 0 {
+			d.debugNames = dn
+		}
+	}
+}
+
+// HasAccelTables reports if the name lookups are served by __apple_names or .debug_names instead of scanning all the DIEs
+func (d *dwarfImage) HasAccelTables() bool {
+	return d.appleNames != nil || d.debugNames != nil
+}
+
+// funcRange is a PC range of a subprogram indexed by the accelerator tables
+type funcRange struct {
+	lowPC  uint64
+	highPC uint64
+	offset dwarf.Offset // the offset of the subprogram entry
+	cu     dwarf.Offset // the offset of the CU entry
+}
+
+// accelFunctions returns the DIE offsets of all the functions of __apple_names or .debug_names
+func (d *dwarfImage) accelFunctions() ([]dwarf.Offset, error) {
+	var offsets []dwarf.Offset
+	if d.appleNames != nil {
+		entries, err := d.appleNames.Entries()
+		for _, e := range entries {
+			// the tag is 0 if the table has no DW_ATOM_die_tag, the DIE is checked by buildFuncIndex
+			if e.Tag == 0 || e.Tag == dwarf.TagSubprogram {
+				offsets = append(offsets, e.Offset)
+			}
+		}
+		return offsets, err
+	}
+	if d.debugNames != nil {
+		entries, err := d.debugNames.Entries()
+		for _, e := range entries {
+			if e.Tag == dwarf.TagSubprogram {
+				offsets = append(offsets, e.Offset)
+			}
+		}
+		return offsets, err
+	}
+	return nil, nil
+}
+
+// buildFuncIndex maps the PC ranges of the functions of the accelerator tables to their subprogram and CU entries,
+// which resolves a PC to its subprogram without iterating the DIEs of the CU
+func (d *dwarfImage) buildFuncIndex() {
+	d.funcIndexBuilt = true
+	offsets, err := d.accelFunctions()
+	if err != nil {
+		Log.Debugf("unable to read the functions of the accelerator tables: %v", err)
+	}
+	if len(offsets) == 0 {
+		return
+	}
+	sort.Slice(offsets, func(i, j int) bool {
+		return offsets[i] < offsets[j]
+	})
+
+	// the CU of a DIE is the last CU starting before it
+	var units []dwarf.Offset
+	r := d.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			Log.Debugf("unable to iterate CUs: %v", err)
+			break
+		}
+		if entry == nil {
+			break
+		}
+		units = append(units, entry.Offset)
+		r.SkipChildren()
+	}
+
+	for i, off := range offsets {
+		if i > 0 && off == offsets[i-1] {
+			continue // the short name and the linkage name of a function
+		}
+		unit := sort.Search(len(units), func(i int) bool {
+			return units[i] > off
+		}) - 1
+		if unit < 0 {
+			continue
+		}
+		r.Seek(off)
+		entry, err := r.Next()
+		if err != nil || entry == nil || entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		ranges, err := d.dwarf.Ranges(entry)
+		if err != nil {
+			Log.Debugf("unable to parse the ranges of the subprogram at 0x%x: %v", off, err)
+			continue
+		}
+		for _, rg := range ranges {
+			if rg[1] > rg[0] {
+				d.funcIndex = append(d.funcIndex, funcRange{lowPC: rg[0], highPC: rg[1], offset: off, cu: units[unit]})
+			}
+		}
+	}
+	sort.Slice(d.funcIndex, func(i, j int) bool {
+		return d.funcIndex[i].lowPC < d.funcIndex[j].lowPC
+	})
+}
+
+// locateByFuncIndex looks up the function containing addr in the index of the accelerator tables,
+// ok is false if there are no accelerator tables or the function isn't indexed
+func (d *dwarfImage) locateByFuncIndex(addr uint64) (fr funcRange, ok bool) {
+	if !d.HasAccelTables() {
+		return fr, false
+	}
+	if !d.funcIndexBuilt {
+		d.buildFuncIndex()
+	}
+	idx := sort.Search(len(d.funcIndex), func(i int) bool {
+		return d.funcIndex[i].lowPC > addr
+	}) - 1
+	if idx < 0 || addr >= d.funcIndex[idx].highPC {
+		return fr, false
+	}
+	return d.funcIndex[idx], true
+}
+
+func isFunctionTag(tag dwarf.Tag) bool {
+	return tag == dwarf.TagSubprogram || tag == dwarf.TagInlinedSubroutine
+}
+
+func isTypeTag(tag dwarf.Tag) bool {
+	switch tag {
+	case dwarf.TagBaseType, dwarf.TagStructType, dwarf.TagClassType, dwarf.TagUnionType,
+		dwarf.TagEnumerationType, dwarf.TagTypedef, dwarf.TagInterfaceType:
+		return true
+	}
+	return false
+}
+
+// accelOffsets returns the DIE offsets of the name from an Apple table or .debug_names,
+// ok is false if neither of them is available
+func (d *dwarfImage) accelOffsets(table *AppleAccelTable, name string, match func(dwarf.Tag) bool) (offsets []dwarf.Offset, ok bool, err error) {
+	if table != nil {
+		entries, err := table.Lookup(name)
+		for _, e := range entries {
+			offsets = append(offsets, e.Offset)
+		}
+		return offsets, true, err
+	}
+	if d.debugNames != nil {
+		entries, err := d.debugNames.Lookup(name)
+		for _, e := range entries {
+			if match(e.Tag) {
+				offsets = append(offsets, e.Offset)
+			}
+		}
+		return offsets, true, err
+	}
+	return nil, false, nil
+}
+
+// lookupEntries returns the DIEs of the name which match the tag filter, from the accelerator table
+// if present, or by iterating all the DIEs
+func (d *dwarfImage) lookupEntries(table *AppleAccelTable, name string, match func(dwarf.Tag) bool) ([]*dwarf.Entry, error) {
+	if d.dwarf == nil {
+		return nil, errNoDWARF
+	}
+	offsets, ok, err := d.accelOffsets(table, name, match)
+	if err != nil {
+		Log.Debugf("unable to look up [%s] in the accelerator table: %v", name, err)
+	}
+	if !ok || err != nil {
+		return d.scanEntries(func(entry *dwarf.Entry) bool {
+			return match(entry.Tag) && entryName(d.dwarf, entry) == name
+		})
+	}
+
+	r := d.dwarf.Reader()
+	entries := make([]*dwarf.Entry, 0, len(offsets))
+	for _, off := range offsets {
+		r.Seek(off)
+		entry, err := r.Next()
+		if err != nil {
+			return entries, fmt.Errorf("unable to read the DIE at 0x%x: %w", off, err)
+		}
+		if entry != nil && match(entry.Tag) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (d *dwarfImage) scanEntries(match func(*dwarf.Entry) bool) ([]*dwarf.Entry, error) {
+	if d.dwarf == nil {
+		return nil, errNoDWARF
+	}
+	var entries []*dwarf.Entry
+	r := d.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return entries, err
+		}
+		if entry == nil {
+			return entries, nil
+		}
+		if entry.Tag != 0 && match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+}
+
+// subPrograms converts the DIEs to their runtime address ranges, the declarations
+// and the functions stripped by the linker have no ranges and are skipped
+func (d *dwarfImage) subPrograms(entries []*dwarf.Entry) ([]*SubProgram, error) {
+	var subs []*SubProgram
+	for _, entry := range entries {
+		ranges, err := d.dwarf.Ranges(entry)
+		if err != nil {
+			return subs, fmt.Errorf("unable to parse the ranges of DIE at 0x%x: %w", entry.Offset, err)
+		}
+		sub := &SubProgram{Name: entryName(d.dwarf, entry), Inlined: entry.Tag == dwarf.TagInlinedSubroutine}
+		for _, rg := range ranges {
+			if rg[1] > rg[0] && rg[0] != 0 {
+				sub.PCRanges = append(sub.PCRanges, [2]uint64{rg[0] + d.loadSlide, rg[1] + d.loadSlide})
+			}
+		}
+		if len(sub.PCRanges) > 0 {
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// LookupFunction returns the runtime address ranges of the functions of the name, either the
+// short name or the linkage name, e.g. "main" or "_ZN3foo3barEv", including the inlined copies
+func (d *dwarfImage) LookupFunction(name string) ([]*SubProgram, error) {
+	entries, err := d.lookupEntries(d.appleNames, name, isFunctionTag)
+	if err != nil {
+		return nil, err
+	}
+	return d.subPrograms(entries)
+}
+
+// LookupType returns the types of the name, e.g. "int" or "MyStruct"
+func (d *dwarfImage) LookupType(name string) ([]dwarf.Type, error) {
+	entries, err := d.lookupEntries(d.appleTypes, name, isTypeTag)
+	if err != nil {
+		return nil, err
+	}
+	types := make([]dwarf.Type, 0, len(entries))
+	for _, entry := range entries {
+		t, err := d.dwarf.Type(entry.Offset)
+		if err != nil {
+			return types, fmt.Errorf("unable to read the type at 0x%x: %w", entry.Offset, err)
+		}
+		types = append(types, t)
+	}
+	return types, nil
+}
+
+// LookupTypeDefinitions returns the DIE offsets of the types of the name, skipping the declarations, e.g. of the
+// structs only declared in a CU, to be dumped by the DWARFData with dwarftype.Printer
+func (d *dwarfImage) LookupTypeDefinitions(name string) ([]dwarf.Offset, error) {
+	entries, err := d.lookupEntries(d.appleTypes, name, isTypeTag)
+	if err != nil {
+		return nil, err
+	}
+	var offsets []dwarf.Offset
+	for _, entry := range entries {
+		if decl, _ := entry.Val(dwarf.AttrDeclaration).(bool); !decl {
+			offsets = append(offsets, entry.Offset)
+		}
+	}
+	return offsets, nil
+}
+
+// DWARFData returns the DWARF debug info, nil if it's not loaded
+func (d *dwarfImage) DWARFData() *dwarf.Data {
+	return d.dwarf
+}
+
+// LookupObjCMethods returns the runtime address ranges of the methods of an Objective-C class,
+// e.g. "-[Crasher throwUncaughtNSException]" for the class "Crasher"
+func (d *dwarfImage) LookupObjCMethods(class string) ([]*SubProgram, error) {
+	var (
+		entries []*dwarf.Entry
+		err     error
+	)
+	if d.appleObjC != nil {
+		entries, err = d.lookupEntries(d.appleObjC, class, isFunctionTag)
+	} else {
+		entries, err = d.scanEntries(func(entry *dwarf.Entry) bool {
+			if entry.Tag != dwarf.TagSubprogram {
+				return false
+			}
+			name := entryName(d.dwarf, entry)
+			return strings.HasPrefix(name, "-["+class+" ") || strings.HasPrefix(name, "+["+class+" ") ||
+				strings.HasPrefix(name, "-["+class+"(") || strings.HasPrefix(name, "+["+class+"(")
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.subPrograms(entries)
+}
@@ -0,0 +1,171 @@
+package atos
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestAppleAccelTables(t *testing.T) {
+	mf, err := OpenMachO("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+
+	if mf.appleNames == nil || mf.appleTypes == nil {
+		t.Fatal("__apple_names and __apple_types are not loaded")
+	}
+	entries, err := mf.appleNames.Lookup("fib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Offset != 0x32 {
+		t.Fatalf("unexpected __apple_names entries of fib: %v", entries)
+	}
+
+	mf.SetLoadSlide(0x1000)
+	for name, want := range map[string][2]uint64{
+		"fib":  {0x100004ee4, 0x100004f5c},
+		"main": {0x100004f5c, 0x100004fa8},
+	} {
+		subs, err := mf.LookupFunction(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(subs) != 1 || subs[0].Name != name || len(subs[0].PCRanges) != 1 || subs[0].PCRanges[0] != want {
+			t.Fatalf("unexpected ranges of %s: %+v", name, subs)
+		}
+	}
+	if subs, err := mf.LookupFunction("nonexistent"); err != nil || len(subs) != 0 {
+		t.Fatalf("expect no function, got %+v, %v", subs, err)
+	}
+
+	// the PC lookups go through the function index of __apple_names
+	sym, err := mf.Atos(0x100004f00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym.Func != "fib" || sym.FuncStart != 0x100004ee4 {
+		t.Fatalf("unexpected symbol %+v", sym)
+	}
+	if len(mf.funcIndex) != 2 {
+		t.Fatalf("unexpected function index %+v", mf.funcIndex)
+	}
+
+	types, err := mf.LookupType("int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 1 || types[0].String() != "int" {
+		t.Fatalf("unexpected types of int: %v", types)
+	}
+}
+
+// testdata/names.elf is built from testdata/names.ll by "llc -filetype=obj -accel-tables=Dwarf" and linked by "gcc -no-pie"
+func TestTruncatedAppleAccelTable(t *testing.T) {
+	le := binary.LittleEndian
+	b := le.AppendUint32(nil, appleHashMagic)
+	b = le.AppendUint16(b, 1)
+	b = le.AppendUint16(b, appleHashDJB)
+	for _, v := range []uint32{1, 1, 12, 0, 1} { // 1 bucket, 1 hash, the header data, no DIE offset base, 1 atom
+		b = le.AppendUint32(b, v)
+	}
+	b = le.AppendUint16(b, dwAtomDIEOffset)
+	b = le.AppendUint16(b, 0x06) // DW_FORM_data4
+	b = le.AppendUint32(b, 0)    // the bucket
+	b = le.AppendUint32(b, djbHash("x"))
+	b = le.AppendUint32(b, 0x7fffffff) // the hash data offset is past the end of the table
+
+	table, err := ParseAppleAccelTable(b, []byte("\x00x\x00"), le)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = table.Lookup("x"); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err = table.Entries(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestDebugNames(t *testing.T) {
+	ef, err := OpenELF("testdata/names.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+
+	if ef.debugNames == nil || !ef.HasAccelTables() {
+		t.Fatal(".debug_names is not loaded")
+	}
+	subs, err := ef.LookupFunction("Square")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 1 || subs[0].PCRanges[0][0] != 0x401110 {
+		t.Fatalf("unexpected ranges of Square: %+v", subs)
+	}
+	sym, err := ef.Atos(0x401110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym.Func != "Square" || len(ef.funcIndex) != 2 {
+		t.Fatalf("unexpected symbol %+v of the function index %+v", sym, ef.funcIndex)
+	}
+	// the hash is case-insensitive but the names are not
+	if subs, err = ef.LookupFunction("square"); err != nil || len(subs) != 0 {
+		t.Fatalf("expect no function, got %+v, %v", subs, err)
+	}
+	if types, err := ef.LookupType("int"); err != nil || len(types) != 1 {
+		t.Fatalf("unexpected types of int: %v, %v", types, err)
+	}
+}
+
+func TestLookupFunctionWithoutAccelTables(t *testing.T) {
+	ef, err := OpenELF("testdata/inline.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+
+	if ef.HasAccelTables() {
+		t.Fatal("inline.elf has no accelerator tables")
+	}
+	subs, err := ef.LookupFunction("sum_squares")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) == 0 {
+		t.Fatal("expect the ranges of sum_squares by scanning the DIEs")
+	}
+	for _, sub := range subs {
+		if sub.Name != "sum_squares" {
+			t.Fatalf("unexpected function %s", sub.Name)
+		}
+	}
+}
+
+// testdata/types.elf is built from testdata/types.cc by "g++ -g -O0 -fdebug-prefix-map=$PWD=/src"
+func TestLookupTypeDefinitions(t *testing.T) {
+	ef, err := OpenELF("testdata/types.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+
+	offsets, err := ef.LookupTypeDefinitions("Widget")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 1 {
+		t.Fatalf("unexpected definitions of Widget: %v", offsets)
+	}
+	if ty, err := ef.DWARFData().Type(offsets[0]); err != nil || ty.Size() != 96 {
+		t.Fatalf("unexpected type of Widget: %v, %v", ty, err)
+	}
+	if offsets, err = ef.LookupTypeDefinitions("Missing"); err != nil || len(offsets) != 0 {
+		t.Fatalf("expect no type, got %v, %v", offsets, err)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -17,6 +19,10 @@ import (
 
 const cpuArch64 = 0x01000000
 
+const cpuSubTypeMask = 0x00ffffff // strip the capability bits, e.g. CPU_SUBTYPE_LIB64
+
+const loadCmdUUID = 0x1b // LC_UUID
+
 // Log is the internal logger, the default is a no-op one,
 // replace it with your custom *zap.SugaredLogger like below to enable it
 //
@@ -45,6 +51,7 @@ const (
 type SubProgram struct {
 	PCRanges [][2]uint64
 	Name     string
+	Inlined  bool // an inlined copy of the function
 }
 
 type Arch struct {
@@ -79,6 +86,31 @@ var archSet = map[string]Arch{
 	"arm64e":  ArchARM64e,
 }
 
+// String returns the canonical architecture name, e.g. "arm64" or "x86_64"
+func (a Arch) String() string {
+	switch a {
+	case ArchI386:
+		return "i386"
+	case ArchX64:
+		return "x86_64"
+	case ArchX64h:
+		return "x86_64h"
+	case ArchARM:
+		return "arm"
+	case ArchARMv6:
+		return "armv6"
+	case ArchARMv7:
+		return "armv7"
+	case ArchARMv7s:
+		return "armv7s"
+	case ArchARM64:
+		return "arm64"
+	case ArchARM64e:
+		return "arm64e"
+	}
+	return fmt.Sprintf("%s:%d", a.Cpu, a.SubCpu)
+}
+
 func ParseArch(arch string) (Arch, error) {
 	arch = strings.ToLower(strings.TrimSpace(arch))
 	if ac, ok := archSet[arch]; ok {
@@ -87,24 +119,92 @@ func ParseArch(arch string) (Arch, error) {
 	return Arch{}, fmt.Errorf("unsupported architecture: %s", arch)
 }
 
+// Symbol is the symbolication result of a PC, the source location fields are zero if
+// there is no line info for the PC, e.g. it's only covered by the symbol table
 type Symbol struct {
-	Func string
-	Line *dwarf.LineEntry
+	Func string // the function name, e.g. "main" or "-[Crasher throwUncaughtNSException]"
+	// LinkageName is the mangled name of the function if it differs from Func, e.g. "_ZN3foo3barEv"
+	LinkageName string
+	File        string // the source file path as recorded in the line table
+	Line        int    // the 1-based source line, 0 if unknown or compiler generated
+	// Column is the 1-based source column, 0 if unknown, which tells apart the expressions of a dense line
+	Column int
+	// Discriminator tells apart the basic blocks of the same source line, e.g. the iterations of an unrolled loop
+	Discriminator int
+	CompDir       string // the compilation directory of the CU, i.e. DW_AT_comp_dir
+	IsStmt        bool   // the address is a recommended breakpoint location of the line
+	PrologueEnd   bool   // the address is where the function prologue ends
+	// Approximate is set if the line table has line 0 for the PC and the line is guessed, see LineZeroPolicy
+	Approximate bool
+
+	FuncStart  uint64 // the runtime entry address of the function, 0 if unknown
+	FuncEnd    uint64 // the runtime end address of the function, exclusive, 0 if unknown
+	FuncOffset uint64 // the offset of the PC from FuncStart, e.g. "main + 24"
+}
+
+// HasLine reports if the source location is known
+func (s *Symbol) HasLine() bool {
+	return s.File != ""
+}
+
+// Path returns the path of the source file, a relative File is joined with the CompDir
+func (s *Symbol) Path() string {
+	if s.File == "" || path.IsAbs(s.File) || s.CompDir == "" {
+		return s.File
+	}
+	return path.Join(s.CompDir, s.File)
+}
+
+// Demangled returns the demangled name of the function, see Demangle
+func (s *Symbol) Demangled() string {
+	if s.LinkageName != "" {
+		return Demangle(s.LinkageName)
+	}
+	return Demangle(s.Func)
+}
+
+// setFuncRange sets the function bounds of the symbol, which are runtime addresses, end can be 0 if unknown
+func (s *Symbol) setFuncRange(start, end, pc uint64) {
+	s.FuncStart = start
+	s.FuncEnd = end
+	if pc >= start {
+		s.FuncOffset = pc - start
+	}
+}
+
+// newSymbol fills the source location of a Symbol from a line table row, le can be nil
+func newSymbol(name string, le *dwarf.LineEntry, compDir string) *Symbol {
+	sym := &Symbol{Func: name}
+	if le == nil || le.File == nil {
+		return sym
+	}
+	sym.File = le.File.Name
+	sym.Line = le.Line
+	sym.Column = le.Column
+	sym.Discriminator = le.Discriminator
+	sym.CompDir = compDir
+	sym.IsStmt = le.IsStmt
+	sym.PrologueEnd = le.PrologueEnd
+	return sym
 }
 
 type MachFile struct {
-	r  io.ReaderAt
-	ff *macho.FatFile
+	name string
+	r    io.ReaderAt
+	ff   *macho.FatFile
 	*macho.File
-	vmAddr       uint64
-	loadSlide    uint64
-	debugAranges []*DwarfArange
-	symbolTable  []*macho.Symbol
-	dwarf        *dwarf.Data
-	dwarfReader  *dwarf.Reader
+	dwarfImage
+	symbolTable []*macho.Symbol
+	fixups      *fixupTable // loaded by Fixups
 }
 
 func OpenMachO(file string, arch Arch) (*MachFile, error) {
+	return openMachO(file, arch, true)
+}
+
+// openMachO opens a Mach-O file, the binaries without debug info are symbolicated from the
+// symbol table if requireDWARF is false, e.g. the system libraries of a device support directory
+func openMachO(file string, arch Arch, requireDWARF bool) (*MachFile, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, fmt.Errorf("unable to open file %s: %v", file, err)
@@ -114,28 +214,58 @@ func OpenMachO(file string, arch Arch) (*MachFile, error) {
 		defer f.Close()
 		return nil, fmt.Errorf("unable to parse Mach-O file [%s]: %w", file, err)
 	}
-	_ = mf.parseDebugAranges()
+	if mf.Type == machoFileset {
+		// a kernel collection, e.g. a kernelcache, open the kernel itself
+		_ = mf.Close()
+		return OpenFilesetEntry(file, KernelFilesetEntry, arch)
+	}
+	mf.name = filepath.Base(file)
+	if err = mf.load(requireDWARF); err != nil {
+		_ = mf.Close()
+		return nil, err
+	}
+	return mf, nil
+}
+
+// load parses __TEXT vmaddr, the symbol table and the DWARF debug info, the images without
+// debug info, e.g. the kexts of a kernel collection, are symbolicated from the symbol table
+func (mf *MachFile) load(requireDWARF bool) error {
 	for _, load := range mf.Loads {
 		if s, ok := load.(*macho.Segment); ok && s.Name == "__TEXT" {
 			mf.vmAddr = s.Addr // parse __TEXT vmaddr
 			break
 		}
 	}
-	mf.symbolTable = make([]*macho.Symbol, len(mf.Symtab.Syms))
-	for i := range mf.Symtab.Syms {
-		mf.symbolTable[i] = &mf.Symtab.Syms[i]
+	if mf.Symtab != nil {
+		mf.symbolTable = make([]*macho.Symbol, len(mf.Symtab.Syms))
+		for i := range mf.Symtab.Syms {
+			mf.symbolTable[i] = &mf.Symtab.Syms[i]
+		}
 	}
 	sort.Slice(mf.symbolTable, func(i, j int) bool {
 		return mf.symbolTable[i].Value >= mf.symbolTable[j].Value // descending sort
 	})
-	dwarfData, err := mf.DWARF()
-	if err != nil {
-		_ = mf.Close()
-		return nil, fmt.Errorf("unable to parse DWARF debug info: %w", err)
+	mf.addExports()
+	if err := mf.loadDWARF(); err != nil {
+		if requireDWARF {
+			return fmt.Errorf("unable to parse DWARF debug info: %w", err)
+		}
+		Log.Debugf("no DWARF debug info in [%s], fall back to the symbol table: %v", mf.name, err)
 	}
-	mf.dwarf = dwarfData
-	mf.dwarfReader = dwarfData.Reader()
-	return mf, nil
+	return nil
+}
+
+// addSymbols merges more symbols into the symbol table, e.g. the local symbols of a dylib in a dyld shared cache
+func (mf *MachFile) addSymbols(syms []macho.Symbol) {
+	if len(syms) == 0 {
+		return
+	}
+	for i := range syms {
+		mf.symbolTable = append(mf.symbolTable, &syms[i])
+	}
+	sort.Slice(mf.symbolTable, func(i, j int) bool {
+		return mf.symbolTable[i].Value >= mf.symbolTable[j].Value // descending sort
+	})
 }
 
 func Parse(r io.ReaderAt, arch Arch) (*MachFile, error) {
@@ -152,7 +282,7 @@ func Parse(r io.ReaderAt, arch Arch) (*MachFile, error) {
 			return nil, fmt.Errorf("invalid Fat Mach-O file: %w", err)
 		}
 		for _, fa := range ff.Arches {
-			if fa.Cpu == arch.Cpu && fa.SubCpu == arch.SubCpu {
+			if fa.Cpu == arch.Cpu && fa.SubCpu&cpuSubTypeMask == arch.SubCpu {
 				return &MachFile{
 					r:    r,
 					ff:   ff,
@@ -167,7 +297,7 @@ func Parse(r io.ReaderAt, arch Arch) (*MachFile, error) {
 		if err != nil {
 			return nil, fmt.Errorf("invalid Mach-O file: %w", err)
 		}
-		if f.Cpu != arch.Cpu || f.SubCpu != arch.SubCpu {
+		if f.Cpu != arch.Cpu || f.SubCpu&cpuSubTypeMask != arch.SubCpu {
 			defer f.Close()
 			return nil, fmt.Errorf("the expected arch [%s:%d] not match with the Mach-O file [%s:%d]",
 				arch.Cpu, arch.SubCpu, f.Cpu, f.SubCpu)
@@ -181,12 +311,26 @@ func Parse(r io.ReaderAt, arch Arch) (*MachFile, error) {
 	return nil, fmt.Errorf("invalid Mach-O magic: 0x%x", magicBe)
 }
 
-func (f *MachFile) VMAddr() uint64 {
-	return f.vmAddr
+// ImageName returns the file name of the binary or the dSYM DWARF file, e.g. "App"
+func (f *MachFile) ImageName() string {
+	return f.name
 }
 
-func (f *MachFile) LoadSlide() uint64 {
-	return f.loadSlide
+func (f *MachFile) Arch() Arch {
+	return Arch{Cpu: f.Cpu, SubCpu: f.SubCpu & cpuSubTypeMask}
+}
+
+// UUID returns the LC_UUID of the Mach-O file, which is used to match a binary with its dSYM
+func (f *MachFile) UUID() ([16]byte, bool) {
+	var uuid [16]byte
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) >= 24 && f.ByteOrder.Uint32(raw) == loadCmdUUID {
+			copy(uuid[:], raw[8:24])
+			return uuid, true
+		}
+	}
+	return uuid, false
 }
 
 func (f *MachFile) Close() error {
@@ -210,160 +354,132 @@ func (f *MachFile) Close() error {
 	return nil
 }
 
-// parseDebugAranges parse __debug_aranges or __zdebug_aranges
-func (f *MachFile) parseDebugAranges() error {
+// loadDWARF loads the DWARF debug info, and the raw sections for the fast CU lookup and the accelerator tables
+func (f *MachFile) loadDWARF() error {
+	dwarfData, err := f.DWARF()
+	if err != nil {
+		return err
+	}
+	secs := newDWARFSections(f.ByteOrder)
 	for _, section := range f.File.Sections {
-		if section.Name == "__debug_aranges" || section.Name == "__zdebug_aranges" {
-			b, err := sectionData(section)
-			if err != nil {
-				return err
-			}
-			aranges, err := ParseDebugAranges(newBytesReader(b))
-			if err != nil {
-				return fmt.Errorf("unable to parse _debug_aranges: %w", err)
-			}
-			f.debugAranges = append(f.debugAranges, aranges...)
+		name := dwarfSectionName(section.Name)
+		if !rawDWARFSections[name] {
+			continue
 		}
+		b, err := sectionData(section)
+		if err != nil {
+			Log.Debugf("unable to read %s: %v", section.Name, err)
+			continue
+		}
+		secs.add(name, b)
 	}
-	if len(f.debugAranges) > 0 {
-		sort.Slice(f.debugAranges, func(i, j int) bool {
-			return f.debugAranges[i].LowPC < f.debugAranges[j].LowPC
-		})
-	}
+	f.dwarfImage.init(dwarfData, secs)
 	return nil
 }
 
-func (f *MachFile) SetLoadAddress(lAddr uint64) {
-	f.loadSlide = lAddr - f.vmAddr
-}
-
-func (f *MachFile) LoadAddress() uint64 {
-	return f.vmAddr + f.loadSlide
-}
-
-func (f *MachFile) SetLoadSlide(loadSlide uint64) {
-	f.loadSlide = loadSlide
-}
-
-func (f *MachFile) Atos(pc uint64) (*Symbol, error) {
-	vmAddr := pc - f.loadSlide
-	entry, err := f.LocateCUEntry(vmAddr)
-	if err != nil {
-		return nil, err
-	}
-	if entry.Tag != dwarf.TagCompileUnit {
-		return nil, fmt.Errorf("expect a compile unit entry but got %s", entry.Tag.String())
+// ResolveNameFromSymTab returns the name of the function containing the unslid addr from the symbol table,
+// the stubs and the symbol pointers are resolved by the indirect symbol table, e.g. "symbol stub for: objc_msgSend"
+func (f *MachFile) ResolveNameFromSymTab(addr uint64) (string, error) {
+	if name, ok := f.stubSymbol(addr); ok {
+		return name, nil
 	}
-	lReader, err := f.dwarf.LineReader(entry)
+	symbol, err := f.textSymbol(addr)
 	if err != nil {
-		return nil, fmt.Errorf("unable to init the line table's reader: %w", err)
-	}
-	var le dwarf.LineEntry
-	if err = lReader.SeekPC(vmAddr, &le); err != nil {
-		return nil, fmt.Errorf("unable to locate line entry: %w", err)
-	}
-
-	//name, err := f.ResolveNameFromSymTab(trueAddr)
-	//if err == nil {
-	//	return &Symbol{
-	//		Func: name,
-	//		Line: &le,
-	//	}, nil
-	//}
-
-	var ranges [][2]uint64
-	for {
-		entry, err = f.dwarfReader.Next()
-		if entry == nil && err == nil {
-			break // EOF
-		}
-		if err != nil {
-			return nil, fmt.Errorf("unable to fetch CU Subprogram entry: %w", err)
-		}
-		if entry.Tag == dwarf.TagCompileUnit || entry.Tag == dwarf.TagPartialUnit { // Got next CU or PU
-			return nil, fmt.Errorf("unable to find the target subprogram entry cause current CU has reached the end")
-		}
-		if entry.Tag == dwarf.TagSubprogram {
-			ranges, err = f.dwarf.Ranges(entry)
-			if err != nil {
-				return nil, fmt.Errorf("unable to parse subprogram ranges: %w", err)
-			}
-			for _, addrRange := range ranges {
-				if addrRange[0] <= vmAddr && addrRange[1] >= vmAddr {
-					funcName, _ := entry.Val(dwarf.AttrName).(string)
-					// TODO: handle inlined function
-					//inlined := entry.Val(dwarf.AttrInline)
-					return &Symbol{
-						Func: funcName,
-						Line: &le,
-					}, nil
-				}
-			}
-		}
+		return "", err
 	}
-
-	return nil, fmt.Errorf("unable to find subprogram entry")
+	return symbol.Name, nil
 }
 
-func (f *MachFile) FastLocateCUEntry(addr uint64) (*dwarf.Entry, error) {
-	if len(f.debugAranges) == 0 {
-		return nil, fmt.Errorf("no debug aranges available")
-	}
-	idx, found := sort.Find(len(f.debugAranges), func(i int) int {
-		if f.debugAranges[i].LowPC <= addr && f.debugAranges[i].HighPC >= addr {
-			return 0
-		}
-		if f.debugAranges[i].LowPC > addr {
-			return -1
-		}
-		return 1
+// textSymbol returns the symbol table entry of the function containing addr, which is a
+// defined symbol in __TEXT,__text, or __TEXT_EXEC,__text of the kernel and kexts
+func (f *MachFile) textSymbol(addr uint64) (*macho.Symbol, error) {
+	idx := sort.Search(len(f.symbolTable), func(i int) bool {
+		return f.symbolTable[i].Value <= addr
 	})
-	if found {
-		cuHeaderOff := f.debugAranges[idx].CUOffset
-		for _, section := range f.Sections {
-			if section.Name == "__debug_info" || section.Name == "__zdebug_info" {
-				secData, err := sectionData(section)
-				if err != nil {
-					return nil, fmt.Errorf("unable to parse __debug_info in DWARF: %w", err)
-				}
-				cuBodyOff, err := GetCUBodyOffset(cuHeaderOff, newBytesReader(secData))
-				if err != nil {
-					return nil, fmt.Errorf("unable to locate CU by CU offset: %w", err)
-				}
-				f.dwarfReader.Seek(dwarf.Offset(cuBodyOff))
-				return f.dwarfReader.Next()
-			}
-		}
+	// skip the debugging symbols, which share the addresses of the functions
+	for idx < len(f.symbolTable) && f.symbolTable[idx].Type&nStab != 0 {
+		idx++
 	}
-	return nil, fmt.Errorf("unable to locate CU via __debug_arrages section cause the target PC is not in any PC ranges")
-}
-
-func (f *MachFile) LocateCUEntry(addr uint64) (*dwarf.Entry, error) {
-	if len(f.debugAranges) > 0 {
-		entry, err := f.FastLocateCUEntry(addr)
-		if err == nil {
-			return entry, nil
-		}
-		Log.Debugf("unable to seek CU for addr [0x%x] via __debug_aranges(reason: %v), try to iterate all CUs", addr, err)
+	if idx >= len(f.symbolTable) {
+		return nil, fmt.Errorf("no symbol table entry for addr 0x%x", addr)
+	}
+	symbol := f.symbolTable[idx]
+	if symbol.Sect == 0 || int(symbol.Sect) > len(f.Sections) {
+		return nil, fmt.Errorf("symbol table entry for addr 0x%x has no section", addr)
+	}
+	section := f.Sections[symbol.Sect-1]
+	if (section.Seg != "__TEXT" && section.Seg != "__TEXT_EXEC") || section.Name != "__text" {
+		return nil, fmt.Errorf("symbol table entry for addr 0x%x is not in __TEXT,__text section", addr)
 	}
-	return f.dwarfReader.SeekPC(addr)
+	if symbol.Type&nSect != nSect {
+		return nil, fmt.Errorf("symbol table entry for addr 0x%x is not N_SECT type", addr)
+	}
+	if addr >= section.Addr+section.Size {
+		return nil, fmt.Errorf("addr 0x%x is beyond the section of its nearest symbol", addr)
+	}
+	return symbol, nil
 }
 
-func (f *MachFile) ResolveNameFromSymTab(addr uint64) (string, error) {
+// dataSymbol returns the symbol table entry of the data containing addr, which is the nearest defined
+// symbol in the same section, and its size up to the next symbol or the end of the section
+func (f *MachFile) dataSymbol(addr uint64) (*macho.Symbol, uint64, error) {
 	idx := sort.Search(len(f.symbolTable), func(i int) bool {
 		return f.symbolTable[i].Value <= addr
 	})
+	for idx < len(f.symbolTable) && (f.symbolTable[idx].Type&nStab != 0 || f.symbolTable[idx].Type&nSect != nSect) {
+		idx++
+	}
 	if idx >= len(f.symbolTable) {
-		return "", fmt.Errorf("no symbol table entry for addr 0x%x", addr)
+		return nil, 0, fmt.Errorf("no symbol table entry for addr 0x%x", addr)
 	}
 	symbol := f.symbolTable[idx]
-	if f.Sections[symbol.Sect-1].Seg != "__TEXT" || f.Sections[symbol.Sect-1].Name != "__text" {
-		return "", fmt.Errorf("symbol table entry for addr 0x%x is not in __TEXT,__text section", addr)
+	if symbol.Sect == 0 || int(symbol.Sect) > len(f.Sections) {
+		return nil, 0, fmt.Errorf("symbol table entry for addr 0x%x has no section", addr)
 	}
-	if symbol.Type&0x0e != 0x0e {
-		return "", fmt.Errorf("symbol table entry for addr 0x%x is not N_SECT type", addr)
+	section := f.Sections[symbol.Sect-1]
+	if addr >= section.Addr+section.Size {
+		return nil, 0, fmt.Errorf("addr 0x%x is beyond the section of its nearest symbol", addr)
 	}
-	return symbol.Name, nil
+	end := section.Addr + section.Size
+	// the table is sorted descending, the next symbol is the nearest one before idx at a higher address
+	for i := idx - 1; i >= 0; i-- {
+		next := f.symbolTable[i]
+		if next.Value > symbol.Value && next.Type&nStab == 0 && next.Type&nSect == nSect {
+			end = min(end, next.Value)
+			break
+		}
+	}
+	return symbol, end - symbol.Value, nil
+}
+
+// Atos resolves the PC from the DWARF debug info, or from the symbol table if there is no debug info.
+// The PCs in the stubs are resolved to the symbols they call, e.g. "symbol stub for: objc_msgSend"
+func (f *MachFile) Atos(pc uint64) (*Symbol, error) {
+	if name, ok := f.stubSymbol(pc - f.loadSlide); ok {
+		return &Symbol{Func: name}, nil
+	}
+	if f.dwarf != nil {
+		return f.dwarfImage.Atos(pc)
+	}
+	symbol, err := f.textSymbol(pc - f.loadSlide)
+	if err != nil {
+		return nil, err
+	}
+	sym := &Symbol{Func: strings.TrimPrefix(symbol.Name, "_")}
+	sym.setFuncRange(symbol.Value+f.loadSlide, 0, pc)
+	return sym, nil
+}
+
+// Frames resolves the inlined call chain of the PC, without debug info it's just the symbol of Atos
+func (f *MachFile) Frames(pc uint64) ([]*Symbol, error) {
+	if f.dwarf != nil {
+		return f.dwarfImage.Frames(pc)
+	}
+	sym, err := f.Atos(pc)
+	if err != nil {
+		return nil, err
+	}
+	return []*Symbol{sym}, nil
 }
 
 func sectionData(s *macho.Section) ([]byte, error) {
@@ -371,7 +487,12 @@ func sectionData(s *macho.Section) ([]byte, error) {
 	if err != nil && uint64(len(b)) < s.Size {
 		return nil, fmt.Errorf("unable to read Mach-O section data: %w", err)
 	}
+	return zdebugData(b)
+}
 
+// zdebugData decompresses the data of a __zdebug_*/.zdebug_* section, which starts with
+// "ZLIB" and the 8 bytes big-endian uncompressed size, other data is returned as is
+func zdebugData(b []byte) ([]byte, error) {
 	if len(b) >= 12 && string(b[:4]) == "ZLIB" {
 		secLen := binary.BigEndian.Uint64(b[4:12])
 		secData := make([]byte, secLen)
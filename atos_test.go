@@ -10,6 +10,43 @@ import (
 	"testing"
 )
 
+// testSection64 builds a section_64 of a test image
+func testSection64(name, seg string, addr, size uint64, off, flags, reserved1, reserved2 uint32) []byte {
+	le := binary.LittleEndian
+	b := make([]byte, 32)
+	copy(b, name)
+	copy(b[16:], seg)
+	b = le.AppendUint64(b, addr)
+	b = le.AppendUint64(b, size)
+	b = le.AppendUint32(b, off)
+	b = append(b, make([]byte, 12)...) // align, reloff and nreloc
+	b = le.AppendUint32(b, flags)
+	b = le.AppendUint32(b, reserved1)
+	b = le.AppendUint32(b, reserved2)
+	return le.AppendUint32(b, 0)
+}
+
+// testSegment64 builds a LC_SEGMENT_64 of a test image followed by its sections, see testSection64
+func testSegment64(name string, addr, vmSize, off, fileSize uint64, sects ...[]byte) []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint32(nil, uint32(macho.LoadCmdSegment64))
+	b = le.AppendUint32(b, uint32(72+80*len(sects)))
+	b = append(b, make([]byte, 16)...)
+	copy(b[8:], name)
+	b = le.AppendUint64(b, addr)
+	b = le.AppendUint64(b, vmSize)
+	b = le.AppendUint64(b, off)
+	b = le.AppendUint64(b, fileSize)
+	b = le.AppendUint32(b, 5) // maxprot
+	b = le.AppendUint32(b, 5) // initprot
+	b = le.AppendUint32(b, uint32(len(sects)))
+	b = le.AppendUint32(b, 0)
+	for _, sect := range sects {
+		b = append(b, sect...)
+	}
+	return b
+}
+
 func TestReadStruct(t *testing.T) {
 
 	type st struct {
@@ -79,7 +116,7 @@ func TestAtos(t *testing.T) {
 	}
 
 	t.Logf("func name: %s, source file: %s, at line: %d ",
-		symbol.Func, symbol.Line.File.Name, symbol.Line.Line)
+		symbol.Func, symbol.File, symbol.Line)
 
 }
 
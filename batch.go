@@ -0,0 +1,114 @@
+package atos
+
+import (
+	"debug/macho"
+)
+
+// ReturnAddressAdjustment returns the size subtracted from a return address to land in its call
+// instruction, i.e. the instruction size of the fixed width architectures, or 1 for x86
+func (a Arch) ReturnAddressAdjustment() uint64 {
+	switch a.Cpu {
+	case macho.CpuArm64:
+		return 4
+	case macho.CpuArm:
+		return 2 // the Thumb instructions are 2 bytes at least
+	}
+	return 1
+}
+
+// CallerPC converts the return address of a caller frame to an address in its call instruction,
+// without which the caller frames often resolve to the line after the call
+func CallerPC(pc uint64, arch Arch) uint64 {
+	if adj := arch.ReturnAddressAdjustment(); pc >= adj {
+		return pc - adj
+	}
+	return pc
+}
+
+// DefaultVirtualAddressBits is the virtual address size of the arm64 processes of the Apple platforms,
+// the bits above it hold the pointer authentication code or the top byte tag of a pointer
+const DefaultVirtualAddressBits = 47
+
+// CanonicalAddress strips the pointer authentication code and the top byte tag of an arm64(e) address, i.e.
+// the bits above vaBits are replaced with the bit 55, which is set for the kernel addresses only. vaBits 0
+// means DefaultVirtualAddressBits. The addresses of the other architectures are returned unchanged
+func (a Arch) CanonicalAddress(addr uint64, vaBits uint) uint64 {
+	if a.Cpu != macho.CpuArm64 {
+		return addr
+	}
+	if vaBits == 0 {
+		vaBits = DefaultVirtualAddressBits
+	}
+	if vaBits >= 64 {
+		return addr
+	}
+	mask := uint64(1)<<vaBits - 1
+	if addr&(1<<55) != 0 {
+		return addr | ^mask
+	}
+	return addr & mask
+}
+
+// BacktraceOptions controls how SymbolicateBacktrace resolves the frames
+type BacktraceOptions struct {
+	// CallerFrames treats all the PCs except the first one as return addresses, see CallerPC
+	CallerFrames bool
+	// ReturnAddresses treats all the PCs including the first one as return addresses,
+	// e.g. the link registers of a kernel panic backtrace
+	ReturnAddresses bool
+	// InlineFrames resolves the inlined call chain of each PC with Frames
+	InlineFrames bool
+	// StripPointerAuth strips the pointer authentication codes of the signed return addresses
+	// of arm64e before the lookup, see Arch.CanonicalAddress
+	StripPointerAuth bool
+	// VirtualAddressBits is the virtual address size for StripPointerAuth, 0 means DefaultVirtualAddressBits
+	VirtualAddressBits uint
+	// ImageOpened is called by the Symbolicate of the crash and panic reports when the symbol file of an image
+	// is opened and slid, with the path of the file, e.g. to print a header for each image
+	ImageOpened func(sym Symbolizer, path string)
+}
+
+// BacktraceFrame is the symbolication result of a PC in a backtrace
+type BacktraceFrame struct {
+	PC       uint64    // the input PC
+	LookupPC uint64    // the PC actually looked up, which differs from PC for the adjusted caller frames and the stripped pointers
+	Symbols  []*Symbol // the symbol of the PC, or the inlined call chain with the innermost first
+	Err      error
+}
+
+// SymbolicateBacktrace resolves the PCs of a backtrace, the first one is the crashing frame.
+// The FuncOffset of the symbols is relative to the input PC, or the stripped one, even if the lookup was adjusted
+func SymbolicateBacktrace(s Symbolizer, pcs []uint64, opts BacktraceOptions) []BacktraceFrame {
+	frames := make([]BacktraceFrame, len(pcs))
+	for i, pc := range pcs {
+		frames[i] = SymbolicateFrame(s, pc, i, opts)
+	}
+	return frames
+}
+
+// SymbolicateFrame resolves the PC of the i-th frame of a backtrace, the frame 0 is the crashing frame,
+// see SymbolicateBacktrace. It keeps the frame indices of a backtrace which has some PCs missing
+func SymbolicateFrame(s Symbolizer, pc uint64, i int, opts BacktraceOptions) BacktraceFrame {
+	frame := BacktraceFrame{PC: pc, LookupPC: pc}
+	if opts.StripPointerAuth {
+		pc = s.Arch().CanonicalAddress(pc, opts.VirtualAddressBits)
+		frame.LookupPC = pc
+	}
+	if opts.ReturnAddresses || opts.CallerFrames && i > 0 {
+		frame.LookupPC = CallerPC(pc, s.Arch())
+	}
+	if opts.InlineFrames {
+		frame.Symbols, frame.Err = s.Frames(frame.LookupPC)
+	} else {
+		var symbol *Symbol
+		if symbol, frame.Err = s.Atos(frame.LookupPC); frame.Err == nil {
+			frame.Symbols = []*Symbol{symbol}
+		}
+	}
+	for _, symbol := range frame.Symbols {
+		if symbol.FuncStart > 0 && pc >= symbol.FuncStart {
+			symbol.FuncOffset = pc - symbol.FuncStart
+		}
+	}
+	return frame
+}
@@ -0,0 +1,84 @@
+package atos
+
+import (
+	"testing"
+)
+
+func TestReturnAddressAdjustment(t *testing.T) {
+	for arch, want := range map[Arch]uint64{ArchARM64: 4, ArchARM64e: 4, ArchARMv7: 2, ArchX64: 1, ArchI386: 1} {
+		if got := arch.ReturnAddressAdjustment(); got != want {
+			t.Errorf("%s: expect %d, got %d", arch, want, got)
+		}
+	}
+	if pc := CallerPC(0x100003f04, ArchARM64); pc != 0x100003f00 {
+		t.Fatalf("unexpected caller PC 0x%x", pc)
+	}
+}
+
+func TestSymbolicateBacktrace(t *testing.T) {
+	mf, err := OpenMachO("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+
+	// 0x100003f04 starts line 7, the return address of a call on line 5
+	pcs := []uint64{0x100003f04, 0x100003f04, 0x1}
+	frames := SymbolicateBacktrace(mf, pcs, BacktraceOptions{CallerFrames: true})
+	if len(frames) != 3 {
+		t.Fatalf("expect 3 frames, got %d", len(frames))
+	}
+	if frames[0].LookupPC != 0x100003f04 || frames[0].Symbols[0].Line != 7 {
+		t.Fatalf("the crashing frame must not be adjusted: %+v", frames[0])
+	}
+	caller := frames[1]
+	if caller.LookupPC != 0x100003f00 || caller.Symbols[0].Line != 5 || caller.Symbols[0].FuncOffset != 0x20 {
+		t.Fatalf("unexpected caller frame: %+v %+v", caller, caller.Symbols[0])
+	}
+	if frames[2].Err == nil {
+		t.Fatal("expect an error for the unknown PC")
+	}
+	// the frame 1 of a backtrace whose frame 0 is missing is still a caller frame
+	if frame := SymbolicateFrame(mf, 0x100003f04, 1, BacktraceOptions{CallerFrames: true}); frame.LookupPC != 0x100003f00 {
+		t.Fatalf("the caller frame must be adjusted: %+v", frame)
+	}
+}
+
+func TestCanonicalAddress(t *testing.T) {
+	for _, c := range []struct {
+		arch   Arch
+		addr   uint64
+		vaBits uint
+		want   uint64
+	}{
+		{ArchARM64e, 0x2f3c800100003f04, 0, 0x100003f04},
+		{ArchARM64e, 0xb841800000000000, 0, 0},
+		{ArchARM64, 0x00000001a0b1c2d4, 0, 0x1a0b1c2d4},
+		{ArchARM64e, 0x2f3c800100003f04, 39, 0x100003f04},
+		{ArchARM64e, 0xfffffe0027ec4048, 0, 0xfffffe0027ec4048}, // a kernel address
+		{ArchARM64e, 0x9f80fe0027ec4048, 41, 0xfffffe0027ec4048},
+		{ArchX64, 0x2f3c800100003f04, 0, 0x2f3c800100003f04},
+	} {
+		if got := c.arch.CanonicalAddress(c.addr, c.vaBits); got != c.want {
+			t.Errorf("%s: CanonicalAddress(0x%x, %d) = 0x%x, want 0x%x", c.arch, c.addr, c.vaBits, got, c.want)
+		}
+	}
+
+	mf, err := OpenMachO("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	signed := []uint64{0x2f3c800100003f04, 0x1a2b000100003f04}
+	frames := SymbolicateBacktrace(mf, signed, BacktraceOptions{CallerFrames: true})
+	if frames[0].Err == nil {
+		t.Fatal("expect an error for the signed PC without stripping")
+	}
+	frames = SymbolicateBacktrace(mf, signed, BacktraceOptions{CallerFrames: true, StripPointerAuth: true})
+	if frames[0].PC != signed[0] || frames[0].LookupPC != 0x100003f04 || frames[0].Symbols[0].Line != 7 {
+		t.Fatalf("unexpected stripped frame: %+v", frames[0])
+	}
+	if frames[1].LookupPC != 0x100003f00 || frames[1].Symbols[0].FuncOffset != 0x20 {
+		t.Fatalf("unexpected stripped caller frame: %+v %+v", frames[1], frames[1].Symbols[0])
+	}
+}
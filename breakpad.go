@@ -0,0 +1,417 @@
+package atos
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type breakpadInline struct {
+	depth    int
+	callLine int
+	callFile int
+	origin   int
+	ranges   [][2]uint64
+}
+
+func (in *breakpadInline) contains(addr uint64) bool {
+	for _, rg := range in.ranges {
+		if rg[0] <= addr && addr < rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+type breakpadSymFunc struct {
+	addr    uint64
+	size    uint64
+	name    string
+	lines   []breakpadLine
+	inlines []*breakpadInline
+}
+
+type breakpadPublic struct {
+	addr uint64
+	name string
+}
+
+// BreakpadFile is a symbol source backed by a Breakpad text symbol file (.sym),
+// the addresses in a .sym file are relative to the image load address
+type BreakpadFile struct {
+	os            string
+	arch          Arch
+	id            string
+	name          string
+	loadSlide     uint64
+	files         map[int]string
+	inlineOrigins map[int]string
+	funcs         []*breakpadSymFunc
+	publics       []breakpadPublic
+}
+
+func OpenBreakpad(file string) (*BreakpadFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %v", file, err)
+	}
+	defer f.Close()
+	bf, err := ParseBreakpad(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse Breakpad symbol file [%s]: %w", file, err)
+	}
+	return bf, nil
+}
+
+func ParseBreakpad(r io.Reader) (*BreakpadFile, error) {
+	bf := &BreakpadFile{
+		files:         make(map[int]string),
+		inlineOrigins: make(map[int]string),
+	}
+
+	var (
+		curFunc *breakpadSymFunc
+		lineNum int
+	)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		record, rest, _ := strings.Cut(line, " ")
+
+		var err error
+		switch record {
+		case "MODULE":
+			fields := strings.SplitN(rest, " ", 4)
+			if len(fields) != 4 {
+				err = fmt.Errorf("malformed MODULE record")
+				break
+			}
+			bf.os, bf.id, bf.name = fields[0], fields[2], fields[3]
+			bf.arch, _ = ParseArch(fields[1]) // an unknown arch doesn't stop the lookups
+		case "FILE", "INLINE_ORIGIN":
+			idx, name, _ := strings.Cut(rest, " ")
+			var n int
+			if n, err = strconv.Atoi(idx); err != nil {
+				break
+			}
+			if record == "FILE" {
+				bf.files[n] = name
+			} else {
+				bf.inlineOrigins[n] = name
+			}
+		case "FUNC":
+			curFunc, err = parseBreakpadFunc(rest)
+			if err == nil {
+				bf.funcs = append(bf.funcs, curFunc)
+			}
+		case "PUBLIC":
+			curFunc = nil
+			var p breakpadPublic
+			if p, err = parseBreakpadPublic(rest); err == nil {
+				bf.publics = append(bf.publics, p)
+			}
+		case "INLINE":
+			if curFunc == nil {
+				err = fmt.Errorf("INLINE record without a FUNC")
+				break
+			}
+			var inline *breakpadInline
+			if inline, err = parseBreakpadInline(rest); err == nil {
+				curFunc.inlines = append(curFunc.inlines, inline)
+			}
+		case "STACK", "INFO":
+			curFunc = nil
+		default:
+			if curFunc == nil {
+				err = fmt.Errorf("unknown record %q", record)
+				break
+			}
+			var l breakpadLine
+			if l, err = parseBreakpadLine(line); err == nil {
+				curFunc.lines = append(curFunc.lines, l)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid record at line %d: %w", lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read Breakpad symbol file: %w", err)
+	}
+	if bf.id == "" {
+		return nil, fmt.Errorf("no MODULE record found")
+	}
+
+	sort.SliceStable(bf.funcs, func(i, j int) bool {
+		return bf.funcs[i].addr < bf.funcs[j].addr
+	})
+	for _, fn := range bf.funcs {
+		sort.SliceStable(fn.lines, func(i, j int) bool {
+			return fn.lines[i].addr < fn.lines[j].addr
+		})
+	}
+	sort.SliceStable(bf.publics, func(i, j int) bool {
+		return bf.publics[i].addr < bf.publics[j].addr
+	})
+	return bf, nil
+}
+
+// trimMultiple drops the optional "m" marker of FUNC and PUBLIC records,
+// which says the address is shared by multiple symbols
+func trimMultiple(s string) string {
+	if strings.HasPrefix(s, "m ") {
+		return s[2:]
+	}
+	return s
+}
+
+func parseBreakpadFunc(s string) (*breakpadSymFunc, error) {
+	fields := strings.SplitN(trimMultiple(s), " ", 4)
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("malformed FUNC record")
+	}
+	addr, err := strconv.ParseUint(fields[0], 16, 64)
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &breakpadSymFunc{addr: addr, size: size, name: fields[3]}, nil
+}
+
+func parseBreakpadPublic(s string) (breakpadPublic, error) {
+	fields := strings.SplitN(trimMultiple(s), " ", 3)
+	if len(fields) != 3 {
+		return breakpadPublic{}, fmt.Errorf("malformed PUBLIC record")
+	}
+	addr, err := strconv.ParseUint(fields[0], 16, 64)
+	if err != nil {
+		return breakpadPublic{}, err
+	}
+	return breakpadPublic{addr: addr, name: fields[2]}, nil
+}
+
+func parseBreakpadLine(s string) (breakpadLine, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 4 {
+		return breakpadLine{}, fmt.Errorf("malformed line record")
+	}
+	addr, err := strconv.ParseUint(fields[0], 16, 64)
+	if err != nil {
+		return breakpadLine{}, err
+	}
+	size, err := strconv.ParseUint(fields[1], 16, 64)
+	if err != nil {
+		return breakpadLine{}, err
+	}
+	line, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return breakpadLine{}, err
+	}
+	file, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return breakpadLine{}, err
+	}
+	return breakpadLine{addr: addr, size: size, line: line, file: file}, nil
+}
+
+// parseBreakpadInline parses "INLINE <depth> <call line> [<call file>] <origin> [<addr> <size>]+",
+// the older format without the call site file is told apart by the number of fields
+func parseBreakpadInline(s string) (*breakpadInline, error) {
+	fields := strings.Fields(s)
+	if len(fields) < 5 {
+		return nil, fmt.Errorf("malformed INLINE record")
+	}
+	ids := fields[:3]
+	if len(fields)%2 == 0 {
+		ids = fields[:4]
+	}
+	nums := make([]int, len(ids))
+	for i, field := range ids {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			return nil, err
+		}
+		nums[i] = n
+	}
+
+	inline := &breakpadInline{depth: nums[0], callLine: nums[1], callFile: -1, origin: nums[len(nums)-1]}
+	if len(nums) == 4 {
+		inline.callFile = nums[2]
+	}
+	for i := len(ids); i+1 < len(fields); i += 2 {
+		addr, err := strconv.ParseUint(fields[i], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.ParseUint(fields[i+1], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		inline.ranges = append(inline.ranges, [2]uint64{addr, addr + size})
+	}
+	return inline, nil
+}
+
+// ImageName returns the module name in the MODULE record
+func (f *BreakpadFile) ImageName() string {
+	return f.name
+}
+
+// ID returns the Breakpad debug identifier, which is the UUID followed by an age
+func (f *BreakpadFile) ID() string {
+	return f.id
+}
+
+// UUID returns the image UUID decoded from the Breakpad debug identifier
+func (f *BreakpadFile) UUID() ([16]byte, bool) {
+	var uuid [16]byte
+	if len(f.id) < 32 {
+		return uuid, false
+	}
+	if _, err := hex.Decode(uuid[:], []byte(f.id[:32])); err != nil {
+		return uuid, false
+	}
+	return uuid, true
+}
+
+func (f *BreakpadFile) Arch() Arch {
+	return f.arch
+}
+
+// VMAddr always returns 0, the Breakpad addresses are relative to the image base
+func (f *BreakpadFile) VMAddr() uint64 {
+	return 0
+}
+
+func (f *BreakpadFile) SetLoadAddress(lAddr uint64) {
+	f.loadSlide = lAddr
+}
+
+func (f *BreakpadFile) LoadAddress() uint64 {
+	return f.loadSlide
+}
+
+func (f *BreakpadFile) SetLoadSlide(loadSlide uint64) {
+	f.loadSlide = loadSlide
+}
+
+func (f *BreakpadFile) LoadSlide() uint64 {
+	return f.loadSlide
+}
+
+func (f *BreakpadFile) Close() error {
+	return nil
+}
+
+func (f *BreakpadFile) findFunc(addr uint64) *breakpadSymFunc {
+	idx := sort.Search(len(f.funcs), func(i int) bool {
+		return f.funcs[i].addr > addr
+	}) - 1
+	if idx >= 0 && addr < f.funcs[idx].addr+f.funcs[idx].size {
+		return f.funcs[idx]
+	}
+	return nil
+}
+
+func (f *BreakpadFile) lineEntry(fn *breakpadSymFunc, addr uint64) *dwarf.LineEntry {
+	idx := sort.Search(len(fn.lines), func(i int) bool {
+		return fn.lines[i].addr > addr
+	}) - 1
+	if idx < 0 || addr >= fn.lines[idx].addr+fn.lines[idx].size {
+		return nil
+	}
+	l := fn.lines[idx]
+	return &dwarf.LineEntry{
+		Address: l.addr,
+		File:    &dwarf.LineFile{Name: f.files[l.file]},
+		Line:    l.line,
+	}
+}
+
+// Atos resolves the function and source line of a PC like MachFile.Atos,
+// Symbol has no source location if the PC is only covered by a PUBLIC record
+func (f *BreakpadFile) Atos(pc uint64) (*Symbol, error) {
+	addr := pc - f.loadSlide
+	if fn := f.findFunc(addr); fn != nil {
+		sym := newSymbol(fn.name, f.lineEntry(fn, addr), "")
+		sym.setFuncRange(fn.addr+f.loadSlide, fn.addr+fn.size+f.loadSlide, pc)
+		return sym, nil
+	}
+
+	idx := sort.Search(len(f.publics), func(i int) bool {
+		return f.publics[i].addr > addr
+	}) - 1
+	if idx < 0 {
+		return nil, fmt.Errorf("no FUNC or PUBLIC record for addr 0x%x", addr)
+	}
+	// a PUBLIC symbol doesn't extend over the next FUNC
+	if next := sort.Search(len(f.funcs), func(i int) bool {
+		return f.funcs[i].addr > f.publics[idx].addr
+	}); next < len(f.funcs) && f.funcs[next].addr <= addr {
+		return nil, fmt.Errorf("no FUNC or PUBLIC record for addr 0x%x", addr)
+	}
+	// the size of a PUBLIC symbol is unknown
+	sym := &Symbol{Func: f.publics[idx].name}
+	sym.setFuncRange(f.publics[idx].addr+f.loadSlide, 0, pc)
+	return sym, nil
+}
+
+// Frames resolves the inlined call chain of a PC from the INLINE records, the innermost
+// inlined function goes first and the last one is the function of the FUNC record
+func (f *BreakpadFile) Frames(pc uint64) ([]*Symbol, error) {
+	addr := pc - f.loadSlide
+	fn := f.findFunc(addr)
+	if fn == nil {
+		sym, err := f.Atos(pc)
+		if err != nil {
+			return nil, err
+		}
+		return []*Symbol{sym}, nil
+	}
+
+	var chain []*breakpadInline
+	for found := true; found; {
+		found = false
+		for _, inline := range fn.inlines {
+			if inline.depth == len(chain) && inline.contains(addr) {
+				chain = append(chain, inline)
+				found = true
+				break
+			}
+		}
+	}
+
+	frames := make([]*Symbol, 0, len(chain)+1)
+	line := f.lineEntry(fn, addr)
+	for i := len(chain) - 1; i >= 0; i-- {
+		sym := newSymbol(f.inlineOrigins[chain[i].origin], line, "")
+		low, high := rangesBounds(chain[i].ranges)
+		sym.setFuncRange(low+f.loadSlide, high+f.loadSlide, pc)
+		frames = append(frames, sym)
+		// the outer frame stops at the call site of the inlined function
+		callSite := &dwarf.LineEntry{Address: addr, Line: chain[i].callLine}
+		if name, ok := f.files[chain[i].callFile]; ok {
+			callSite.File = &dwarf.LineFile{Name: name}
+		} else if line != nil {
+			callSite.File = line.File // the older format has no call site file
+		}
+		line = callSite
+	}
+	sym := newSymbol(fn.name, line, "")
+	sym.setFuncRange(fn.addr+f.loadSlide, fn.addr+fn.size+f.loadSlide, pc)
+	return append(frames, sym), nil
+}
@@ -0,0 +1,111 @@
+package atos
+
+import (
+	"strings"
+	"testing"
+)
+
+const testBreakpadSym = `MODULE mac arm64 6D5A41E144743744BFF4785083F1020E0 a.out
+FILE 0 /Users/zy/segment.c
+FILE 1 /Users/zy/util.h
+INLINE_ORIGIN 0 add
+FUNC 3ee4 78 0 fib
+3ee4 10 3 0
+3ef4 c 5 0
+3f00 10 2 1
+3f10 4c 8 0
+INLINE 0 5 0 0 3f00 10
+FUNC m 3f5c 4c 0 main
+3f5c 1c 15 0
+PUBLIC 3fa8 0 helper
+STACK CFI INIT 3ee4 78 .cfa: sp 0 + .ra: x30
+`
+
+func TestBreakpadFile(t *testing.T) {
+	bf, err := ParseBreakpad(strings.NewReader(testBreakpadSym))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bf.ImageName() != "a.out" {
+		t.Fatalf("wrong module name: %s", bf.ImageName())
+	}
+	if arch := bf.Arch(); arch != ArchARM64 {
+		t.Fatalf("wrong arch: %v", arch)
+	}
+	if uuid, ok := bf.UUID(); !ok || uuid[0] != 0x6d || uuid[15] != 0x0e {
+		t.Fatalf("wrong UUID: %x", uuid)
+	}
+
+	bf.SetLoadAddress(0x104480000)
+
+	symbol, err := bf.Atos(0x104480000 + 0x3ef8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "fib" || symbol.Line != 5 || symbol.File != "/Users/zy/segment.c" {
+		t.Fatalf("unexpected symbol: %+v", symbol)
+	}
+	if symbol.FuncStart != 0x104483ee4 || symbol.FuncEnd != 0x104483f5c || symbol.FuncOffset != 0x14 {
+		t.Fatalf("unexpected function bounds: 0x%x-0x%x + 0x%x", symbol.FuncStart, symbol.FuncEnd, symbol.FuncOffset)
+	}
+
+	frames, err := bf.Frames(0x104480000 + 0x3f04)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expect 2 frames, got %d", len(frames))
+	}
+	if frames[0].Func != "add" || frames[0].Line != 2 || frames[0].File != "/Users/zy/util.h" {
+		t.Fatalf("unexpected inlined frame: %+v", frames[0])
+	}
+	if frames[1].Func != "fib" || frames[1].Line != 5 || frames[1].File != "/Users/zy/segment.c" {
+		t.Fatalf("unexpected outer frame: %+v", frames[1])
+	}
+
+	symbol, err = bf.Atos(0x104480000 + 0x3fb0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "helper" || symbol.HasLine() {
+		t.Fatalf("unexpected PUBLIC symbol: %+v", symbol)
+	}
+
+	if _, err = bf.Atos(0x104480000 + 0x3000); err == nil {
+		t.Fatal("expect an error for an address before any symbol")
+	}
+}
+
+func TestBreakpadRoundTrip(t *testing.T) {
+	mf, err := OpenMachO("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+
+	var sb strings.Builder
+	if err = mf.WriteBreakpadSymbols(&sb, "a.out"); err != nil {
+		t.Fatal(err)
+	}
+	bf, err := ParseBreakpad(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mf.SetLoadAddress(0x104480000)
+	bf.SetLoadAddress(0x104480000)
+	for _, pc := range []uint64{0x104483ee4, 0x104483f10, 0x104483f9c} {
+		want, err := mf.Atos(pc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := bf.Atos(pc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Func != want.Func || got.Line != want.Line || got.File != want.File {
+			t.Errorf("PC 0x%x: got %s %s:%d, want %s %s:%d", pc, got.Func, got.File, got.Line,
+				want.Func, want.File, want.Line)
+		}
+	}
+}
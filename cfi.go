@@ -0,0 +1,583 @@
+package atos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// DWARF call frame instructions, see DWARF 5 section 6.4.2
+const (
+	dwCFAAdvanceLoc  = 0x40
+	dwCFAOffset      = 0x80
+	dwCFARestore     = 0xc0
+	dwCFANop         = 0x00
+	dwCFASetLoc      = 0x01
+	dwCFAAdvanceLoc1 = 0x02
+	dwCFAAdvanceLoc2 = 0x03
+	dwCFAAdvanceLoc4 = 0x04
+
+	dwCFAOffsetExtended     = 0x05
+	dwCFARestoreExtended    = 0x06
+	dwCFAUndefined          = 0x07
+	dwCFASameValue          = 0x08
+	dwCFARegister           = 0x09
+	dwCFARememberState      = 0x0a
+	dwCFARestoreState       = 0x0b
+	dwCFADefCFA             = 0x0c
+	dwCFADefCFARegister     = 0x0d
+	dwCFADefCFAOffset       = 0x0e
+	dwCFADefCFAExpression   = 0x0f
+	dwCFAExpression         = 0x10
+	dwCFAOffsetExtendedSf   = 0x11
+	dwCFADefCFASf           = 0x12
+	dwCFADefCFAOffsetSf     = 0x13
+	dwCFAValOffset          = 0x14
+	dwCFAValOffsetSf        = 0x15
+	dwCFAValExpression      = 0x16
+	dwCFAAArch64NegateRA    = 0x2d // also DW_CFA_GNU_window_save
+	dwCFAGNUArgsSize        = 0x2e
+	dwCFAGNUNegOffsetExtend = 0x2f
+)
+
+// DWARF exception header pointer encodings, see LSB 10.5.1
+const (
+	dwEHPEAbsPtr  = 0x00
+	dwEHPEULEB128 = 0x01
+	dwEHPEUData2  = 0x02
+	dwEHPEUData4  = 0x03
+	dwEHPEUData8  = 0x04
+	dwEHPESLEB128 = 0x09
+	dwEHPESData2  = 0x0a
+	dwEHPESData4  = 0x0b
+	dwEHPESData8  = 0x0c
+
+	dwEHPEPCRel = 0x10
+	dwEHPEOmit  = 0xff
+)
+
+type cfiRuleKind uint8
+
+const (
+	cfiRuleUndefined  cfiRuleKind = iota
+	cfiRuleSameValue              // the register keeps its value
+	cfiRuleOffset                 // the register is saved at CFA+Offset
+	cfiRuleValOffset              // the register value is CFA+Offset
+	cfiRuleRegister               // the register is saved in register Reg, or the CFA is Reg+Offset
+	cfiRuleExpression             // a DWARF expression we can't translate
+)
+
+type cfiRule struct {
+	Kind   cfiRuleKind
+	Reg    uint64
+	Offset int64
+}
+
+// cfiRow is one row of the unwind table, the rules apply from Addr until the next row
+type cfiRow struct {
+	Addr uint64
+	CFA  cfiRule
+	Regs map[uint64]cfiRule
+}
+
+func (r *cfiRow) clone() cfiRow {
+	regs := make(map[uint64]cfiRule, len(r.Regs))
+	for reg, rule := range r.Regs {
+		regs[reg] = rule
+	}
+	return cfiRow{Addr: r.Addr, CFA: r.CFA, Regs: regs}
+}
+
+type cieEntry struct {
+	codeAlign    uint64
+	dataAlign    int64
+	raReg        uint64
+	fdeEncoding  byte
+	augmentation string
+	instructions []byte
+}
+
+type fdeEntry struct {
+	parser       *ehFrameParser
+	cie          *cieEntry
+	PCBegin      uint64
+	PCEnd        uint64
+	instructions []byte
+}
+
+type ehFrameParser struct {
+	data     []byte
+	secAddr  uint64 // the vmaddr of __eh_frame, used by pc relative pointers
+	order    binary.ByteOrder
+	ptrSize  int
+	cieCache map[int]*cieEntry
+}
+
+// parseEHFrame parses all the FDEs in an __eh_frame section
+func parseEHFrame(data []byte, secAddr uint64, order binary.ByteOrder, ptrSize int) ([]*fdeEntry, error) {
+	p := &ehFrameParser{
+		data:     data,
+		secAddr:  secAddr,
+		order:    order,
+		ptrSize:  ptrSize,
+		cieCache: make(map[int]*cieEntry),
+	}
+
+	var fdes []*fdeEntry
+	br := newBytesReader(data)
+	for br.Len() > 0 {
+		start := br.Offset()
+		length, is64, err := p.readLength(br)
+		if err != nil {
+			return fdes, err
+		}
+		if length == 0 {
+			break // zero terminator
+		}
+		end := br.Offset() + int(length)
+		if end > len(data) || end < br.Offset() {
+			return fdes, fmt.Errorf("eh_frame entry at 0x%x exceeds the section bounds", start)
+		}
+
+		idPos := br.Offset()
+		var id uint64
+		if is64 {
+			id, err = br.Uint64(order)
+		} else {
+			var id32 uint32
+			id32, err = br.Uint32(order)
+			id = uint64(id32)
+		}
+		if err != nil {
+			return fdes, err
+		}
+
+		if id != 0 {
+			cie, err := p.cieAt(idPos - int(id))
+			if err != nil {
+				return fdes, fmt.Errorf("unable to parse CIE of FDE at 0x%x: %w", start, err)
+			}
+			fde, err := p.parseFDE(newBytesReader(data[:end]), br.Offset(), cie)
+			if err != nil {
+				return fdes, fmt.Errorf("unable to parse FDE at 0x%x: %w", start, err)
+			}
+			fdes = append(fdes, fde)
+		}
+
+		if _, err = br.Seek(int64(end), io.SeekStart); err != nil {
+			return fdes, err
+		}
+	}
+	return fdes, nil
+}
+
+func (p *ehFrameParser) readLength(br *bytesReader) (uint64, bool, error) {
+	length, err := br.Uint32(p.order)
+	if err != nil {
+		return 0, false, err
+	}
+	if length == 0xffffffff {
+		length64, err := br.Uint64(p.order)
+		return length64, true, err
+	}
+	return uint64(length), false, nil
+}
+
+func (p *ehFrameParser) cieAt(offset int) (*cieEntry, error) {
+	if cie, ok := p.cieCache[offset]; ok {
+		return cie, nil
+	}
+	if offset < 0 || offset >= len(p.data) {
+		return nil, fmt.Errorf("CIE offset 0x%x out of range", offset)
+	}
+	br := newBytesReader(p.data)
+	if _, err := br.Seek(int64(offset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	length, is64, err := p.readLength(br)
+	if err != nil {
+		return nil, err
+	}
+	bodyStart := br.Offset()
+	end := bodyStart + int(length)
+	if end > len(p.data) || end < bodyStart {
+		return nil, fmt.Errorf("CIE at 0x%x exceeds the section bounds", offset)
+	}
+	idSize := 4
+	if is64 {
+		idSize = 8
+	}
+	br = newBytesReader(p.data[:end])
+	if _, err = br.Seek(int64(bodyStart+idSize), io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	version, err := br.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if version != 1 && version != 3 {
+		return nil, fmt.Errorf("unsupported CIE version %d", version)
+	}
+	cie := &cieEntry{fdeEncoding: dwEHPEAbsPtr}
+	if cie.augmentation, err = br.ReadCString(); err != nil {
+		return nil, err
+	}
+	if cie.codeAlign, err = br.ReadULEB128(); err != nil {
+		return nil, err
+	}
+	if cie.dataAlign, err = br.ReadSLEB128(); err != nil {
+		return nil, err
+	}
+	if version == 1 {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		cie.raReg = uint64(b)
+	} else if cie.raReg, err = br.ReadULEB128(); err != nil {
+		return nil, err
+	}
+
+	if len(cie.augmentation) > 0 && cie.augmentation[0] == 'z' {
+		augLen, err := br.ReadULEB128()
+		if err != nil {
+			return nil, err
+		}
+		augEnd := br.Offset() + int(augLen)
+		for _, c := range cie.augmentation[1:] {
+			switch c {
+			case 'R':
+				if cie.fdeEncoding, err = br.ReadByte(); err != nil {
+					return nil, err
+				}
+			case 'L':
+				if _, err = br.ReadByte(); err != nil {
+					return nil, err
+				}
+			case 'P':
+				enc, err := br.ReadByte()
+				if err != nil {
+					return nil, err
+				}
+				if _, err = p.readPointer(br, enc); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if _, err = br.Seek(int64(augEnd), io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	cie.instructions = p.data[br.Offset():end]
+	p.cieCache[offset] = cie
+	return cie, nil
+}
+
+func (p *ehFrameParser) parseFDE(br *bytesReader, offset int, cie *cieEntry) (*fdeEntry, error) {
+	if _, err := br.Seek(int64(offset), io.SeekStart); err != nil {
+		return nil, err
+	}
+	pcBegin, err := p.readPointer(br, cie.fdeEncoding)
+	if err != nil {
+		return nil, err
+	}
+	pcRange, err := p.readPointer(br, cie.fdeEncoding&0x0f) // the range is never relative
+	if err != nil {
+		return nil, err
+	}
+	if len(cie.augmentation) > 0 && cie.augmentation[0] == 'z' {
+		augLen, err := br.ReadULEB128()
+		if err != nil {
+			return nil, err
+		}
+		if _, err = br.Skip(int(augLen)); err != nil {
+			return nil, err
+		}
+	}
+	return &fdeEntry{
+		parser:       p,
+		cie:          cie,
+		PCBegin:      pcBegin,
+		PCEnd:        pcBegin + pcRange,
+		instructions: br.data[br.Offset():],
+	}, nil
+}
+
+func (p *ehFrameParser) readPointer(br *bytesReader, enc byte) (uint64, error) {
+	if enc == dwEHPEOmit {
+		return 0, nil
+	}
+	pos := p.secAddr + uint64(br.Offset())
+
+	var (
+		val uint64
+		err error
+	)
+	switch enc & 0x0f {
+	case dwEHPEAbsPtr:
+		if p.ptrSize == 8 {
+			val, err = br.Uint64(p.order)
+		} else {
+			var v uint32
+			v, err = br.Uint32(p.order)
+			val = uint64(v)
+		}
+	case dwEHPEULEB128:
+		val, err = br.ReadULEB128()
+	case dwEHPEUData2:
+		var v uint16
+		v, err = br.Uint16(p.order)
+		val = uint64(v)
+	case dwEHPEUData4:
+		var v uint32
+		v, err = br.Uint32(p.order)
+		val = uint64(v)
+	case dwEHPEUData8:
+		val, err = br.Uint64(p.order)
+	case dwEHPESLEB128:
+		var v int64
+		v, err = br.ReadSLEB128()
+		val = uint64(v)
+	case dwEHPESData2:
+		var v uint16
+		v, err = br.Uint16(p.order)
+		val = uint64(int16(v))
+	case dwEHPESData4:
+		var v uint32
+		v, err = br.Uint32(p.order)
+		val = uint64(int32(v))
+	case dwEHPESData8:
+		val, err = br.Uint64(p.order)
+	default:
+		return 0, fmt.Errorf("unsupported pointer encoding 0x%x", enc)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch enc & 0x70 {
+	case 0:
+	case dwEHPEPCRel:
+		val += pos
+	default:
+		return 0, fmt.Errorf("unsupported pointer application 0x%x", enc&0x70)
+	}
+	// DW_EH_PE_indirect pointers point to the GOT, only personality routines use them, leave them as is
+	return val, nil
+}
+
+// rows executes the CIE and FDE call frame instructions and returns the resulting unwind table
+func (fde *fdeEntry) rows() ([]cfiRow, error) {
+	p := fde.parser
+	row := cfiRow{Addr: fde.PCBegin, Regs: make(map[uint64]cfiRule)}
+	if err := p.execute(fde, fde.cie.instructions, &row, nil, nil); err != nil {
+		return nil, err
+	}
+	initial := row.clone()
+	var rows []cfiRow
+	if err := p.execute(fde, fde.instructions, &row, &initial, &rows); err != nil {
+		return nil, err
+	}
+	return append(rows, row), nil
+}
+
+func (p *ehFrameParser) execute(fde *fdeEntry, instructions []byte, row *cfiRow, initial *cfiRow, rows *[]cfiRow) error {
+	cie := fde.cie
+	br := newBytesReader(instructions)
+	var stack []cfiRow
+
+	advance := func(loc uint64) {
+		if rows != nil && loc != row.Addr {
+			*rows = append(*rows, row.clone())
+		}
+		row.Addr = loc
+	}
+	restore := func(reg uint64) {
+		if initial != nil {
+			if rule, ok := initial.Regs[reg]; ok {
+				row.Regs[reg] = rule
+				return
+			}
+		}
+		delete(row.Regs, reg)
+	}
+
+	for br.Len() > 0 {
+		op, _ := br.ReadByte()
+		switch op & 0xc0 {
+		case dwCFAAdvanceLoc:
+			advance(row.Addr + uint64(op&0x3f)*cie.codeAlign)
+			continue
+		case dwCFAOffset:
+			off, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			row.Regs[uint64(op&0x3f)] = cfiRule{Kind: cfiRuleOffset, Offset: int64(off) * cie.dataAlign}
+			continue
+		case dwCFARestore:
+			restore(uint64(op & 0x3f))
+			continue
+		}
+
+		switch op {
+		case dwCFANop, dwCFAAArch64NegateRA:
+		case dwCFASetLoc:
+			loc, err := p.readPointer(br, cie.fdeEncoding)
+			if err != nil {
+				return err
+			}
+			advance(loc)
+		case dwCFAAdvanceLoc1:
+			delta, err := br.ReadByte()
+			if err != nil {
+				return err
+			}
+			advance(row.Addr + uint64(delta)*cie.codeAlign)
+		case dwCFAAdvanceLoc2:
+			delta, err := br.Uint16(p.order)
+			if err != nil {
+				return err
+			}
+			advance(row.Addr + uint64(delta)*cie.codeAlign)
+		case dwCFAAdvanceLoc4:
+			delta, err := br.Uint32(p.order)
+			if err != nil {
+				return err
+			}
+			advance(row.Addr + uint64(delta)*cie.codeAlign)
+		case dwCFAOffsetExtended, dwCFAValOffset, dwCFAGNUNegOffsetExtend:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			off, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			rule := cfiRule{Kind: cfiRuleOffset, Offset: int64(off) * cie.dataAlign}
+			if op == dwCFAValOffset {
+				rule.Kind = cfiRuleValOffset
+			} else if op == dwCFAGNUNegOffsetExtend {
+				rule.Offset = -rule.Offset
+			}
+			row.Regs[reg] = rule
+		case dwCFAOffsetExtendedSf, dwCFAValOffsetSf:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			off, err := br.ReadSLEB128()
+			if err != nil {
+				return err
+			}
+			rule := cfiRule{Kind: cfiRuleOffset, Offset: off * cie.dataAlign}
+			if op == dwCFAValOffsetSf {
+				rule.Kind = cfiRuleValOffset
+			}
+			row.Regs[reg] = rule
+		case dwCFARestoreExtended, dwCFAUndefined, dwCFASameValue:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			switch op {
+			case dwCFARestoreExtended:
+				restore(reg)
+			case dwCFAUndefined:
+				row.Regs[reg] = cfiRule{Kind: cfiRuleUndefined}
+			default:
+				row.Regs[reg] = cfiRule{Kind: cfiRuleSameValue}
+			}
+		case dwCFARegister:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			reg2, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			row.Regs[reg] = cfiRule{Kind: cfiRuleRegister, Reg: reg2}
+		case dwCFARememberState:
+			stack = append(stack, row.clone())
+		case dwCFARestoreState:
+			if len(stack) == 0 {
+				return fmt.Errorf("DW_CFA_restore_state without a remembered state")
+			}
+			addr := row.Addr
+			*row = stack[len(stack)-1]
+			row.Addr = addr
+			stack = stack[:len(stack)-1]
+		case dwCFADefCFA, dwCFADefCFASf:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			var off int64
+			if op == dwCFADefCFA {
+				uoff, err := br.ReadULEB128()
+				if err != nil {
+					return err
+				}
+				off = int64(uoff)
+			} else {
+				soff, err := br.ReadSLEB128()
+				if err != nil {
+					return err
+				}
+				off = soff * cie.dataAlign
+			}
+			row.CFA = cfiRule{Kind: cfiRuleRegister, Reg: reg, Offset: off}
+		case dwCFADefCFARegister:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			row.CFA.Kind = cfiRuleRegister
+			row.CFA.Reg = reg
+		case dwCFADefCFAOffset:
+			off, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			row.CFA.Offset = int64(off)
+		case dwCFADefCFAOffsetSf:
+			off, err := br.ReadSLEB128()
+			if err != nil {
+				return err
+			}
+			row.CFA.Offset = off * cie.dataAlign
+		case dwCFADefCFAExpression:
+			size, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			if _, err = br.Skip(int(size)); err != nil {
+				return err
+			}
+			row.CFA = cfiRule{Kind: cfiRuleExpression}
+		case dwCFAExpression, dwCFAValExpression:
+			reg, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			size, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			if _, err = br.Skip(int(size)); err != nil {
+				return err
+			}
+			row.Regs[reg] = cfiRule{Kind: cfiRuleExpression}
+		case dwCFAGNUArgsSize:
+			if _, err := br.ReadULEB128(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported call frame instruction 0x%x", op)
+		}
+	}
+	return nil
+}
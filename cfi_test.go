@@ -0,0 +1,85 @@
+package atos
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// buildEHFrame builds a typical arm64 __eh_frame with one CIE and one FDE for a function
+// which pushes x29 and x30 to the stack
+func buildEHFrame(secAddr, funcAddr uint64) []byte {
+	le := binary.LittleEndian
+	cie := []byte{
+		0, 0, 0, 0, // CIE id
+		1,              // version
+		'z', 'R', 0x00, // augmentation
+		0x01,             // code alignment factor
+		0x78,             // data alignment factor: -8
+		0x1e,             // return address register: x30
+		0x01,             // augmentation length
+		0x10,             // FDE pointer encoding: DW_EH_PE_pcrel|DW_EH_PE_absptr
+		0x0c, 0x1f, 0x00, // DW_CFA_def_cfa: sp+0
+	}
+	for len(cie)%4 != 0 {
+		cie = append(cie, dwCFANop)
+	}
+	data := le.AppendUint32(nil, uint32(len(cie)))
+	data = append(data, cie...)
+
+	fdeStart := len(data)
+	fde := le.AppendUint32(nil, uint32(fdeStart+4)) // CIE pointer
+	pcBeginPos := secAddr + uint64(fdeStart+4+len(fde))
+	fde = le.AppendUint64(fde, funcAddr-pcBeginPos)
+	fde = le.AppendUint64(fde, 0x20) // PC range
+	fde = append(fde,
+		0x00,       // augmentation length
+		0x44,       // DW_CFA_advance_loc: 4
+		0x0e, 0x10, // DW_CFA_def_cfa_offset: 16
+		0x9d, 0x02, // DW_CFA_offset: x29 at cfa-16
+		0x9e, 0x01, // DW_CFA_offset: x30 at cfa-8
+	)
+	for len(fde)%4 != 0 {
+		fde = append(fde, dwCFANop)
+	}
+	data = le.AppendUint32(data, uint32(len(fde)))
+	return append(data, fde...)
+}
+
+func TestParseEHFrame(t *testing.T) {
+	const secAddr, funcAddr = 0x100008000, 0x100003f00
+	fdes, err := parseEHFrame(buildEHFrame(secAddr, funcAddr), secAddr, binary.LittleEndian, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fdes) != 1 {
+		t.Fatalf("expect 1 FDE, got %d", len(fdes))
+	}
+	fde := fdes[0]
+	if fde.PCBegin != funcAddr || fde.PCEnd != funcAddr+0x20 {
+		t.Fatalf("wrong FDE range: [0x%x, 0x%x)", fde.PCBegin, fde.PCEnd)
+	}
+
+	rows, err := fde.rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1].Addr != funcAddr+4 {
+		t.Fatalf("unexpected unwind rows: %+v", rows)
+	}
+
+	regNames := breakpadRegisterNames[ArchARM64.Cpu]
+	init, err := breakpadCFIRules(&rows[0], fde.cie.raReg, regNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatCFIRules(init, nil); got != ".cfa: sp 0 +" {
+		t.Fatalf("unexpected initial rules: %q", got)
+	}
+	body, err := breakpadCFIRules(&rows[1], fde.cie.raReg, regNames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatCFIRules(body, init); got != ".cfa: sp 16 + .ra: .cfa -8 + ^ x29: .cfa -16 + ^" {
+		t.Fatalf("unexpected rules: %q", got)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/zhyee/atos-go"
+)
+
+const crashUsageMsg = `Usage: %s crash [-store dir ...] [-deviceSupport dir ...] [-printHeader] [-fullPath] [-column] [-funcOffset] [-inlineFrames] [-stripPointerAuth] [-addressBits n] crash-report`
+
+// crashReport implements "gatos crash" which symbolicates the backtraces of a crash report (.crash) with the
+// symbol files of the store directories and the system libraries of the Xcode device support directories
+func crashReport(args []string) {
+	flagSet = flag.NewFlagSet("crash", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(crashUsageMsg)
+
+	var stores, deviceSupport stringsFlag
+	help := flagSet.Bool("h", false, "show this help")
+	flagSet.Var(&stores, "store", `A directory of the symbol files of the app, e.g. the dSYMs, which are indexed by UUID. Can be repeated`)
+	flagSet.Var(&deviceSupport, "deviceSupport", `An Xcode device support directory, e.g. "~/Library/Developer/Xcode/iOS DeviceSupport", of which the version directories matching the "OS Version" of the report are indexed. Can be repeated`)
+	printHeader := flagSet.Bool("printHeader", false, `Print a header line with the symbol file path, architecture, UUID and load address of each image before the report`)
+	fullPath := flagSet.Bool("fullPath", false, `Print the full path of the source files`)
+	column := flagSet.Bool("column", false, `Print the source column as "file:line:column" if known`)
+	funcOffset := flagSet.Bool("funcOffset", false, `Print the offset of the address from the start of the function, e.g. "main + 20"`)
+	inline := flagSet.Bool("inlineFrames", false, `Display inlined symbols`)
+	stripPAC := flagSet.Bool("stripPointerAuth", false, `Strip the pointer authentication codes of the signed arm64e addresses in the backtraces`)
+	addressBits := flagSet.Uint("addressBits", atos.DefaultVirtualAddressBits, `The virtual address size of the process for -stripPointerAuth`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if flagSet.NArg() != 1 {
+		popErrAndUsage("expect one crash report")
+	}
+	if len(stores) == 0 && len(deviceSupport) == 0 {
+		popErrAndUsage("no symbol store or device support directory specified")
+	}
+
+	store, err := atos.NewSymbolStore(stores...)
+	if err != nil {
+		popErr("%v", err)
+	}
+	for _, dir := range deviceSupport {
+		if err = store.AddDeviceSupport(dir); err != nil {
+			popErr("%v", err)
+		}
+	}
+	f, err := os.Open(flagSet.Arg(0))
+	if err != nil {
+		popErr("unable to open the crash report: %v", err)
+	}
+	report, err := atos.ParseCrashReport(f)
+	_ = f.Close()
+	if err != nil {
+		popErr("unable to parse the crash report: %v", err)
+	}
+
+	// the frame lines are replaced with the symbols, the inlined frames are inserted after them
+	opts := formatOptions{fullPath: *fullPath, column: *column, funcOffset: *funcOffset}
+	lines := make(map[int][]string)
+	var headers []string
+	backtraces := report.Symbolicate(store, atos.BacktraceOptions{
+		InlineFrames:       *inline,
+		CallerFrames:       true,
+		StripPointerAuth:   *stripPAC,
+		VirtualAddressBits: *addressBits,
+		ImageOpened: func(sym atos.Symbolizer, path string) {
+			headers = append(headers, formatHeader(sym, path))
+		},
+	})
+	if *printHeader {
+		for _, header := range headers {
+			printf("%s\n", header)
+		}
+	}
+	for i, frames := range backtraces {
+		for j, frame := range frames {
+			cf := report.Backtraces[i].Frames[j]
+			if frame.Err != nil {
+				atos.Log.Debugf("unable to symbolicate PC [0x%x] of [%s]: %v", frame.PC, cf.Image, frame.Err)
+				continue
+			}
+			var symbolicated []string
+			for k, symbol := range frame.Symbols {
+				prefix := cf.Prefix
+				if k > 0 {
+					prefix = strings.Repeat(" ", len(cf.Prefix))
+				}
+				symbolicated = append(symbolicated, prefix+formatSymbol(symbol, cf.Image, opts))
+			}
+			lines[cf.Line] = symbolicated
+		}
+	}
+	for i, line := range report.Lines {
+		if symbolicated, ok := lines[i]; ok {
+			for _, s := range symbolicated {
+				printf("%s\n", s)
+			}
+			continue
+		}
+		printf("%s\n", line)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zhyee/atos-go"
+)
+
+const dumpSymsUsageMsg = `Usage: %s dump-syms -o executable/dSYM [-arch architecture] [-name moduleName]`
+
+// dumpSyms implements "gatos dump-syms" which converts a binary or dSYM to a Breakpad .sym file
+func dumpSyms(args []string) {
+	flagSet = flag.NewFlagSet("dump-syms", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(dumpSymsUsageMsg)
+
+	help := flagSet.Bool("h", false, "show this help")
+	bin := flagSet.String("o", "", `The path to a binary image file or dSYM to dump`)
+	arch := flagSet.String("arch", "arm64", `The particular architecture of a binary image file to dump`)
+	name := flagSet.String("name", "", `The module name in the MODULE record, defaults to the binary file name`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if *bin == "" {
+		popErrAndUsage("no executable or dSYM file specified")
+	}
+
+	ac, err := atos.ParseArch(*arch)
+	if err != nil {
+		popErr("Unknown architecture [%s]", *arch)
+	}
+	mf, err := atos.OpenMachO(*bin, ac)
+	if err != nil {
+		popErr("unable to open the executable or dSYM file: %v", err)
+	}
+	defer mf.Close()
+
+	moduleName := *name
+	if moduleName == "" {
+		moduleName = strings.TrimSuffix(filepath.Base(*bin), ".dSYM")
+	}
+	if err = mf.WriteBreakpadSymbols(os.Stdout, moduleName); err != nil {
+		popErr("unable to dump Breakpad symbols: %v", err)
+	}
+}
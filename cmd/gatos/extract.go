@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path"
+
+	"github.com/zhyee/atos-go"
+)
+
+const extractUsageMsg = `Usage: %s extract-dylib -o dyld_shared_cache [-dylib installPath | UUID] [-out file] [-list]`
+
+// extractDylib implements "gatos extract-dylib" which rebuilds a dylib of a dyld shared cache as a standalone Mach-O file
+func extractDylib(args []string) {
+	flagSet = flag.NewFlagSet("extract-dylib", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(extractUsageMsg)
+
+	help := flagSet.Bool("h", false, "show this help")
+	cache := flagSet.String("o", "", `The path to a dyld shared cache, e.g. dyld_shared_cache_arm64e, the subcaches and the .symbols file are opened from the same directory`)
+	dylib := flagSet.String("dylib", "", `The install path of the dylib to extract, e.g. "/usr/lib/libobjc.A.dylib", or its file name or UUID`)
+	out := flagSet.String("out", "", `The output file, defaults to the file name of the dylib in the current directory`)
+	list := flagSet.Bool("list", false, `List the UUIDs, addresses and install paths of the dylibs in the cache instead`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if *cache == "" {
+		popErrAndUsage("no dyld shared cache specified")
+	}
+
+	c, err := atos.OpenDyldCache(*cache)
+	if err != nil {
+		popErr("%v", err)
+	}
+	defer c.Close()
+
+	if *list {
+		for _, image := range c.Images() {
+			printf("%s 0x%x %s\n", atos.FormatUUID(image.UUID), image.Address, image.Path)
+		}
+		return
+	}
+	if *dylib == "" {
+		popErrAndUsage("no dylib specified")
+	}
+	image, ok := c.Image(*dylib)
+	if !ok {
+		popErr("no dylib [%s] in the dyld shared cache", *dylib)
+	}
+	if *out == "" {
+		*out = path.Base(image.Path)
+	}
+	if err = c.ExtractImageFile(image.Path, *out); err != nil {
+		popErr("unable to extract [%s]: %v", image.Path, err)
+	}
+}
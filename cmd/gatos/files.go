@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/zhyee/atos-go"
+)
+
+const filesUsageMsg = `Usage: %s files -o executable/dSYM [-arch architecture] [-format text|json]`
+
+// unitRecord is a compile unit of the JSON output of "gatos files"
+type unitRecord struct {
+	Name     string       `json:"name"`
+	CompDir  string       `json:"comp_dir,omitempty"`
+	Producer string       `json:"producer,omitempty"`
+	Language int64        `json:"language,omitempty"`
+	Files    []fileRecord `json:"files"`
+}
+
+type fileRecord struct {
+	Path  string `json:"path"`
+	Lines []int  `json:"lines"`
+}
+
+// files implements "gatos files" which lists the compile units with their compilation dirs, producers,
+// source files and the lines having code of each file
+func files(args []string) {
+	flagSet = flag.NewFlagSet("files", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(filesUsageMsg)
+
+	help := flagSet.Bool("h", false, "show this help")
+	bin := flagSet.String("o", "", `The path to a binary image file or dSYM whose compile units are listed`)
+	arch := flagSet.String("arch", "arm64", `The particular architecture of a binary image file whose compile units are listed`)
+	format := flagSet.String("format", "text", `The output format, "text" or "json". The JSON output is an array of the compile units with the name, comp_dir, producer, language and the files with their path and lines`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if *bin == "" {
+		popErrAndUsage("no executable or dSYM file specified")
+	}
+	if *format != "text" && *format != "json" {
+		popErrAndUsage(`unknown output format [%s], expect one of text, json`, *format)
+	}
+
+	ac, err := atos.ParseArch(*arch)
+	if err != nil {
+		popErr("Unknown architecture [%s]", *arch)
+	}
+	sym, err := atos.Open(*bin, ac)
+	if err != nil {
+		popErr("unable to open the executable or dSYM file: %v", err)
+	}
+	defer sym.Close()
+
+	ds, ok := sym.(atos.DWARFSymbolizer)
+	if !ok {
+		popErr("source files are not supported by %s", sym.ImageName())
+	}
+	units, err := ds.CompileUnits()
+	if err != nil {
+		popErr("unable to list the compile units: %v", err)
+	}
+
+	if *format == "json" {
+		records := make([]unitRecord, 0, len(units))
+		for _, unit := range units {
+			record := unitRecord{Name: unit.Name, CompDir: unit.CompDir, Producer: unit.Producer, Language: unit.Language, Files: []fileRecord{}}
+			for _, file := range unit.Files {
+				lines := file.Lines
+				if lines == nil {
+					lines = []int{}
+				}
+				record.Files = append(record.Files, fileRecord{Path: file.Path, Lines: lines})
+			}
+			records = append(records, record)
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(records); err != nil {
+			popErr("unable to write the output: %v", err)
+		}
+		return
+	}
+
+	for _, unit := range units {
+		printf("%s\n", unit.Name)
+		if unit.CompDir != "" {
+			printf("    comp dir: %s\n", unit.CompDir)
+		}
+		if unit.Producer != "" {
+			printf("    producer: %s\n", unit.Producer)
+		}
+		for _, file := range unit.Files {
+			if len(file.Lines) == 0 {
+				printf("    %s\n", file.Path)
+				continue
+			}
+			printf("    %s: %s\n", file.Path, formatLineRanges(file.Lines))
+		}
+	}
+}
+
+// formatLineRanges compacts the sorted lines into ranges, e.g. "3, 5, 14-18"
+func formatLineRanges(lines []int) string {
+	var ranges []string
+	for i := 0; i < len(lines); {
+		j := i
+		for j+1 < len(lines) && lines[j+1] == lines[j]+1 {
+			j++
+		}
+		if j == i {
+			ranges = append(ranges, strconv.Itoa(lines[i]))
+		} else {
+			ranges = append(ranges, strconv.Itoa(lines[i])+"-"+strconv.Itoa(lines[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ", ")
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/zhyee/atos-go"
+)
+
+const lookupUsageMsg = `Usage: %s lookup -o executable/dSYM [-arch architecture] [-l loadAddress | -s slide] [-fullPath] <function | file:line> ...`
+
+// lookup implements "gatos lookup" which resolves function names or source lines to address ranges
+func lookup(args []string) {
+	flagSet = flag.NewFlagSet("lookup", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(lookupUsageMsg)
+
+	help := flagSet.Bool("h", false, "show this help")
+	bin := flagSet.String("o", "", `The path to a binary image file or dSYM in which to look up addresses`)
+	arch := flagSet.String("arch", "arm64", `The particular architecture of a binary image file in which to look up addresses`)
+	loadAddr := flagSet.String("l", "", `The load address of the binary image, the addresses are printed relative to it.  This value is always assumed to be in hex, even without a "0x" prefix`)
+	slide := flagSet.String("s", "", `The slide value of the binary image, which is added to the printed addresses.  This value is always assumed to be in hex, even without a "0x" prefix`)
+	fullPath := flagSet.Bool("fullPath", false, `Print the full path of the source files`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if *bin == "" {
+		popErrAndUsage("no executable or dSYM file specified")
+	}
+	if *loadAddr != "" && *slide != "" {
+		popErrAndUsage(`only one of "-s or -l" can be used at a time`)
+	}
+
+	ac, err := atos.ParseArch(*arch)
+	if err != nil {
+		popErr("Unknown architecture [%s]", *arch)
+	}
+	sym, err := atos.Open(*bin, ac)
+	if err != nil {
+		popErr("unable to open the executable or dSYM file: %v", err)
+	}
+	defer sym.Close()
+
+	ds, ok := sym.(atos.DWARFSymbolizer)
+	if !ok {
+		popErr("reverse lookups are not supported by %s", sym.ImageName())
+	}
+	if *loadAddr != "" {
+		lAddr, err := strconv.ParseUint(prependHexSign(*loadAddr), 0, 64)
+		if err != nil {
+			popErrAndUsage("invalid load address: %v", err)
+		}
+		sym.SetLoadAddress(lAddr)
+	}
+	if *slide != "" {
+		loadSlide, err := strconv.ParseUint(prependHexSign(*slide), 0, 64)
+		if err != nil {
+			popErrAndUsage("invalid slide value: %v", err)
+		}
+		sym.SetLoadSlide(loadSlide)
+	}
+
+	for _, query := range flagSet.Args() {
+		var ranges []atos.AddressRange
+		if file, line, ok := atos.ParseLookupQuery(query); ok {
+			ranges, err = ds.LookupLine(file, line)
+		} else {
+			ranges, err = ds.LookupName(query)
+		}
+		if err != nil {
+			atos.Log.Debugf("unable to look up [%s]: %v", query, err)
+		}
+		if len(ranges) == 0 {
+			printf("%s: not found\n", query)
+			continue
+		}
+		for _, rg := range ranges {
+			printf("%s\n", formatAddressRange(rg, sym.ImageName(), *fullPath))
+		}
+	}
+}
+
+// formatAddressRange formats a range like "0x100003ee4-0x100003f5c fib (in a.out) (segment.c:12) [inlined]"
+func formatAddressRange(rg atos.AddressRange, image string, fullPath bool) string {
+	s := fmt.Sprintf("0x%x-0x%x", rg.Low, rg.High)
+	if rg.Func != "" {
+		s += fmt.Sprintf(" %s (in %s)", rg.Func, image)
+	}
+	if rg.File != "" {
+		filename := rg.File
+		if !fullPath {
+			filename = path.Base(filename)
+		}
+		s += fmt.Sprintf(" (%s:%d)", filename, rg.Line)
+	}
+	if rg.Inlined {
+		s += " [inlined]"
+	}
+	return s
+}
@@ -5,8 +5,6 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -15,14 +13,41 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-const usageMsg = `Usage: %s [-o executable/dSYM] [-f file-of-input-addresses] [-s slide | -l loadAddress | -textExecAddress addr | -offset] [-arch architecture] [-printHeader] [-fullPath] [-inlineFrames] [-d delimiter] [address ...]`
+const usageMsg = `Usage: %s [-o executable/dSYM] [-f file-of-input-addresses] [-s slide | -l loadAddress | -textExecAddress addr | -offset] [-kext bundleID | -dylib installPath] [-arch architecture] [-printHeader] [-fullPath] [-column] [-funcOffset] [-lineZero keep|nearest|decl] [-inlineFrames] [-caller-frames] [-stripPointerAuth] [-addressBits n] [-data] [-format text|json|jsonl|csv] [-d delimiter] [address ...]
+       %s <command> [arguments]
+
+Commands:
+       crash          symbolicate a crash report with a symbol store and the system libraries of device support directories
+       dump-syms      generate a Breakpad .sym file from a binary or dSYM
+       extract-dylib  rebuild a dylib of a dyld shared cache as a standalone Mach-O file
+       files          list the compile units with their compilation dirs, producers, source files and the lines having code
+       lookup         look up the addresses of functions or source lines, e.g. "main" or "main.m:18"
+       panic          symbolicate a kernel panic report with the kernel and kext symbols of a symbol store
+       types          dump the layouts of the structs, classes, unions and enums of the names with the offsets of the members
+       vars           list the parameters and the local variables in scope at addresses with their locations and types`
 
 var (
-	usage   = fmt.Sprintf(usageMsg, os.Args[0]) + "\n"
+	usage   = fmt.Sprintf(usageMsg, os.Args[0], os.Args[0]) + "\n"
 	logger  = log.New(os.Stderr, "", 0)
 	flagSet *flag.FlagSet
 )
 
+// subCommands are dispatched by the first argument, e.g. "gatos dump-syms -o App.dSYM"
+var subCommands = map[string]func(args []string){
+	"crash":         crashReport,
+	"dump-syms":     dumpSyms,
+	"extract-dylib": extractDylib,
+	"files":         files,
+	"lookup":        lookup,
+	"panic":         kernelPanic,
+	"types":         types,
+	"vars":          vars,
+}
+
+func subCommandUsage(format string) string {
+	return fmt.Sprintf(format, os.Args[0]) + "\n"
+}
+
 func showUsage() {
 	logger.Println(usage)
 	flagSet.PrintDefaults()
@@ -54,6 +79,13 @@ func prependHexSign(addr string) string {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subCommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+	}
+
 	flagSet = flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	flagSet.SetOutput(logger.Writer())
 
@@ -63,21 +95,28 @@ func main() {
 	bin := flagSet.String("o", "", `The path to a binary image file or dSYM in which to look up symbols`)
 	arch := flagSet.String("arch", "arm64", `The particular architecture of a binary image file in which to look up symbols`)
 	loadAddr := flagSet.String("l", "", `The load address of the binary image.  This value is always assumed to be in hex, even without a "0x" prefix.  The input addresses are assumed to be in a binary image with that load address.  Load addresses for binary images can be found in the Binary Images: section at the bottom of crash, sample, leaks, and malloc_history reports`)
-	textExecAddress := flag.String("textExecAddress", "", `Should be used instead of load address with kernel-space binary images on arm64(e) devices.  This value is always assumed to be in hex, even without a "0x" prefix.
+	textExecAddress := flagSet.String("textExecAddress", "", `Should be used instead of load address with kernel-space binary images on arm64(e) devices.  This value is always assumed to be in hex, even without a "0x" prefix.
              The input addresses are assumed to be in a binary image with that text exec address. In kernel panic report the text exec address can be found in "Kernel text exec base" line, or for kexts in "Kernel Extensions in backtrace:" section. This value is always assumed to be in hex, even without a "0x" prefix`)
+	kext := flagSet.String("kext", "", `The entry id of the image to symbolicate in a kernel collection (MH_FILESET), e.g. a kext bundle id like "com.apple.driver.AppleMobileFileIntegrity". Defaults to the kernel "com.apple.kernel"`)
+	dylib := flagSet.String("dylib", "", `The install path of the image to symbolicate in a dyld shared cache, e.g. "/usr/lib/libobjc.A.dylib", or its file name or UUID. The subcaches and the .symbols file of the local symbols are opened from the same directory`)
 	slide := flagSet.String("s", "", `The slide value of the binary image -- this is the difference between the load address of a binary image, and the address at which the binary image was built.  This slide value is subtracted from the input addresses.  It is usually easier to directly specify the load address with the -l argument than to manually calculate a slide value. This value is always assumed to be in hex, even without a "0x" prefix`)
 	isOffset := flagSet.Bool("offset", false, `Treat all given addresses as offsets into the binary. Only one of the following options can be used at a time: -s , -l , -textExecAddress or -offset`)
 	fullPath := flagSet.Bool("fullPath", false, `Print the full path of the source files`)
-	inline := flagSet.Bool("i", false, `Display inlined symbols, not yet implemented`)
-	inlineLong := flagSet.Bool("inlineFrames", false, `Display inlined symbols, not yet implemented`)
+	column := flagSet.Bool("column", false, `Print the source column as "file:line:column" if known`)
+	lineZero := flagSet.String("lineZero", "keep", `How to resolve the addresses whose line is 0: "keep" prints line 0 like atos, "nearest" takes the nearest preceding line, "decl" takes the declaration line of the function. The guessed lines are marked as [approximate]`)
+	funcOffset := flagSet.Bool("funcOffset", false, `Print the offset of the address within the function as "func + offset"`)
+	inline := flagSet.Bool("i", false, `Display inlined symbols`)
+	inlineLong := flagSet.Bool("inlineFrames", false, `Display inlined symbols`)
+	printHeader := flagSet.Bool("printHeader", false, `Print a header line with the image path, architecture, UUID and load address before the results of the image, only for the text format`)
+	callerFrames := flagSet.Bool("caller-frames", false, `Treat all the addresses except the first one as return addresses of a backtrace, which are adjusted into their call instructions before the lookup`)
+	stripPAC := flagSet.Bool("stripPointerAuth", false, `Strip the pointer authentication codes of the signed arm64e addresses, e.g. the return addresses of a raw backtrace, i.e. the bits above the virtual address size of -addressBits`)
+	addressBits := flagSet.Uint("addressBits", atos.DefaultVirtualAddressBits, `The virtual address size of the process for -stripPointerAuth`)
+	data := flagSet.Bool("data", false, `Resolve the addresses in the data sections, e.g. __DATA,__data, __DATA_CONST,__const or __DATA,__bss, to the containing global or static variable as "variable + offset" with its declared type, only for Mach-O images and the text format`)
+	format := flagSet.String("format", "text", `The output format, one of "text", "json", "jsonl" or "csv". The structured formats have a record for each frame with the address, image, function, demangled name, file, full path, line, column, inline depth and the error of an unresolved address`)
 	delimiter := flagSet.String("d", "\n", `Delimiter when outputting inline frames. Defaults to newline`)
 	_ = flagSet.Parse(os.Args[1:])
 	addresses := flagSet.Args()
 
-	// TODO: show inlined function
-	_ = inline
-	_ = inlineLong
-
 	if *help || *helpLong {
 		showUsage()
 		return
@@ -135,53 +174,135 @@ func main() {
 		popErr("Unknown architecture [%s]", *arch)
 	}
 
-	binaryFile := filepath.Base(*bin)
-	mf, err := atos.OpenMachO(*bin, ac)
+	if *kext != "" && *dylib != "" {
+		popErrAndUsage(`only one of "-kext or -dylib" can be used at a time`)
+	}
+
+	var sym atos.Symbolizer
+	if *kext != "" {
+		sym, err = atos.OpenFilesetEntry(*bin, *kext, ac)
+	} else if *dylib != "" {
+		sym, err = atos.OpenDyldCacheImage(*bin, *dylib)
+	} else {
+		sym, err = atos.Open(*bin, ac)
+	}
 	if err != nil {
 		popErrAndUsage("unable to open the executable or dSYM file: %v", err)
 	}
-	defer mf.Close()
+	defer sym.Close()
+
+	policy, err := atos.ParseLineZeroPolicy(*lineZero)
+	if err != nil {
+		popErrAndUsage("%v", err)
+	}
+	if lz, ok := sym.(interface{ SetLineZeroPolicy(atos.LineZeroPolicy) }); ok {
+		lz.SetLineZeroPolicy(policy)
+	}
 
 	if lAddr > 0 {
-		mf.SetLoadAddress(lAddr)
+		sym.SetLoadAddress(lAddr)
 	}
 
 	if kernelLoadAt > 0 {
-		mf.SetLoadAddress(kernelLoadAt)
+		mf, ok := sym.(*atos.MachFile)
+		if !ok {
+			popErr("-textExecAddress is only supported by Mach-O kernel and kext images")
+		}
+		mf.SetTextExecAddress(kernelLoadAt)
 	}
 
 	if loadSlide > 0 {
-		mf.SetLoadSlide(loadSlide)
+		sym.SetLoadSlide(loadSlide)
+	}
+
+	out, err := newResultWriter(*format, os.Stdout, sym.ImageName(), formatOptions{
+		fullPath:   *fullPath,
+		column:     *column,
+		funcOffset: *funcOffset,
+		delimiter:  *delimiter,
+	})
+	if err != nil {
+		popErrAndUsage("%v", err)
+	}
+
+	if *printHeader {
+		if *format != "text" {
+			popErrAndUsage("-printHeader only supports the text format")
+		}
+		printf("%s\n", formatHeader(sym, *bin))
 	}
 
-	var pc uint64
-	for _, addr := range addresses {
+	var (
+		pcs       = make([]uint64, len(addresses))
+		parseErrs = make([]error, len(addresses))
+	)
+	for i, addr := range addresses {
+		pc, err := strconv.ParseUint(prependHexSign(addr), 0, 64)
+		if err != nil {
+			atos.Log.Debugf("invalid address [%s]: %v", addr, err)
+			parseErrs[i] = fmt.Errorf("invalid address: %s", addr)
+			continue
+		}
 		if *isOffset {
-			offset, err := strconv.ParseUint(prependHexSign(addr), 0, 64)
-			if err != nil {
-				atos.Log.Debugf("invalid address offset [%s]: %v", addr, err)
-				fmt.Printf("%s%s", addr, *delimiter)
-				continue
-			}
-			pc = mf.LoadAddress() + offset
+			pc += sym.LoadAddress()
+		}
+		pcs[i] = pc
+	}
+
+	if *data {
+		symbolicateData(sym, out, addresses, parseErrs, pcs, *format, formatOptions{fullPath: *fullPath})
+		return
+	}
+
+	opts := atos.BacktraceOptions{
+		CallerFrames:       *callerFrames,
+		InlineFrames:       *inline || *inlineLong,
+		StripPointerAuth:   *stripPAC,
+		VirtualAddressBits: *addressBits,
+	}
+	for i, addr := range addresses {
+		if parseErrs[i] != nil {
+			err = out.write(addr, nil, parseErrs[i])
 		} else {
-			pc, err = strconv.ParseUint(prependHexSign(addr), 0, 64)
-			if err != nil {
-				atos.Log.Debugf("invalid address [%s]: %v", addr, err)
-				fmt.Printf("%s%s", addr, *delimiter)
-				continue
+			// the index of the input, so that only the first address is the crashing frame even if it's invalid
+			result := atos.SymbolicateFrame(sym, pcs[i], i, opts)
+			if result.Err != nil {
+				atos.Log.Debugf("unable to symbolize PC [%s]: %v", addr, result.Err)
 			}
+			err = out.write(addr, result.Symbols, result.Err)
 		}
-		symbol, err := mf.Atos(pc)
 		if err != nil {
-			atos.Log.Debugf("unable to symbolize PC [%s]: %v", addr, err)
-			fmt.Printf("%s%s", addr, *delimiter)
+			popErr("unable to write the output: %v", err)
+		}
+	}
+	if err = out.flush(); err != nil {
+		popErr("unable to write the output: %v", err)
+	}
+}
+
+// symbolicateData prints the variables containing the data addresses, an unresolved address is echoed back like atos
+func symbolicateData(sym atos.Symbolizer, out resultWriter, addresses []string, parseErrs []error, pcs []uint64, format string, opts formatOptions) {
+	if format != "text" {
+		popErrAndUsage("-data only supports the text format")
+	}
+	mf, ok := sym.(*atos.MachFile)
+	if !ok {
+		popErr("-data is only supported by Mach-O images")
+	}
+	if err := out.flush(); err != nil {
+		popErr("unable to write the output: %v", err)
+	}
+	for i, addr := range addresses {
+		if parseErrs[i] != nil {
+			printf("%s\n", addr)
 			continue
 		}
-		filename := symbol.Line.File.Name
-		if !(*fullPath) {
-			filename = path.Base(filename)
+		symbol, err := mf.AtosData(pcs[i])
+		if err != nil {
+			atos.Log.Debugf("unable to symbolize data address [%s]: %v", addr, err)
+			printf("%s\n", addr)
+			continue
 		}
-		printf("%s (in %s) (%s:%d)%s", symbol.Func, binaryFile, filename, symbol.Line.Line, *delimiter)
+		printf("%s\n", formatDataSymbol(symbol, mf.ImageName(), opts))
 	}
 }
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/zhyee/atos-go"
+)
+
+// outputFormats are the values of -format
+var outputFormats = []string{"text", "json", "jsonl", "csv"}
+
+// formatOptions controls the optional parts of the text output
+type formatOptions struct {
+	fullPath   bool   // print the full path of the source file
+	column     bool   // print "file:line:column"
+	funcOffset bool   // print "func + offset"
+	delimiter  string // joins the inlined frames of an address
+}
+
+// resultWriter outputs the symbolication results of the input addresses in order
+type resultWriter interface {
+	// write outputs the frames of an address, the innermost first, or the error if it's not resolved
+	write(addr string, frames []*atos.Symbol, err error) error
+	flush() error
+}
+
+func newResultWriter(format string, w io.Writer, image string, opts formatOptions) (resultWriter, error) {
+	bw := bufio.NewWriter(w)
+	switch format {
+	case "text":
+		return &textWriter{w: bw, image: image, opts: opts}, nil
+	case "json":
+		return &jsonWriter{w: bw, image: image, records: []outputRecord{}}, nil
+	case "jsonl":
+		return &jsonlWriter{w: bw, enc: json.NewEncoder(bw), image: image}, nil
+	case "csv":
+		return &csvWriter{w: csv.NewWriter(bw), bw: bw, image: image}, nil
+	}
+	return nil, fmt.Errorf("unknown output format [%s], expect one of %s", format, strings.Join(outputFormats, ", "))
+}
+
+// formatSymbol formats a symbol like Apple's atos: "func (in Image) (file:line)",
+// which becomes "func + offset (in Image) (file:line:column)" with all the options
+func formatSymbol(symbol *atos.Symbol, image string, opts formatOptions) string {
+	name := symbol.Func
+	if opts.funcOffset && symbol.FuncStart > 0 {
+		name = fmt.Sprintf("%s + %d", name, symbol.FuncOffset)
+	}
+	if !symbol.HasLine() {
+		return fmt.Sprintf("%s (in %s)", name, image)
+	}
+	filename := symbol.File
+	if !opts.fullPath {
+		filename = path.Base(filename)
+	}
+	line := strconv.Itoa(symbol.Line)
+	if opts.column && symbol.Column > 0 {
+		line += ":" + strconv.Itoa(symbol.Column)
+	}
+	if symbol.Approximate {
+		return fmt.Sprintf("%s (in %s) (%s:%s) [approximate]", name, image, filename, line)
+	}
+	return fmt.Sprintf("%s (in %s) (%s:%s)", name, image, filename, line)
+}
+
+// formatDataSymbol formats a data symbol like a function, with its declared type if known:
+// "gTable + 8 (in App) (int[16]) (table.c:12)"
+func formatDataSymbol(symbol *atos.DataSymbol, image string, opts formatOptions) string {
+	s := fmt.Sprintf("%s + %d (in %s)", symbol.Name, symbol.Offset, image)
+	if symbol.Type != "" {
+		s += " (" + symbol.Type + ")"
+	}
+	if symbol.File != "" && symbol.Line > 0 {
+		filename := symbol.File
+		if !opts.fullPath {
+			filename = path.Base(filename)
+		}
+		s += fmt.Sprintf(" (%s:%d)", filename, symbol.Line)
+	}
+	return s
+}
+
+// formatHeader formats the header line of an image like Apple's atos -printHeader, with the architecture and UUID
+func formatHeader(sym atos.Symbolizer, file string) string {
+	uuid := "unknown"
+	if id, ok := sym.UUID(); ok {
+		uuid = atos.FormatUUID(id)
+	}
+	return fmt.Sprintf("got symbolicator for %s (%s, UUID %s), base address %x", file, sym.Arch(), uuid, sym.LoadAddress())
+}
+
+// textWriter prints like Apple's atos, an unresolved address is echoed back
+type textWriter struct {
+	w     *bufio.Writer
+	image string
+	opts  formatOptions
+}
+
+func (t *textWriter) write(addr string, frames []*atos.Symbol, err error) error {
+	if err != nil {
+		_, err = fmt.Fprintf(t.w, "%s\n", addr)
+		return err
+	}
+	lines := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		lines = append(lines, formatSymbol(frame, t.image, t.opts))
+	}
+	_, err = fmt.Fprintf(t.w, "%s\n", strings.Join(lines, t.opts.delimiter))
+	return err
+}
+
+func (t *textWriter) flush() error {
+	return t.w.Flush()
+}
+
+// outputRecord is a frame of the structured output, an address has one record for each
+// inlined frame, the innermost goes first and has the largest inline_depth
+type outputRecord struct {
+	Address     string `json:"address"`
+	Image       string `json:"image"`
+	Function    string `json:"function,omitempty"`
+	Demangled   string `json:"demangled,omitempty"`
+	FuncStart   string `json:"func_start,omitempty"`
+	FuncOffset  uint64 `json:"func_offset,omitempty"`
+	File        string `json:"file,omitempty"`
+	FullPath    string `json:"full_path,omitempty"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column,omitempty"`
+	Approximate bool   `json:"approximate,omitempty"`
+	InlineDepth int    `json:"inline_depth"`
+	Error       string `json:"error,omitempty"`
+}
+
+var csvHeader = []string{"address", "image", "function", "demangled", "func_start", "func_offset",
+	"file", "full_path", "line", "column", "approximate", "inline_depth", "error"}
+
+func (r *outputRecord) csv() []string {
+	return []string{r.Address, r.Image, r.Function, r.Demangled, r.FuncStart, strconv.FormatUint(r.FuncOffset, 10),
+		r.File, r.FullPath, strconv.Itoa(r.Line), strconv.Itoa(r.Column), strconv.FormatBool(r.Approximate),
+		strconv.Itoa(r.InlineDepth), r.Error}
+}
+
+func outputRecords(addr, image string, frames []*atos.Symbol, err error) []outputRecord {
+	if err != nil {
+		return []outputRecord{{Address: addr, Image: image, Error: err.Error()}}
+	}
+	records := make([]outputRecord, 0, len(frames))
+	for i, frame := range frames {
+		record := outputRecord{
+			Address:     addr,
+			Image:       image,
+			Function:    frame.Func,
+			Demangled:   frame.Demangled(),
+			FuncOffset:  frame.FuncOffset,
+			FullPath:    frame.Path(),
+			Line:        frame.Line,
+			Column:      frame.Column,
+			Approximate: frame.Approximate,
+			InlineDepth: len(frames) - 1 - i,
+		}
+		if frame.FuncStart > 0 {
+			record.FuncStart = fmt.Sprintf("0x%x", frame.FuncStart)
+		}
+		if frame.HasLine() {
+			record.File = path.Base(frame.File)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// jsonWriter outputs a JSON array of all the records
+type jsonWriter struct {
+	w       *bufio.Writer
+	image   string
+	records []outputRecord
+}
+
+func (j *jsonWriter) write(addr string, frames []*atos.Symbol, err error) error {
+	j.records = append(j.records, outputRecords(addr, j.image, frames, err)...)
+	return nil
+}
+
+func (j *jsonWriter) flush() error {
+	enc := json.NewEncoder(j.w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(j.records); err != nil {
+		return err
+	}
+	return j.w.Flush()
+}
+
+// jsonlWriter outputs a JSON object per line for each record
+type jsonlWriter struct {
+	w     *bufio.Writer
+	enc   *json.Encoder
+	image string
+}
+
+func (j *jsonlWriter) write(addr string, frames []*atos.Symbol, err error) error {
+	for _, record := range outputRecords(addr, j.image, frames, err) {
+		if err := j.enc.Encode(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (j *jsonlWriter) flush() error {
+	return j.w.Flush()
+}
+
+// csvWriter outputs the records as CSV with a header row
+type csvWriter struct {
+	w             *csv.Writer
+	bw            *bufio.Writer
+	image         string
+	headerWritten bool
+}
+
+func (c *csvWriter) write(addr string, frames []*atos.Symbol, err error) error {
+	if !c.headerWritten {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+	for _, record := range outputRecords(addr, c.image, frames, err) {
+		if err := c.w.Write(record.csv()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *csvWriter) flush() error {
+	if !c.headerWritten {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
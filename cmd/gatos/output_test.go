@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/zhyee/atos-go"
+)
+
+// testFrames are an inlined frame and the function containing it, whose line 0 is compiler generated code
+var testFrames = []*atos.Symbol{
+	{Func: "square", File: "inline.c", CompDir: "/src", Line: 5, Column: 12},
+	{Func: "_Z7computei", File: "/src/inline.c", Line: 0, FuncStart: 0x1000, FuncOffset: 0x10},
+}
+
+func writeResults(t *testing.T, format string) string {
+	var sb strings.Builder
+	out, err := newResultWriter(format, &sb, "inline.elf", formatOptions{delimiter: "\n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = out.write("0x1010", testFrames, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.write("zz", nil, errors.New("invalid address: zz")); err != nil {
+		t.Fatal(err)
+	}
+	if err = out.flush(); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func TestJSONWriter(t *testing.T) {
+	want := `[
+  {
+    "address": "0x1010",
+    "image": "inline.elf",
+    "function": "square",
+    "demangled": "square",
+    "file": "inline.c",
+    "full_path": "/src/inline.c",
+    "line": 5,
+    "column": 12,
+    "inline_depth": 1
+  },
+  {
+    "address": "0x1010",
+    "image": "inline.elf",
+    "function": "_Z7computei",
+    "demangled": "compute(int)",
+    "func_start": "0x1000",
+    "func_offset": 16,
+    "file": "inline.c",
+    "full_path": "/src/inline.c",
+    "line": 0,
+    "inline_depth": 0
+  },
+  {
+    "address": "zz",
+    "image": "inline.elf",
+    "line": 0,
+    "inline_depth": 0,
+    "error": "invalid address: zz"
+  }
+]
+`
+	if got := writeResults(t, "json"); got != want {
+		t.Errorf("unexpected JSON output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestJSONLWriter(t *testing.T) {
+	want := `{"address":"0x1010","image":"inline.elf","function":"square","demangled":"square","file":"inline.c","full_path":"/src/inline.c","line":5,"column":12,"inline_depth":1}
+{"address":"0x1010","image":"inline.elf","function":"_Z7computei","demangled":"compute(int)","func_start":"0x1000","func_offset":16,"file":"inline.c","full_path":"/src/inline.c","line":0,"inline_depth":0}
+{"address":"zz","image":"inline.elf","line":0,"inline_depth":0,"error":"invalid address: zz"}
+`
+	if got := writeResults(t, "jsonl"); got != want {
+		t.Errorf("unexpected JSONL output:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	want := `address,image,function,demangled,func_start,func_offset,file,full_path,line,column,approximate,inline_depth,error
+0x1010,inline.elf,square,square,,0,inline.c,/src/inline.c,5,12,false,1,
+0x1010,inline.elf,_Z7computei,compute(int),0x1000,16,inline.c,/src/inline.c,0,0,false,0,
+zz,inline.elf,,,,0,,,0,0,false,0,invalid address: zz
+`
+	if got := writeResults(t, "csv"); got != want {
+		t.Errorf("unexpected CSV output:\n%s\nwant:\n%s", got, want)
+	}
+
+	// the header row is written even if there are no results
+	var sb strings.Builder
+	out, err := newResultWriter("csv", &sb, "inline.elf", formatOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = out.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sb.String(); got != strings.Join(csvHeader, ",")+"\n" {
+		t.Errorf("unexpected CSV output of no results: %q", got)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := newResultWriter("xml", &strings.Builder{}, "inline.elf", formatOptions{}); err == nil {
+		t.Error("expect an error of an unknown format")
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zhyee/atos-go"
+)
+
+const panicUsageMsg = `Usage: %s panic -store dir [-store dir ...] [-printHeader] [-fullPath] [-column] [-inlineFrames] panic-report`
+
+// stringsFlag is a flag which can be repeated, e.g. "-store dir1 -store dir2"
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// kernelPanic implements "gatos panic" which symbolicates the backtraces of a kernel panic report
+// (panic-full-*.ips or .panic) with the kernel and kext symbols from the symbol store directories
+func kernelPanic(args []string) {
+	flagSet = flag.NewFlagSet("panic", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(panicUsageMsg)
+
+	var stores stringsFlag
+	help := flagSet.Bool("h", false, "show this help")
+	flagSet.Var(&stores, "store", `A directory of the kernel and kext symbols, e.g. the dSYMs and the kernelcaches of a KDK, which are indexed by UUID. Can be repeated`)
+	printHeader := flagSet.Bool("printHeader", false, `Print a header line with the symbol file path, architecture, UUID and load address of each image before the report`)
+	fullPath := flagSet.Bool("fullPath", false, `Print the full path of the source files`)
+	column := flagSet.Bool("column", false, `Print the source column as "file:line:column" if known`)
+	inline := flagSet.Bool("inlineFrames", false, `Display inlined symbols`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if flagSet.NArg() != 1 {
+		popErrAndUsage("expect one panic report")
+	}
+	if len(stores) == 0 {
+		popErrAndUsage("no symbol store specified")
+	}
+
+	store, err := atos.NewSymbolStore(stores...)
+	if err != nil {
+		popErr("%v", err)
+	}
+	f, err := os.Open(flagSet.Arg(0))
+	if err != nil {
+		popErr("unable to open the panic report: %v", err)
+	}
+	report, err := atos.ParseKernelPanic(f)
+	_ = f.Close()
+	if err != nil {
+		popErr("unable to parse the panic report: %v", err)
+	}
+
+	opts := formatOptions{fullPath: *fullPath, column: *column, funcOffset: true}
+	var headers []string
+	backtraces := report.Symbolicate(store, atos.BacktraceOptions{
+		InlineFrames: *inline,
+		ImageOpened: func(sym atos.Symbolizer, path string) {
+			headers = append(headers, formatHeader(sym, path))
+		},
+	})
+	if *printHeader {
+		for _, header := range headers {
+			printf("%s\n", header)
+		}
+	}
+	printf("%s\n", report.Panic)
+	for i, frames := range backtraces {
+		printf("\n%s\n", report.Backtraces[i].Title)
+		for _, frame := range frames {
+			if frame.Err != nil {
+				atos.Log.Debugf("unable to symbolicate PC [0x%x] of [%s]: %v", frame.PC, frame.Image, frame.Err)
+				printf("0x%016x (in %s)\n", frame.PC, frame.Image)
+				continue
+			}
+			for j, symbol := range frame.Symbols {
+				prefix := "                  " // the inlined frames are aligned to the symbols
+				if j == 0 {
+					prefix = fmt.Sprintf("0x%016x", frame.PC)
+				}
+				printf("%s %s\n", prefix, formatSymbol(symbol, frame.Image, opts))
+			}
+		}
+	}
+}
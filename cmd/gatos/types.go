@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/zhyee/atos-go"
+	"github.com/zhyee/atos-go/dwarftype"
+)
+
+const typesUsageMsg = `Usage: %s types -o executable/dSYM [-arch architecture] name ...`
+
+// types implements "gatos types" which dumps the layouts of the structs, classes, unions, enums and typedefs of the names
+func types(args []string) {
+	flagSet = flag.NewFlagSet("types", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(typesUsageMsg)
+
+	help := flagSet.Bool("h", false, "show this help")
+	bin := flagSet.String("o", "", `The path to a binary image file or dSYM in which to look up the types`)
+	arch := flagSet.String("arch", "arm64", `The particular architecture of a binary image file in which to look up the types`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if *bin == "" {
+		popErrAndUsage("no executable or dSYM file specified")
+	}
+
+	ac, err := atos.ParseArch(*arch)
+	if err != nil {
+		popErr("Unknown architecture [%s]", *arch)
+	}
+	sym, err := atos.Open(*bin, ac)
+	if err != nil {
+		popErr("unable to open the executable or dSYM file: %v", err)
+	}
+	defer sym.Close()
+
+	ds, ok := sym.(atos.DWARFSymbolizer)
+	if !ok || ds.DWARFData() == nil {
+		popErr("types are not supported by %s", sym.ImageName())
+	}
+	printer := dwarftype.NewPrinter(ds.DWARFData())
+	for _, name := range flagSet.Args() {
+		offsets, err := ds.LookupTypeDefinitions(name)
+		if err != nil {
+			atos.Log.Debugf("unable to look up the type [%s]: %v", name, err)
+		}
+		// a type is defined in each CU using it, print the different definitions once
+		printed := make(map[string]bool)
+		for _, off := range offsets {
+			layout, err := printer.Layout(off)
+			if err != nil {
+				atos.Log.Debugf("unable to dump the type [%s] at 0x%x: %v", name, off, err)
+				continue
+			}
+			if !printed[layout] {
+				printed[layout] = true
+				printf("%s", layout)
+			}
+		}
+		if len(printed) == 0 {
+			printf("%s: not found\n", name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/zhyee/atos-go"
+)
+
+const varsUsageMsg = `Usage: %s vars -o executable/dSYM [-arch architecture] [-l loadAddress | -s slide] [-fullPath] address ...`
+
+// vars implements "gatos vars" which lists the parameters and the local variables in scope at the addresses
+func vars(args []string) {
+	flagSet = flag.NewFlagSet("vars", flag.ContinueOnError)
+	flagSet.SetOutput(logger.Writer())
+	usage = subCommandUsage(varsUsageMsg)
+
+	help := flagSet.Bool("h", false, "show this help")
+	bin := flagSet.String("o", "", `The path to a binary image file or dSYM in which to look up the variables`)
+	arch := flagSet.String("arch", "arm64", `The particular architecture of a binary image file in which to look up the variables`)
+	loadAddr := flagSet.String("l", "", `The load address of the binary image.  This value is always assumed to be in hex, even without a "0x" prefix`)
+	slide := flagSet.String("s", "", `The slide value of the binary image.  This value is always assumed to be in hex, even without a "0x" prefix`)
+	fullPath := flagSet.Bool("fullPath", false, `Print the full path of the source files`)
+	if err := flagSet.Parse(args); err != nil {
+		os.Exit(2)
+	}
+
+	if *help {
+		showUsage()
+		return
+	}
+	if *bin == "" {
+		popErrAndUsage("no executable or dSYM file specified")
+	}
+	if *loadAddr != "" && *slide != "" {
+		popErrAndUsage(`only one of "-s or -l" can be used at a time`)
+	}
+
+	ac, err := atos.ParseArch(*arch)
+	if err != nil {
+		popErr("Unknown architecture [%s]", *arch)
+	}
+	sym, err := atos.Open(*bin, ac)
+	if err != nil {
+		popErr("unable to open the executable or dSYM file: %v", err)
+	}
+	defer sym.Close()
+
+	ds, ok := sym.(atos.DWARFSymbolizer)
+	if !ok {
+		popErr("variables are not supported by %s", sym.ImageName())
+	}
+	if *loadAddr != "" {
+		lAddr, err := strconv.ParseUint(prependHexSign(*loadAddr), 0, 64)
+		if err != nil {
+			popErrAndUsage("invalid load address: %v", err)
+		}
+		sym.SetLoadAddress(lAddr)
+	}
+	if *slide != "" {
+		loadSlide, err := strconv.ParseUint(prependHexSign(*slide), 0, 64)
+		if err != nil {
+			popErrAndUsage("invalid slide value: %v", err)
+		}
+		sym.SetLoadSlide(loadSlide)
+	}
+
+	for _, addr := range flagSet.Args() {
+		pc, err := strconv.ParseUint(prependHexSign(addr), 0, 64)
+		if err != nil {
+			printf("%s: invalid address\n", addr)
+			continue
+		}
+		variables, err := ds.FrameVariables(pc)
+		if err != nil {
+			atos.Log.Debugf("unable to list the variables at [%s]: %v", addr, err)
+			printf("%s: not found\n", addr)
+			continue
+		}
+		printf("%s:\n", addr)
+		for _, v := range variables {
+			printf("    %s\n", formatVariable(v, sym.Arch(), *fullPath))
+		}
+	}
+}
+
+// formatVariable formats a variable like "param int a (in compute) (inline.c:13): DW_OP_reg5 rdi"
+func formatVariable(v atos.FrameVariable, arch atos.Arch, fullPath bool) string {
+	kind := "var"
+	if v.Parameter {
+		kind = "param"
+	}
+	s := fmt.Sprintf("%s %s %s (in %s)", kind, v.Type, v.Name, v.Function)
+	if v.DeclFile != "" {
+		filename := v.DeclFile
+		if !fullPath {
+			filename = path.Base(filename)
+		}
+		s += fmt.Sprintf(" (%s:%d)", filename, v.DeclLine)
+	}
+	if v.Location == nil {
+		return s + ": <optimized out>"
+	}
+	return s + ": " + atos.FormatLocation(v.Location, arch)
+}
@@ -1,6 +1,8 @@
 package atos
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 )
@@ -42,7 +44,11 @@ func (r *bytesReader) ReadByte() (b byte, err error) {
 }
 
 func (r *bytesReader) Skip(n int) (int, error) {
-	if r.offset+n > len(r.data) {
+	if r.offset > len(r.data) {
+		r.offset = len(r.data)
+		return 0, io.ErrUnexpectedEOF
+	}
+	if n < 0 || r.offset+n > len(r.data) {
 		n = len(r.data) - r.offset
 		r.offset = len(r.data)
 		return n, io.ErrUnexpectedEOF
@@ -51,8 +57,14 @@ func (r *bytesReader) Skip(n int) (int, error) {
 	return n, nil
 }
 
+// Bytes returns the next n bytes, and io.ErrUnexpectedEOF if fewer are left, e.g. after seeking past the end
+// to an offset of a corrupt file
 func (r *bytesReader) Bytes(n int) ([]byte, error) {
-	if r.offset+n > len(r.data) {
+	if r.offset > len(r.data) {
+		r.offset = len(r.data)
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n < 0 || r.offset+n > len(r.data) {
 		b := r.data[r.offset:]
 		r.offset = len(r.data)
 		return b, io.ErrUnexpectedEOF
@@ -80,3 +92,91 @@ func (r *bytesReader) Seek(offset int64, whence int) (int64, error) {
 	r.offset = int(newOff)
 	return newOff, nil
 }
+
+// ReadULEB128 reads an unsigned LEB128 encoded integer
+func (r *bytesReader) ReadULEB128() (uint64, error) {
+	var (
+		result uint64
+		shift  uint
+	)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if shift < 64 {
+			result |= uint64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			return result, nil
+		}
+	}
+}
+
+// ReadSLEB128 reads a signed LEB128 encoded integer
+func (r *bytesReader) ReadSLEB128() (int64, error) {
+	var (
+		result int64
+		shift  uint
+		b      byte
+		err    error
+	)
+	for {
+		b, err = r.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if shift < 64 {
+			result |= int64(b&0x7f) << shift
+		}
+		shift += 7
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	if shift < 64 && b&0x40 != 0 {
+		result |= -1 << shift // sign extend
+	}
+	return result, nil
+}
+
+// ReadCString reads a NUL terminated string
+func (r *bytesReader) ReadCString() (string, error) {
+	if r.offset > len(r.data) {
+		r.offset = len(r.data)
+		return "", io.ErrUnexpectedEOF
+	}
+	idx := bytes.IndexByte(r.data[r.offset:], 0)
+	if idx < 0 {
+		r.offset = len(r.data)
+		return "", io.ErrUnexpectedEOF
+	}
+	s := string(r.data[r.offset : r.offset+idx])
+	r.offset += idx + 1
+	return s, nil
+}
+
+func (r *bytesReader) Uint16(order binary.ByteOrder) (uint16, error) {
+	b, err := r.Bytes(2)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint16(b), nil
+}
+
+func (r *bytesReader) Uint32(order binary.ByteOrder) (uint32, error) {
+	b, err := r.Bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint32(b), nil
+}
+
+func (r *bytesReader) Uint64(order binary.ByteOrder) (uint64, error) {
+	b, err := r.Bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return order.Uint64(b), nil
+}
@@ -2,6 +2,7 @@ package atos
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"io"
 	"testing"
@@ -70,3 +71,52 @@ func TestBytesReader(t *testing.T) {
 		t.Fatalf("ReadByte returned wrong bytes")
 	}
 }
+
+func TestBytesReaderLEB128(t *testing.T) {
+	br := newBytesReader([]byte{0xe5, 0x8e, 0x26, 0xc0, 0xbb, 0x78, 0x7f, 'a', 'b', 0x00})
+	u, err := br.ReadULEB128()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u != 624485 {
+		t.Fatalf("ReadULEB128 returned wrong value: %d", u)
+	}
+	s, err := br.ReadSLEB128()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != -123456 {
+		t.Fatalf("ReadSLEB128 returned wrong value: %d", s)
+	}
+	if s, err = br.ReadSLEB128(); err != nil || s != -1 {
+		t.Fatalf("ReadSLEB128 returned wrong value: %d, %v", s, err)
+	}
+	str, err := br.ReadCString()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if str != "ab" || br.Len() != 0 {
+		t.Fatalf("ReadCString returned wrong string: %q", str)
+	}
+	if _, err = br.ReadULEB128(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestBytesReaderPastEnd(t *testing.T) {
+	br := newBytesReader([]byte{0x01, 0x02})
+	if _, err := br.Seek(0x7fffffff, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := br.Uint32(binary.LittleEndian); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	br.Seek(3, io.SeekStart)
+	if _, err := br.ReadCString(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+	br.Seek(3, io.SeekStart)
+	if _, err := br.Skip(1); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expect io.ErrUnexpectedEOF, got %v", err)
+	}
+}
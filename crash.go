@@ -0,0 +1,232 @@
+package atos
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OSVersion is the OS of a crash report or of a device support directory, e.g. "iPhone OS 15.2 (19C56)"
+type OSVersion struct {
+	Name    string // e.g. "iPhone OS" or "macOS", empty for the device support directories
+	Version string // e.g. "15.2"
+	Build   string // e.g. "19C56", empty if unknown
+}
+
+var osVersionRegexp = regexp.MustCompile(`(\d+(?:\.\d+)+)(?:\s*\(([0-9A-Za-z]+)\))?`)
+
+// ParseOSVersion parses an OS version like "iPhone OS 15.2 (19C56)" of the crash reports,
+// or the name of a device support directory like "15.2 (19C56)" or "iPhone14,2 15.2 (19C56)"
+func ParseOSVersion(s string) OSVersion {
+	m := osVersionRegexp.FindStringSubmatchIndex(s)
+	if m == nil {
+		return OSVersion{Name: strings.TrimSpace(s)}
+	}
+	v := OSVersion{Name: strings.TrimSpace(s[:m[0]]), Version: s[m[2]:m[3]]}
+	if m[4] >= 0 {
+		v.Build = s[m[4]:m[5]]
+	}
+	return v
+}
+
+// Matches reports if two OS versions are the same, by the builds if both are known, otherwise by the versions
+func (v OSVersion) Matches(o OSVersion) bool {
+	if v.Build != "" && o.Build != "" {
+		return v.Build == o.Build
+	}
+	return v.Version != "" && v.Version == o.Version
+}
+
+func (v OSVersion) String() string {
+	s := v.Version
+	if v.Name != "" {
+		s = v.Name + " " + s
+	}
+	if v.Build != "" {
+		s += " (" + v.Build + ")"
+	}
+	return s
+}
+
+// CrashReport is an Apple crash report of the text format, e.g. a .crash file exported from Xcode
+type CrashReport struct {
+	Lines      []string // the lines of the report, which the frames refer to
+	OSVersion  OSVersion
+	Backtraces []CrashBacktrace
+	Images     []CrashImage // the "Binary Images" section
+}
+
+// CrashBacktrace is the backtrace of a thread or the "Last Exception Backtrace"
+type CrashBacktrace struct {
+	Title  string // e.g. "Thread 0 Crashed:"
+	Frames []CrashFrame
+}
+
+// CrashFrame is a frame line of a crash report, e.g.
+// "0   CoreFoundation                      0x00000001803e1188 __exceptionPreprocess + 236"
+type CrashFrame struct {
+	Line    int    // the index of the frame in CrashReport.Lines
+	Prefix  string // the text before the address, i.e. the frame number and the padded image name
+	Image   string
+	Address uint64
+	Symbol  string // the text after the address, e.g. "__exceptionPreprocess + 236" or "0x104480000 + 72"
+}
+
+// CrashImage is a binary image of a crash report, e.g.
+// "0x104480000 - 0x1044dffff App arm64 <c5f567045f43313083662447212630b9> /path/to/App.app/App"
+type CrashImage struct {
+	Name       string
+	Start, End uint64 // the runtime address range, Start is the load address
+	Arch       string
+	UUID       [16]byte
+	Path       string
+}
+
+var (
+	crashFrameRegexp  = regexp.MustCompile(`^(\d+\s+(.+?)\s+)(0x[0-9a-fA-F]+)\s*(.*)$`)
+	crashImageRegexp  = regexp.MustCompile(`^\s*(0x[0-9a-fA-F]+)\s*-\s*(0x[0-9a-fA-F]+)\s+\+?(.+?)\s+(\S+)\s+<([0-9a-fA-F-]+)>\s*(.*)$`)
+	crashThreadRegexp = regexp.MustCompile(`^(Last Exception Backtrace|Thread \d+(?: Crashed)?):`)
+)
+
+// ParseCrashReport parses a crash report of the text format: the OS version of the header,
+// the backtraces of the threads and the binary images
+func ParseCrashReport(r io.Reader) (*CrashReport, error) {
+	report := &CrashReport{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var (
+		bt       *CrashBacktrace
+		inImages bool
+	)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		report.Lines = append(report.Lines, line)
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			bt, inImages = nil, false
+		case strings.HasPrefix(trimmed, "Binary Images:"):
+			bt, inImages = nil, true
+		case crashThreadRegexp.MatchString(trimmed):
+			report.Backtraces = append(report.Backtraces, CrashBacktrace{Title: trimmed})
+			bt, inImages = &report.Backtraces[len(report.Backtraces)-1], false
+		case bt != nil:
+			m := crashFrameRegexp.FindStringSubmatch(line)
+			if m == nil {
+				bt = nil
+				break
+			}
+			addr, err := strconv.ParseUint(m[3], 0, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address of the frame [%s]: %w", line, err)
+			}
+			bt.Frames = append(bt.Frames, CrashFrame{
+				Line:    len(report.Lines) - 1,
+				Prefix:  m[1],
+				Image:   m[2],
+				Address: addr,
+				Symbol:  m[4],
+			})
+		case inImages:
+			m := crashImageRegexp.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			image := CrashImage{Name: m[3], Arch: m[4], Path: m[6]}
+			image.Start, _ = strconv.ParseUint(m[1], 0, 64)
+			image.End, _ = strconv.ParseUint(m[2], 0, 64)
+			uuid, err := ParseUUID(m[5])
+			if err != nil {
+				return nil, fmt.Errorf("invalid UUID of the binary image [%s]: %w", line, err)
+			}
+			image.UUID = uuid
+			report.Images = append(report.Images, image)
+		default:
+			if key, value, ok := strings.Cut(trimmed, ":"); ok && key == "OS Version" {
+				report.OSVersion = ParseOSVersion(value)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the crash report: %w", err)
+	}
+	return report, nil
+}
+
+// Image returns the binary image which the runtime address belongs to
+func (c *CrashReport) Image(addr uint64) (*CrashImage, bool) {
+	for i := range c.Images {
+		if addr >= c.Images[i].Start && addr <= c.Images[i].End {
+			return &c.Images[i], true
+		}
+	}
+	return nil, false
+}
+
+// arch returns the architecture of the report from its binary images, arm64 if unknown
+func (c *CrashReport) arch() Arch {
+	for _, image := range c.Images {
+		if arch, err := ParseArch(image.Arch); err == nil {
+			return arch
+		}
+	}
+	return ArchARM64
+}
+
+// Symbolicate resolves the backtraces with the symbol files of the binary images in the store, including
+// the system libraries of the device support directories of the report's OS version, see LookupOS.
+// The result of each backtrace is in the order of its frames
+func (c *CrashReport) Symbolicate(store *SymbolStore, opts BacktraceOptions) [][]BacktraceFrame {
+	type image struct {
+		sym Symbolizer
+		err error
+	}
+	images := make(map[*CrashImage]*image)
+	defer func() {
+		for _, img := range images {
+			if img.sym != nil {
+				_ = img.sym.Close()
+			}
+		}
+	}()
+
+	backtraces := make([][]BacktraceFrame, len(c.Backtraces))
+	for i, bt := range c.Backtraces {
+		frames := make([]BacktraceFrame, len(bt.Frames))
+		for j, frame := range bt.Frames {
+			addr := frame.Address
+			if opts.StripPointerAuth {
+				addr = c.arch().CanonicalAddress(addr, opts.VirtualAddressBits)
+			}
+			ci, ok := c.Image(addr)
+			if !ok {
+				frames[j] = BacktraceFrame{PC: frame.Address, LookupPC: frame.Address,
+					Err: fmt.Errorf("no binary image contains address 0x%x", frame.Address)}
+				continue
+			}
+			img := images[ci]
+			if img == nil {
+				img = &image{}
+				var entry *StoreEntry
+				if img.sym, entry, img.err = openStoreEntries(ci.UUID, store.LookupOS(ci.UUID, c.OSVersion)); img.err == nil {
+					img.sym.SetLoadAddress(ci.Start)
+					if opts.ImageOpened != nil {
+						opts.ImageOpened(img.sym, entry.Path)
+					}
+				}
+				images[ci] = img
+			}
+			if img.err != nil {
+				frames[j] = BacktraceFrame{PC: frame.Address, LookupPC: frame.Address, Err: img.err}
+				continue
+			}
+			frames[j] = SymbolicateFrame(img.sym, frame.Address, j, opts)
+		}
+		backtraces[i] = frames
+	}
+	return backtraces
+}
@@ -0,0 +1,145 @@
+package atos
+
+import (
+	"debug/macho"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCrashReport crashes in libtest.dylib of the device support directory in writeDeviceSupport
+const testCrashReport = `Incident Identifier: 2F3B4C5D-6E7F-4A8B-9C0D-1E2F3A4B5C6D
+Hardware Model:      iPhone14,2
+OS Version:          iPhone OS 15.2 (19C56)
+Exception Type:  EXC_CRASH (SIGABRT)
+
+Last Exception Backtrace:
+0   libtest.dylib                 	0x0000000190001044 test_throw + 4
+1   libtest.dylib                 	0x0000000190001088 test_main + 8
+2   Unknown                       	0x00000001a0000000 0x1a0000000 + 0
+
+Thread 0 name:  Dispatch queue: com.apple.main-thread
+Thread 0 Crashed:
+0   libtest.dylib                 	0x0000000190001008 test_abort + 8
+1   libtest.dylib                 	0x8e3a000190001048 0x190000000 + 4168
+
+Binary Images:
+       0x190000000 -        0x190001fff libtest.dylib arm64e  <00000001-8000-0000-ffff-fffe7fffffff> /usr/lib/libtest.dylib
+`
+
+// writeDeviceSupport writes a device support directory with libtest.dylib of iOS 15.2 at 0x180000000,
+// and a broken one of iOS 15.1 which must not be indexed
+func writeDeviceSupport(t *testing.T) string {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "15.2 (19C56)", "Symbols", "usr", "lib")
+	if err := os.MkdirAll(lib, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	image := filesetImage(0, 0x180000000, macho.TypeDylib, "test_abort", "test_throw", "test_main")
+	if err := os.WriteFile(filepath.Join(lib, "libtest.dylib"), image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "15.1 (19B74)", "Symbols"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "15.1 (19B74)", "Symbols", "libbroken.dylib"), image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestParseOSVersion(t *testing.T) {
+	for s, want := range map[string]OSVersion{
+		"iPhone OS 15.2 (19C56)":  {Name: "iPhone OS", Version: "15.2", Build: "19C56"},
+		"15.2 (19C56)":            {Version: "15.2", Build: "19C56"},
+		"iPhone14,2 15.2 (19C56)": {Name: "iPhone14,2", Version: "15.2", Build: "19C56"},
+		"macOS 12.1":              {Name: "macOS", Version: "12.1"},
+	} {
+		if v := ParseOSVersion(s); v != want {
+			t.Fatalf("ParseOSVersion(%q) = %+v, want %+v", s, v, want)
+		}
+	}
+	if !ParseOSVersion("15.2").Matches(ParseOSVersion("iPhone OS 15.2 (19C56)")) ||
+		ParseOSVersion("15.2 (19C57)").Matches(ParseOSVersion("iPhone OS 15.2 (19C56)")) {
+		t.Fatal("unexpected OS version matches")
+	}
+}
+
+func TestSymbolicateCrashReport(t *testing.T) {
+	report, err := ParseCrashReport(strings.NewReader(testCrashReport))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OSVersion != (OSVersion{Name: "iPhone OS", Version: "15.2", Build: "19C56"}) {
+		t.Fatalf("unexpected OS version %+v", report.OSVersion)
+	}
+	if len(report.Backtraces) != 2 || report.Backtraces[1].Title != "Thread 0 Crashed:" ||
+		len(report.Backtraces[0].Frames) != 3 || len(report.Backtraces[1].Frames) != 2 {
+		t.Fatalf("unexpected backtraces %+v", report.Backtraces)
+	}
+	frame := report.Backtraces[0].Frames[1]
+	if frame.Image != "libtest.dylib" || frame.Address != 0x190001088 || frame.Symbol != "test_main + 8" || frame.Line != 7 {
+		t.Fatalf("unexpected frame %+v", frame)
+	}
+	if len(report.Images) != 1 || report.Images[0].UUID != filesetUUID(0x180000000) || report.Images[0].End != 0x190001fff {
+		t.Fatalf("unexpected binary images %+v", report.Images)
+	}
+
+	store, err := NewSymbolStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = store.AddDeviceSupport(writeDeviceSupport(t)); err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 0 {
+		t.Fatalf("the device support is indexed before the lookup: %d", store.Len())
+	}
+
+	backtraces := report.Symbolicate(store, BacktraceOptions{CallerFrames: true})
+	if store.Len() != 1 {
+		t.Fatalf("expect only the device support of 15.2 indexed, got %d images", store.Len())
+	}
+	if entries := store.Lookup(report.Images[0].UUID); len(entries) != 1 || entries[0].OSVersion != "15.2 (19C56)" {
+		t.Fatalf("unexpected store entries %+v", entries)
+	}
+	for i, want := range []struct {
+		fn     string
+		offset uint64
+	}{{"test_throw", 4}, {"test_main", 8}} {
+		frame := backtraces[0][i]
+		if frame.Err != nil {
+			t.Fatalf("frame %d: %v", i, frame.Err)
+		}
+		if frame.Symbols[0].Func != want.fn || frame.Symbols[0].FuncOffset != want.offset {
+			t.Fatalf("frame %d: unexpected %+v", i, frame.Symbols[0])
+		}
+	}
+	if backtraces[0][1].LookupPC >= backtraces[0][1].PC {
+		t.Fatalf("the caller frame is not adjusted: %+v", backtraces[0][1])
+	}
+	if backtraces[0][2].Err == nil {
+		t.Fatal("expect an error for the frame out of the binary images")
+	}
+	if fn := backtraces[1][0].Symbols[0].Func; fn != "test_abort" {
+		t.Fatalf("unexpected crashed frame %s", fn)
+	}
+	if backtraces[1][1].Err == nil {
+		t.Fatal("expect an error for the signed return address without stripping")
+	}
+
+	var opened []string
+	backtraces = report.Symbolicate(store, BacktraceOptions{CallerFrames: true, StripPointerAuth: true,
+		ImageOpened: func(sym Symbolizer, path string) {
+			opened = append(opened, fmt.Sprintf("%s 0x%x", path, sym.LoadAddress()))
+		}})
+	if frame := backtraces[1][1]; frame.Err != nil || frame.Symbols[0].Func != "test_throw" || frame.Symbols[0].FuncOffset != 8 {
+		t.Fatalf("unexpected signed return address frame %+v", frame)
+	}
+	// the image is opened once for all the backtraces
+	if entries := store.Lookup(report.Images[0].UUID); len(opened) != 1 || opened[0] != entries[0].Path+" 0x190000000" {
+		t.Fatalf("unexpected opened images %v", opened)
+	}
+}
@@ -0,0 +1,218 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zhyee/atos-go/dwarftype"
+)
+
+// the location expressions of the variables at fixed addresses, DW_OP_addrx of DWARF 5 is the index
+// of the address in __debug_addr
+const (
+	dwOpAddr  = 0x03
+	dwOpAddrx = 0xa1
+)
+
+// DataSymbol is the symbolication result of a data address, i.e. the global or static variable containing it
+type DataSymbol struct {
+	Name    string // the variable name, e.g. "gCounter"
+	Type    string // the declared type in C syntax, e.g. "int[16]", empty if the variable is only in the symbol table
+	Start   uint64 // the runtime address of the variable
+	Size    uint64 // the size of the variable, 0 if unknown
+	Offset  uint64 // the offset of the address from Start
+	File    string // the declaration file, empty if unknown
+	Line    int    // the declaration line, 0 if unknown
+	Section string // the section of the address, e.g. "__DATA,__bss"
+}
+
+// String formats the data symbol as "name + offset (type)", e.g. "gTable + 8 (int[16])"
+func (s *DataSymbol) String() string {
+	str := fmt.Sprintf("%s + %d", s.Name, s.Offset)
+	if s.Type != "" {
+		str += " (" + s.Type + ")"
+	}
+	return str
+}
+
+// dataVariable is a variable of the DWARF debug info at a fixed address, see dwarfImage.buildVariables
+type dataVariable struct {
+	addr, size uint64
+	name, typ  string
+	file       string
+	line       int
+}
+
+// buildVariables collects the variables whose location is a DW_OP_addr or DW_OP_addrx, i.e. the globals and the
+// static variables, including the static locals of the functions and the static class members
+func (d *dwarfImage) buildVariables() {
+	d.varsBuilt = true
+	var (
+		files    []*dwarf.LineFile
+		cu       *dwarf.Entry
+		addrSize int
+	)
+	r := d.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			Log.Debugf("unable to iterate the variables: %v", err)
+			break
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			files, cu = nil, entry
+			_, addrSize = d.unitHeader(entry.Offset)
+			if lr, err := d.dwarf.LineReader(entry); err == nil && lr != nil {
+				files = lr.Files()
+			}
+			continue
+		case dwarf.TagVariable:
+		default:
+			continue
+		}
+		loc, _ := entry.Val(dwarf.AttrLocation).([]byte)
+		addr, ok := d.staticAddress(loc, cu, addrSize)
+		if !ok {
+			continue
+		}
+		v := dataVariable{addr: addr, name: entryName(d.dwarf, entry)}
+		if typeOff, ok := entryAttr(d.dwarf, entry, dwarf.AttrType).(dwarf.Offset); ok {
+			if t, err := d.dwarf.Type(typeOff); err == nil {
+				v.typ = dwarftype.Name(t)
+				if size := t.Size(); size > 0 {
+					v.size = uint64(size)
+				}
+			}
+		}
+		if line, ok := entryAttr(d.dwarf, entry, dwarf.AttrDeclLine).(int64); ok {
+			v.line = int(line)
+		}
+		if file, ok := entryAttr(d.dwarf, entry, dwarf.AttrDeclFile).(int64); ok && file >= 0 && int(file) < len(files) && files[file] != nil {
+			v.file = files[file].Name
+		}
+		if v.name != "" {
+			d.variables = append(d.variables, v)
+		}
+	}
+	sort.SliceStable(d.variables, func(i, j int) bool {
+		return d.variables[i].addr < d.variables[j].addr
+	})
+}
+
+// staticAddress returns the address of a location expression which is a single DW_OP_addr or DW_OP_addrx
+func (d *dwarfImage) staticAddress(loc []byte, cu *dwarf.Entry, addrSize int) (uint64, bool) {
+	if len(loc) == 0 {
+		return 0, false
+	}
+	switch loc[0] {
+	case dwOpAddr:
+		switch len(loc) {
+		case 9:
+			return d.order.Uint64(loc[1:]), true
+		case 5:
+			return uint64(d.order.Uint32(loc[1:])), true
+		}
+	case dwOpAddrx:
+		r := newBytesReader(loc[1:])
+		idx, err := r.ReadULEB128()
+		if err != nil || r.Len() != 0 || cu == nil {
+			return 0, false
+		}
+		addr, err := d.debugAddr(cu, addrSize, idx)
+		if err != nil {
+			Log.Debugf("unable to resolve DW_OP_addrx %d: %v", idx, err)
+			return 0, false
+		}
+		return addr, true
+	}
+	return 0, false
+}
+
+// debugAddr reads the address of __debug_addr at the index from the DW_AT_addr_base of the CU
+func (d *dwarfImage) debugAddr(cu *dwarf.Entry, addrSize int, idx uint64) (uint64, error) {
+	data := d.rawSections["debug_addr"]
+	addrBase, _ := cu.Val(dwarf.AttrAddrBase).(int64)
+	off := uint64(addrBase) + idx*uint64(addrSize)
+	if addrBase < 0 || idx > uint64(len(data))/uint64(addrSize) || off+uint64(addrSize) > uint64(len(data)) {
+		return 0, fmt.Errorf("the address index %d is out of __debug_addr", idx)
+	}
+	if addrSize == 4 {
+		return uint64(d.order.Uint32(data[off:])), nil
+	}
+	return d.order.Uint64(data[off:]), nil
+}
+
+// variable returns the variable containing the vmaddr, the ones of unknown size only contain their own address
+func (d *dwarfImage) variable(vmAddr uint64) (*dataVariable, bool) {
+	if d.dwarf == nil {
+		return nil, false
+	}
+	if !d.varsBuilt {
+		d.buildVariables()
+	}
+	idx := sort.Search(len(d.variables), func(i int) bool {
+		return d.variables[i].addr > vmAddr
+	}) - 1
+	for ; idx >= 0; idx-- {
+		v := &d.variables[idx]
+		if vmAddr < v.addr+max(v.size, 1) {
+			return v, true
+		}
+		if v.size > 0 {
+			break // the nearest variable doesn't contain it, e.g. in the padding between them
+		}
+	}
+	return nil, false
+}
+
+// AtosData resolves a runtime address in the data sections, e.g. __DATA,__data, __DATA_CONST,__const or
+// __DATA,__bss, to the variable containing it, from the DWARF variables or the data symbols of the symbol table.
+// The addresses in the code sections, e.g. __TEXT,__text, are rejected
+func (f *MachFile) AtosData(addr uint64) (*DataSymbol, error) {
+	vmAddr := addr - f.loadSlide
+	var sectionName string
+	for _, section := range f.Sections {
+		if vmAddr >= section.Addr && vmAddr < section.Addr+section.Size {
+			sectionName = section.Seg + "," + section.Name
+			if section.Flags&(sectionPureInstructions|sectionSomeInstructions) != 0 {
+				// the symbols of a code section are functions, which are resolved by Atos
+				return nil, fmt.Errorf("addr 0x%x is in the code section %s", vmAddr, sectionName)
+			}
+			break
+		}
+	}
+	if sectionName == "" {
+		return nil, fmt.Errorf("addr 0x%x is not in any section", vmAddr)
+	}
+
+	if v, ok := f.variable(vmAddr); ok {
+		return &DataSymbol{
+			Name:    v.name,
+			Type:    v.typ,
+			Start:   v.addr + f.loadSlide,
+			Size:    v.size,
+			Offset:  vmAddr - v.addr,
+			File:    v.file,
+			Line:    v.line,
+			Section: sectionName,
+		}, nil
+	}
+
+	symbol, size, err := f.dataSymbol(vmAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &DataSymbol{
+		Name:    strings.TrimPrefix(symbol.Name, "_"),
+		Start:   symbol.Value + f.loadSlide,
+		Size:    size,
+		Offset:  vmAddr - symbol.Value,
+		Section: sectionName,
+	}, nil
+}
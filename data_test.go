@@ -0,0 +1,183 @@
+package atos
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/macho"
+	"encoding/binary"
+	"testing"
+)
+
+// dataImage builds an arm64 image with __DATA,__data at 0x100004000 and __DATA,__bss at 0x100004100, the DWARF
+// variables gTable (int[16]), gCounter (int) and gName (const char *) in __data, and the data symbols of
+// the symbol table, where gBuffer of __bss is only in the symbol table
+func dataImage(t *testing.T) *MachFile {
+	le := binary.LittleEndian
+
+	abbrev := []byte{
+		1, 0x11, 1, 0x03, 0x08, 0x13, 0x05, 0, 0, // compile unit: name string, language data2
+		2, 0x24, 0, 0x03, 0x08, 0x3e, 0x0b, 0x0b, 0x0b, 0, 0, // base type: name string, encoding data1, byte size data1
+		3, 0x01, 1, 0x49, 0x13, 0, 0, // array type: type ref4
+		4, 0x21, 0, 0x37, 0x0b, 0, 0, // subrange: count data1
+		5, 0x34, 0, 0x03, 0x08, 0x49, 0x13, 0x3b, 0x0b, 0x02, 0x18, 0, 0, // variable: name, type, decl line data1, location exprloc
+		6, 0x0f, 0, 0x0b, 0x0b, 0x49, 0x13, 0, 0, // pointer type: byte size data1, type ref4
+		7, 0x26, 0, 0x49, 0x13, 0, 0, // const type: type ref4
+		0,
+	}
+	info := []byte{0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 8} // the header of DWARF 4, the unit length is patched below
+	info = append(append(info, 1), "data.c\x00"...)
+	info = le.AppendUint16(info, 0x0c)
+	intOff := uint32(len(info))
+	info = append(append(info, 2), "int\x00\x05\x04"...)
+	charOff := uint32(len(info))
+	info = append(append(info, 2), "char\x00\x06\x01"...)
+	constCharOff := uint32(len(info))
+	info = le.AppendUint32(append(info, 7), charOff)
+	ptrOff := uint32(len(info))
+	info = le.AppendUint32(append(info, 6, 8), constCharOff)
+	arrayOff := uint32(len(info))
+	info = le.AppendUint32(append(info, 3), intOff)
+	info = append(info, 4, 16, 0)
+	for _, v := range []struct {
+		name string
+		typ  uint32
+		line uint8
+		addr uint64
+	}{{"gTable", arrayOff, 3, 0x100004000}, {"gCounter", intOff, 4, 0x100004040}, {"gName", ptrOff, 5, 0x100004048}} {
+		info = append(append(info, 5), v.name...)
+		info = le.AppendUint32(append(info, 0), v.typ)
+		info = append(info, v.line, 9, dwOpAddr)
+		info = le.AppendUint64(info, v.addr)
+	}
+	info = append(info, 0)
+	le.PutUint32(info, uint32(len(info)-4))
+
+	var syms, strs []byte
+	strs = append(strs, 0)
+	for _, sym := range []struct {
+		name  string
+		sect  uint8
+		value uint64
+	}{{"_main", 1, 0x100000400}, {"_gTable", 2, 0x100004000}, {"_gCounter", 2, 0x100004040}, {"_gName", 2, 0x100004048}, {"_gBuffer", 3, 0x100004100}} {
+		syms = le.AppendUint32(syms, uint32(len(strs)))
+		syms = append(syms, nSect|nExt, sym.sect)
+		syms = le.AppendUint16(syms, 0)
+		syms = le.AppendUint64(syms, sym.value)
+		strs = append(append(strs, sym.name...), 0)
+	}
+
+	var cmds []byte
+	cmds = append(cmds, testSegment64("__TEXT", 0x100000000, 0x4000, 0, 0x4000,
+		testSection64("__text", "__TEXT", 0x100000400, 0x100, 0x400, 0x80000400, 0, 0))...)
+	cmds = append(cmds, testSegment64("__DATA", 0x100004000, 0x4000, 0x4000, 0x100,
+		testSection64("__data", "__DATA", 0x100004000, 0x100, 0x4000, 0, 0, 0),
+		testSection64("__bss", "__DATA", 0x100004100, 0x100, 0, sectionZeroFill, 0, 0))...)
+	cmds = append(cmds, testSegment64("__DWARF", 0x100008000, 0x4000, 0x8000, 0x1000,
+		testSection64("__debug_abbrev", "__DWARF", 0x100008000, uint64(len(abbrev)), 0x8000, 0, 0, 0),
+		testSection64("__debug_info", "__DWARF", 0x100008800, uint64(len(info)), 0x8800, 0, 0, 0))...)
+	cmds = le.AppendUint32(cmds, uint32(macho.LoadCmdSymtab))
+	cmds = le.AppendUint32(cmds, 24)
+	for _, v := range []uint32{0x9000, 5, 0x9000 + uint32(len(syms)), uint32(len(strs))} {
+		cmds = le.AppendUint32(cmds, v)
+	}
+
+	b := le.AppendUint32(nil, macho.Magic64)
+	b = le.AppendUint32(b, uint32(macho.CpuArm64))
+	b = le.AppendUint32(b, CpuSubTypeArm64All)
+	b = le.AppendUint32(b, uint32(macho.TypeExec))
+	b = le.AppendUint32(b, 4)
+	b = le.AppendUint32(b, uint32(len(cmds)))
+	b = le.AppendUint64(b, 0)
+	b = append(b, cmds...)
+
+	file := make([]byte, 0x9000+len(syms)+len(strs))
+	copy(file, b)
+	copy(file[0x8000:], abbrev)
+	copy(file[0x8800:], info)
+	copy(file[0x9000:], append(syms, strs...))
+	mf, err := Parse(bytes.NewReader(file), ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf.name = "data"
+	if err = mf.load(true); err != nil {
+		t.Fatal(err)
+	}
+	return mf
+}
+
+func TestAtosData(t *testing.T) {
+	mf := dataImage(t)
+	defer mf.Close()
+	mf.SetLoadAddress(0x104000000)
+
+	for addr, want := range map[uint64]DataSymbol{
+		0x104004008: {Name: "gTable", Type: "int[16]", Start: 0x104004000, Size: 64, Offset: 8, Line: 3, Section: "__DATA,__data"},
+		0x104004040: {Name: "gCounter", Type: "int", Start: 0x104004040, Size: 4, Line: 4, Section: "__DATA,__data"},
+		0x10400404c: {Name: "gName", Type: "const char *", Start: 0x104004048, Size: 8, Offset: 4, Line: 5, Section: "__DATA,__data"},
+		0x104004110: {Name: "gBuffer", Start: 0x104004100, Size: 0x100, Offset: 0x10, Section: "__DATA,__bss"}, // only in the symbol table
+	} {
+		sym, err := mf.AtosData(addr)
+		if err != nil {
+			t.Fatalf("AtosData(0x%x): %v", addr, err)
+		}
+		if *sym != want {
+			t.Errorf("AtosData(0x%x) = %+v, want %+v", addr, *sym, want)
+		}
+	}
+
+	sym, err := mf.AtosData(0x104004008)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sym.String(); got != "gTable + 8 (int[16])" {
+		t.Errorf("unexpected string %q", got)
+	}
+	if _, err = mf.AtosData(0x104003000); err == nil {
+		t.Error("expect an error of an address out of the sections")
+	}
+	if sym, err = mf.AtosData(0x104000408); err == nil {
+		t.Errorf("expect an error of an address in __TEXT,__text, got %+v", sym)
+	}
+}
+
+func TestBuildVariablesAddrx(t *testing.T) {
+	le := binary.LittleEndian
+	abbrev := []byte{
+		1, 0x11, 1, 0x03, 0x08, 0x73, 0x17, 0, 0, // compile unit: name string, addr base sec_offset
+		2, 0x24, 0, 0x03, 0x08, 0x3e, 0x0b, 0x0b, 0x0b, 0, 0, // base type: name string, encoding data1, byte size data1
+		3, 0x34, 0, 0x03, 0x08, 0x49, 0x13, 0x02, 0x18, 0, 0, // variable: name, type, location exprloc
+		0,
+	}
+	info := []byte{0, 0, 0, 0, 5, 0, 1, 8, 0, 0, 0, 0} // the header of DWARF 5, the unit length is patched below
+	info = append(append(info, 1), "data.c\x00"...)
+	info = le.AppendUint32(info, 8) // DW_AT_addr_base after the header of __debug_addr
+	intOff := uint32(len(info))
+	info = append(append(info, 2), "int\x00\x05\x04"...)
+	info = append(append(info, 3), "gCounter\x00"...)
+	info = le.AppendUint32(info, intOff)
+	info = append(info, 2, dwOpAddrx, 1)
+	info = append(append(info, 3), "gMissing\x00"...)
+	info = le.AppendUint32(info, intOff)
+	info = append(info, 2, dwOpAddrx, 9) // out of __debug_addr
+	info = append(info, 0)
+	le.PutUint32(info, uint32(len(info)-4))
+
+	addrs := []byte{0, 0, 0, 0, 5, 0, 8, 0}
+	addrs = le.AppendUint64(addrs, 0x100004000)
+	addrs = le.AppendUint64(addrs, 0x100004040)
+	le.PutUint32(addrs, uint32(len(addrs)-4))
+
+	data, err := dwarf.New(abbrev, nil, nil, info, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dwarfImage{dwarf: data, order: le, debugInfo: info, rawSections: map[string][]byte{"debug_addr": addrs}}
+	v, ok := d.variable(0x100004042)
+	if !ok || v.name != "gCounter" || v.addr != 0x100004040 || v.typ != "int" || v.size != 4 {
+		t.Fatalf("unexpected variable %+v", v)
+	}
+	if len(d.variables) != 1 {
+		t.Fatalf("unexpected variables %+v", d.variables)
+	}
+}
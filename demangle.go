@@ -0,0 +1,31 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"strings"
+
+	"github.com/ianlancetaylor/demangle"
+)
+
+const attrMIPSLinkageName dwarf.Attr = 0x2007 // DW_AT_MIPS_linkage_name, emitted by the older GCC
+
+// Demangle returns the demangled name of a C++ or Rust symbol, e.g. "foo::bar()" for "_ZN3foo3barEv",
+// the Mach-O symbols with an extra leading underscore are accepted too. Other names, e.g. the
+// Objective-C methods and the C functions, are returned as is
+func Demangle(name string) string {
+	if strings.HasPrefix(name, "__Z") || strings.HasPrefix(name, "__R") {
+		if s, err := demangle.ToString(name[1:]); err == nil {
+			return s
+		}
+	}
+	return demangle.Filter(name)
+}
+
+// linkageName returns the mangled name of a function DIE
+func linkageName(d *dwarf.Data, entry *dwarf.Entry) string {
+	if name, ok := entryAttr(d, entry, dwarf.AttrLinkageName).(string); ok {
+		return name
+	}
+	name, _ := entryAttr(d, entry, attrMIPSLinkageName).(string)
+	return name
+}
@@ -0,0 +1,31 @@
+package atos
+
+import (
+	"testing"
+)
+
+func TestDemangle(t *testing.T) {
+	cases := map[string]string{
+		"_ZN3foo3barEv":                       "foo::bar()",
+		"__ZN3foo3barEv":                      "foo::bar()",
+		"_ZNK5Crash6reportEi":                 "Crash::report(int) const",
+		"main":                                "main",
+		"-[Crasher throwUncaughtNSException]": "-[Crasher throwUncaughtNSException]",
+		"_RNvCs15kBYyAo9fc_7mycrate7example":  "mycrate::example",
+		"$s4main3fooyyF":                      "$s4main3fooyyF",
+	}
+	for mangled, want := range cases {
+		if got := Demangle(mangled); got != want {
+			t.Errorf("Demangle(%q) = %q, want %q", mangled, got, want)
+		}
+	}
+
+	symbol := &Symbol{Func: "bar", LinkageName: "_ZN3foo3barEv"}
+	if symbol.Demangled() != "foo::bar()" {
+		t.Fatalf("unexpected demangled name %s", symbol.Demangled())
+	}
+	symbol = &Symbol{File: "Sources/main.c", CompDir: "/src"}
+	if symbol.Path() != "/src/Sources/main.c" {
+		t.Fatalf("unexpected path %s", symbol.Path())
+	}
+}
@@ -0,0 +1,378 @@
+package atos
+
+import (
+	"bufio"
+	"debug/dwarf"
+	"debug/macho"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	sectionTypeMask         = 0x000000ff
+	sectionZeroFill         = 0x1        // S_ZEROFILL
+	sectionPureInstructions = 0x80000000 // S_ATTR_PURE_INSTRUCTIONS
+	sectionSomeInstructions = 0x00000400 // S_ATTR_SOME_INSTRUCTIONS
+
+	nStab = 0xe0 // N_STAB mask
+	nSect = 0x0e // N_SECT
+	nExt  = 0x01 // N_EXT
+)
+
+type breakpadLine struct {
+	addr uint64
+	size uint64
+	line int
+	file int
+}
+
+type breakpadFunc struct {
+	addr  uint64
+	size  uint64
+	name  string
+	lines []breakpadLine
+}
+
+// breakpadRegisterNames maps the DWARF register numbers to the names used by Breakpad's stack walker
+var breakpadRegisterNames = map[macho.Cpu][]string{
+	macho.Cpu386: {"$eax", "$ecx", "$edx", "$ebx", "$esp", "$ebp", "$esi", "$edi", "$eip"},
+	macho.CpuAmd64: {"$rax", "$rdx", "$rcx", "$rbx", "$rsi", "$rdi", "$rbp", "$rsp",
+		"$r8", "$r9", "$r10", "$r11", "$r12", "$r13", "$r14", "$r15", "$rip"},
+	macho.CpuArm: {"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7",
+		"r8", "r9", "r10", "r11", "r12", "sp", "lr", "pc"},
+	macho.CpuArm64: {"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7",
+		"x8", "x9", "x10", "x11", "x12", "x13", "x14", "x15",
+		"x16", "x17", "x18", "x19", "x20", "x21", "x22", "x23",
+		"x24", "x25", "x26", "x27", "x28", "x29", "x30", "sp", "pc"},
+}
+
+// ehFrameRegisterNames returns the register names of the __eh_frame numbers, which are the DWARF numbers except
+// on i386, where the __eh_frame of Darwin numbers esp 5 and ebp 4
+func ehFrameRegisterNames(cpu macho.Cpu) []string {
+	names := breakpadRegisterNames[cpu]
+	if cpu == macho.Cpu386 {
+		names = append([]string(nil), names...)
+		names[4], names[5] = names[5], names[4]
+	}
+	return names
+}
+
+// breakpadArch returns the architecture name Breakpad uses in the MODULE record
+func breakpadArch(a Arch) string {
+	if a.Cpu == macho.Cpu386 {
+		return "x86"
+	}
+	return a.String()
+}
+
+// hasSectionData reports if the section has content in the file, the sections copied
+// to a dSYM from the original binary, e.g. __TEXT,__text, are only placeholders
+func hasSectionData(s *macho.Section) bool {
+	return s.Offset != 0 && s.Flags&sectionTypeMask != sectionZeroFill
+}
+
+// WriteBreakpadSymbols writes the Breakpad text symbol file of the Mach-O file to w,
+// which is made of the MODULE, FILE, FUNC, line, PUBLIC and STACK CFI records.
+// moduleName is the name of the binary image, e.g. "App" for App.app.dSYM
+func (f *MachFile) WriteBreakpadSymbols(w io.Writer, moduleName string) error {
+	if f.dwarf == nil {
+		return errNoDWARF
+	}
+	bw := bufio.NewWriter(w)
+
+	uuid, _ := f.UUID()
+	fmt.Fprintf(bw, "MODULE mac %s %X0 %s\n", breakpadArch(f.Arch()), uuid[:], moduleName)
+
+	files, funcs, err := f.breakpadFunctions()
+	if err != nil {
+		return fmt.Errorf("unable to collect functions from DWARF: %w", err)
+	}
+	for i, name := range files {
+		fmt.Fprintf(bw, "FILE %d %s\n", i, name)
+	}
+	for _, fn := range funcs {
+		fmt.Fprintf(bw, "FUNC %x %x 0 %s\n", fn.addr-f.vmAddr, fn.size, fn.name)
+		for _, l := range fn.lines {
+			fmt.Fprintf(bw, "%x %x %d %d\n", l.addr-f.vmAddr, l.size, l.line, l.file)
+		}
+	}
+
+	for _, sym := range f.breakpadPublics(funcs) {
+		fmt.Fprintf(bw, "PUBLIC %x 0 %s\n", sym.Value-f.vmAddr, breakpadSymbolName(sym.Name))
+	}
+
+	if err = f.writeBreakpadCFI(bw); err != nil {
+		return fmt.Errorf("unable to convert __eh_frame to STACK CFI records: %w", err)
+	}
+	return bw.Flush()
+}
+
+// breakpadFunctions collects all the subprograms with their line records, sorted by address
+func (f *MachFile) breakpadFunctions() ([]string, []*breakpadFunc, error) {
+	var (
+		files     []string
+		fileIndex = make(map[string]int)
+		funcs     []*breakpadFunc
+		lines     []breakpadLine
+	)
+
+	r := f.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			lr, err := f.dwarf.LineReader(entry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to init the line table's reader: %w", err)
+			}
+			if lr == nil {
+				continue
+			}
+			var prev, le dwarf.LineEntry
+			havePrev := false
+			for {
+				if err = lr.Next(&le); err != nil {
+					if errors.Is(err, io.EOF) {
+						break
+					}
+					return nil, nil, fmt.Errorf("unable to read line table: %w", err)
+				}
+				if havePrev && le.Address > prev.Address {
+					name := prev.File.Name
+					idx, ok := fileIndex[name]
+					if !ok {
+						idx = len(files)
+						fileIndex[name] = idx
+						files = append(files, name)
+					}
+					lines = append(lines, breakpadLine{
+						addr: prev.Address,
+						size: le.Address - prev.Address,
+						line: prev.Line,
+						file: idx,
+					})
+				}
+				prev, havePrev = le, !le.EndSequence && le.File != nil
+			}
+		case dwarf.TagSubprogram:
+			ranges, err := f.dwarf.Ranges(entry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse subprogram ranges: %w", err)
+			}
+			name := breakpadFuncName(f.dwarf, entry)
+			for _, rg := range ranges {
+				if rg[1] > rg[0] {
+					funcs = append(funcs, &breakpadFunc{addr: rg[0], size: rg[1] - rg[0], name: name})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(funcs, func(i, j int) bool {
+		return funcs[i].addr < funcs[j].addr
+	})
+	sort.SliceStable(lines, func(i, j int) bool {
+		return lines[i].addr < lines[j].addr
+	})
+
+	uniq := funcs[:0]
+	for _, fn := range funcs {
+		if len(uniq) > 0 && uniq[len(uniq)-1].addr == fn.addr {
+			continue
+		}
+		uniq = append(uniq, fn)
+	}
+	funcs = uniq
+
+	for _, fn := range funcs {
+		end := fn.addr + fn.size
+		idx := sort.Search(len(lines), func(i int) bool {
+			return lines[i].addr+lines[i].size > fn.addr
+		})
+		for ; idx < len(lines) && lines[idx].addr < end; idx++ {
+			l := lines[idx]
+			if l.addr < fn.addr {
+				l.size -= fn.addr - l.addr
+				l.addr = fn.addr
+			}
+			if l.addr+l.size > end {
+				l.size = end - l.addr
+			}
+			fn.lines = append(fn.lines, l)
+		}
+	}
+	return files, funcs, nil
+}
+
+// breakpadFuncName returns the name of the FUNC record of a subprogram, the demangled linkage name like the
+// dump_syms of Breakpad, e.g. "Foo::bar(int)" rather than "bar", or DW_AT_name if there's none, e.g. of the C functions
+func breakpadFuncName(d *dwarf.Data, entry *dwarf.Entry) string {
+	if name := linkageName(d, entry); name != "" {
+		return Demangle(name)
+	}
+	return entryName(d, entry)
+}
+
+// breakpadSymbolName returns the name of the PUBLIC record of a Mach-O symbol, without the leading underscore and demangled
+func breakpadSymbolName(name string) string {
+	return Demangle(strings.TrimPrefix(name, "_"))
+}
+
+// breakpadPublics returns the defined symbols of __TEXT which are not covered by any FUNC record
+func (f *MachFile) breakpadPublics(funcs []*breakpadFunc) []*macho.Symbol {
+	var publics []*macho.Symbol
+	for _, sym := range f.symbolTable {
+		if sym.Type&nStab != 0 || sym.Type&nSect != nSect || sym.Sect == 0 || int(sym.Sect) > len(f.Sections) {
+			continue
+		}
+		if f.Sections[sym.Sect-1].Seg != "__TEXT" {
+			continue
+		}
+		idx := sort.Search(len(funcs), func(i int) bool {
+			return funcs[i].addr+funcs[i].size > sym.Value
+		})
+		if idx < len(funcs) && funcs[idx].addr <= sym.Value {
+			continue
+		}
+		publics = append(publics, sym)
+	}
+
+	// the symbol table is in descending order
+	sort.SliceStable(publics, func(i, j int) bool {
+		return publics[i].Value < publics[j].Value
+	})
+	uniq := publics[:0]
+	for _, sym := range publics {
+		if len(uniq) > 0 && uniq[len(uniq)-1].Value == sym.Value {
+			continue
+		}
+		uniq = append(uniq, sym)
+	}
+	return uniq
+}
+
+func (f *MachFile) writeBreakpadCFI(w io.Writer) error {
+	section := f.Section("__eh_frame")
+	if section == nil || !hasSectionData(section) {
+		return nil
+	}
+	data, err := sectionData(section)
+	if err != nil {
+		return err
+	}
+	ptrSize := 4
+	if f.Cpu&cpuArch64 != 0 {
+		ptrSize = 8
+	}
+	fdes, err := parseEHFrame(data, section.Addr, f.ByteOrder, ptrSize)
+	if err != nil {
+		return err
+	}
+	regNames := ehFrameRegisterNames(f.Cpu)
+
+	for _, fde := range fdes {
+		rows, err := fde.rows()
+		if err != nil {
+			Log.Debugf("skip the FDE at [0x%x]: %v", fde.PCBegin, err)
+			continue
+		}
+		ruleSets := make([]map[string]string, 0, len(rows))
+		for i := range rows {
+			rules, err := breakpadCFIRules(&rows[i], fde.cie.raReg, regNames)
+			if err != nil {
+				Log.Debugf("skip the FDE at [0x%x]: %v", fde.PCBegin, err)
+				ruleSets = nil
+				break
+			}
+			ruleSets = append(ruleSets, rules)
+		}
+		for i, rules := range ruleSets {
+			if i == 0 {
+				if _, ok := rules[".ra"]; !ok && int(fde.cie.raReg) < len(regNames) {
+					rules[".ra"] = regNames[fde.cie.raReg]
+				}
+				fmt.Fprintf(w, "STACK CFI INIT %x %x %s\n", rows[i].Addr-f.vmAddr, fde.PCEnd-fde.PCBegin, formatCFIRules(rules, nil))
+			} else if changed := formatCFIRules(rules, ruleSets[i-1]); changed != "" {
+				fmt.Fprintf(w, "STACK CFI %x %s\n", rows[i].Addr-f.vmAddr, changed)
+			}
+		}
+	}
+	return nil
+}
+
+// breakpadCFIRules translates an unwind table row to Breakpad postfix expressions keyed by register name
+func breakpadCFIRules(row *cfiRow, raReg uint64, regNames []string) (map[string]string, error) {
+	regName := func(reg uint64) (string, bool) {
+		if reg == raReg {
+			return ".ra", true
+		}
+		if int(reg) < len(regNames) {
+			return regNames[reg], true
+		}
+		return "", false
+	}
+
+	if row.CFA.Kind != cfiRuleRegister || int(row.CFA.Reg) >= len(regNames) {
+		return nil, errors.New("the CFA rule can't be expressed in Breakpad")
+	}
+	rules := map[string]string{
+		".cfa": fmt.Sprintf("%s %d +", regNames[row.CFA.Reg], row.CFA.Offset),
+	}
+	for reg, rule := range row.Regs {
+		name, ok := regName(reg)
+		if !ok {
+			continue
+		}
+		switch rule.Kind {
+		case cfiRuleOffset:
+			rules[name] = fmt.Sprintf(".cfa %d + ^", rule.Offset)
+		case cfiRuleValOffset:
+			rules[name] = fmt.Sprintf(".cfa %d +", rule.Offset)
+		case cfiRuleSameValue:
+			if int(reg) < len(regNames) {
+				rules[name] = regNames[reg]
+			}
+		case cfiRuleRegister:
+			if int(rule.Reg) < len(regNames) {
+				rules[name] = regNames[rule.Reg]
+			}
+		}
+	}
+	return rules, nil
+}
+
+// formatCFIRules formats the rules which differ from prev, .cfa and .ra go first
+func formatCFIRules(rules, prev map[string]string) string {
+	names := make([]string, 0, len(rules))
+	for name, rule := range rules {
+		if prevRule, ok := prev[name]; ok && prevRule == rule {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if strings.HasPrefix(names[i], ".") != strings.HasPrefix(names[j], ".") {
+			return strings.HasPrefix(names[i], ".")
+		}
+		return names[i] < names[j]
+	})
+	var sb strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(name)
+		sb.WriteString(": ")
+		sb.WriteString(rules[name])
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"debug/macho"
+	"strings"
+	"testing"
+)
+
+func TestWriteBreakpadSymbols(t *testing.T) {
+	mf, err := OpenMachO("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+
+	var sb strings.Builder
+	if err = mf.WriteBreakpadSymbols(&sb, "a.out"); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+
+	for _, record := range []string{
+		"MODULE mac arm64 6D5A41E144743744BFF4785083F1020E0 a.out\n",
+		"FILE 0 /Users/zy/segment.c\n",
+		"FUNC 3ee4 78 0 fib\n3ee4 10 3 0\n",
+		"FUNC 3f5c 4c 0 main\n",
+		"3f9c c 21 0\n",
+	} {
+		if !strings.Contains(out, record) {
+			t.Errorf("missing record %q", record)
+		}
+	}
+}
+
+func TestBreakpadNames(t *testing.T) {
+	method := &dwarf.Entry{Tag: dwarf.TagSubprogram, Field: []dwarf.Field{
+		{Attr: dwarf.AttrName, Val: "bar"},
+		{Attr: dwarf.AttrLinkageName, Val: "_ZN3Foo3barEi"},
+	}}
+	if name := breakpadFuncName(nil, method); name != "Foo::bar(int)" {
+		t.Errorf("unexpected FUNC name of a C++ method: %s", name)
+	}
+	cFunc := &dwarf.Entry{Tag: dwarf.TagSubprogram, Field: []dwarf.Field{{Attr: dwarf.AttrName, Val: "fib"}}}
+	if name := breakpadFuncName(nil, cFunc); name != "fib" {
+		t.Errorf("unexpected FUNC name of a C function: %s", name)
+	}
+
+	for sym, want := range map[string]string{
+		"__ZN3Foo3barEi":   "Foo::bar(int)",
+		"_main":            "main",
+		"-[Crasher crash]": "-[Crasher crash]",
+	} {
+		if name := breakpadSymbolName(sym); name != want {
+			t.Errorf("breakpadSymbolName(%s) = %s, want %s", sym, name, want)
+		}
+	}
+}
+
+func TestEHFrameRegisterNames(t *testing.T) {
+	names := ehFrameRegisterNames(macho.Cpu386)
+	if names[4] != "$ebp" || names[5] != "$esp" {
+		t.Errorf("unexpected i386 registers 4 and 5: %s %s", names[4], names[5])
+	}
+	if generic := breakpadRegisterNames[macho.Cpu386]; generic[4] != "$esp" || generic[5] != "$ebp" {
+		t.Error("the DWARF register names of i386 are modified")
+	}
+	if names = ehFrameRegisterNames(macho.CpuArm64); names[31] != "sp" {
+		t.Errorf("unexpected arm64 register 31: %s", names[31])
+	}
+}
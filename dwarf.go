@@ -1,11 +1,13 @@
 package atos
 
 import (
+	"debug/dwarf"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"sort"
+	"strings"
 )
 
 type DwarfArange struct {
@@ -64,13 +66,25 @@ func ParseDebugAranges(br *bytesReader) ([]*DwarfArange, error) {
 			bodyLength = uint64(byteOrder.Uint32(unitLen))
 		}
 
+		// the unit length doesn't include the length field itself
+		unitEnd := int64(br.Offset()-2) + int64(bodyLength)
+
 		if bodyLength == 0 {
+			if _, err = br.Seek(unitEnd, io.SeekStart); err != nil {
+				return aranges, err
+			}
 			continue // current unit is finish
 		}
 
+		// the aranges table stays at version 2 even in DWARF 5, skip the units of
+		// any other version instead of giving up the rest of the section
 		version = byteOrder.Uint16(versionBytes)
 		if version != 2 {
-			return aranges, fmt.Errorf("only support DWARF __debug_aranges version 2 now, but got %d", version)
+			Log.Debugf("skip the unsupported __debug_aranges unit of version %d at offset 0x%x", version, startOffset)
+			if _, err = br.Seek(unitEnd, io.SeekStart); err != nil {
+				return aranges, err
+			}
+			continue
 		}
 
 		if isDWARF64 {
@@ -148,6 +162,10 @@ func ParseDebugAranges(br *bytesReader) ([]*DwarfArange, error) {
 				HighPC:          address + length,
 			})
 		}
+
+		if _, err = br.Seek(unitEnd, io.SeekStart); err != nil {
+			return aranges, err
+		}
 	}
 
 	sort.Slice(aranges, func(i, j int) bool {
@@ -240,3 +258,469 @@ func GetCUBodyOffset(cuOffset uint64, debugInfoReader *bytesReader) (int, error)
 
 	return r.Offset(), nil
 }
+
+// entryName returns the name of a DIE, following DW_AT_abstract_origin and DW_AT_specification
+// for out-of-line instances and definitions which don't carry their own name
+func entryName(d *dwarf.Data, entry *dwarf.Entry) string {
+	name, _ := entryAttr(d, entry, dwarf.AttrName).(string)
+	return name
+}
+
+// entryAttr returns the attribute of a DIE, following DW_AT_abstract_origin and DW_AT_specification
+// if the DIE doesn't carry it, nil is returned if the attribute is not found
+func entryAttr(d *dwarf.Data, entry *dwarf.Entry, attr dwarf.Attr) interface{} {
+	for depth := 0; entry != nil && depth < 8; depth++ {
+		if val := entry.Val(attr); val != nil {
+			return val
+		}
+		ref, ok := entry.Val(dwarf.AttrAbstractOrigin).(dwarf.Offset)
+		if !ok {
+			if ref, ok = entry.Val(dwarf.AttrSpecification).(dwarf.Offset); !ok {
+				return nil
+			}
+		}
+		r := d.Reader()
+		r.Seek(ref)
+		var err error
+		if entry, err = r.Next(); err != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+var errNoDWARF = errors.New("no DWARF debug info loaded")
+
+// dwarfImage is the DWARF lookup machinery shared by the Mach-O and ELF backends,
+// it tracks the image load address and resolves runtime PCs to symbols
+type dwarfImage struct {
+	vmAddr         uint64
+	loadSlide      uint64
+	debugAranges   []*DwarfArange
+	debugInfo      []byte // the raw __debug_info/.debug_info, used to locate CUs from the aranges
+	dwarf          *dwarf.Data
+	dwarfReader    *dwarf.Reader
+	cuIndex        []cuRange // built on demand when a PC is not found in the aranges
+	cuIndexBuilt   bool
+	funcIndex      []funcRange // built on demand from the accelerator tables, see buildFuncIndex
+	funcIndexBuilt bool
+	appleNames     *AppleAccelTable
+	appleTypes     *AppleAccelTable
+	appleObjC      *AppleAccelTable
+	debugNames     *DebugNames
+	lineZero       LineZeroPolicy
+	order          binary.ByteOrder
+	rawSections    map[string][]byte // the raw sections of rawDWARFSections except the aranges
+	variables      []dataVariable    // the variables at fixed addresses, built on demand, see buildVariables
+	varsBuilt      bool
+}
+
+type cuRange struct {
+	lowPC  uint64
+	highPC uint64
+	offset dwarf.Offset // the offset of the CU entry
+}
+
+// dwarfSections are the raw DWARF sections which debug/dwarf doesn't expose, keyed by the name
+// without the "__"/"." prefix and the "z" of the compressed sections, e.g. "debug_aranges"
+type dwarfSections struct {
+	order   binary.ByteOrder
+	aranges [][]byte
+	data    map[string][]byte
+}
+
+var rawDWARFSections = map[string]bool{
+	"debug_aranges":  true,
+	"debug_info":     true,
+	"debug_str":      true,
+	"debug_names":    true,
+	"apple_names":    true,
+	"apple_types":    true,
+	"apple_objc":     true,
+	"debug_loc":      true,
+	"debug_loclists": true,
+	"debug_addr":     true,
+}
+
+// dwarfSectionName normalizes the Mach-O and ELF section names, e.g. "__zdebug_info" and ".debug_info" to "debug_info"
+func dwarfSectionName(name string) string {
+	name = strings.TrimLeft(name, "_.")
+	if strings.HasPrefix(name, "zdebug_") {
+		name = name[1:]
+	}
+	return name
+}
+
+func newDWARFSections(order binary.ByteOrder) *dwarfSections {
+	return &dwarfSections{order: order, data: make(map[string][]byte)}
+}
+
+func (s *dwarfSections) add(name string, b []byte) {
+	if name == "debug_aranges" {
+		s.aranges = append(s.aranges, b)
+		return
+	}
+	s.data[name] = b
+}
+
+// init sets up the DWARF data, the raw aranges sections and debug info are optional,
+// without them the CU lookup falls back to iterating all the CUs
+func (d *dwarfImage) init(data *dwarf.Data, secs *dwarfSections) {
+	d.dwarf = data
+	d.dwarfReader = data.Reader()
+	d.order = secs.order
+	d.rawSections = secs.data
+	d.debugInfo = secs.data["debug_info"]
+	for _, b := range secs.aranges {
+		ar, err := ParseDebugAranges(newBytesReader(b))
+		if err != nil {
+			Log.Debugf("unable to parse debug aranges: %v", err)
+		}
+		d.debugAranges = append(d.debugAranges, ar...)
+	}
+	if len(d.debugAranges) > 0 {
+		sort.Slice(d.debugAranges, func(i, j int) bool {
+			return d.debugAranges[i].LowPC < d.debugAranges[j].LowPC
+		})
+	}
+	d.loadAccelTables(secs)
+}
+
+func (d *dwarfImage) VMAddr() uint64 {
+	return d.vmAddr
+}
+
+func (d *dwarfImage) LoadSlide() uint64 {
+	return d.loadSlide
+}
+
+func (d *dwarfImage) SetLoadAddress(lAddr uint64) {
+	d.loadSlide = lAddr - d.vmAddr
+}
+
+func (d *dwarfImage) LoadAddress() uint64 {
+	return d.vmAddr + d.loadSlide
+}
+
+func (d *dwarfImage) SetLoadSlide(loadSlide uint64) {
+	d.loadSlide = loadSlide
+}
+
+// dwarfLocation is where a PC is in the DWARF debug info
+type dwarfLocation struct {
+	line       dwarf.LineEntry
+	compDir    string
+	files      []*dwarf.LineFile // the CU file table, referenced by DW_AT_call_file
+	subprogram *dwarf.Entry
+	ranges     [][2]uint64    // the ranges of the subprogram
+	inlined    []*dwarf.Entry // the DW_TAG_inlined_subroutine entries containing the PC, outermost first
+	inlinedRgs [][][2]uint64  // the ranges of the inlined subroutines
+	// approximate is set if the line table row of the PC has line 0 and the line is guessed by the LineZeroPolicy
+	approximate bool
+}
+
+func rangesContain(ranges [][2]uint64, addr uint64) bool {
+	for _, addrRange := range ranges {
+		if addrRange[0] <= addr && addr < addrRange[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// rangesBounds returns the lowest and the highest addresses of the ranges
+func rangesBounds(ranges [][2]uint64) (low, high uint64) {
+	for i, rg := range ranges {
+		if i == 0 || rg[0] < low {
+			low = rg[0]
+		}
+		if rg[1] > high {
+			high = rg[1]
+		}
+	}
+	return low, high
+}
+
+// locate finds the CU, the line table row, the subprogram and the inlined subroutines of the PC. The subprogram
+// is found by the function index of the accelerator tables if present, or by iterating the DIEs of the CU
+func (d *dwarfImage) locate(vmAddr uint64) (*dwarfLocation, error) {
+	var (
+		entry *dwarf.Entry
+		err   error
+	)
+	fr, indexed := d.locateByFuncIndex(vmAddr)
+	if indexed {
+		d.dwarfReader.Seek(fr.cu)
+		entry, err = d.dwarfReader.Next()
+	} else {
+		entry, err = d.LocateCUEntry(vmAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if entry.Tag != dwarf.TagCompileUnit {
+		return nil, fmt.Errorf("expect a compile unit entry but got %s", entry.Tag.String())
+	}
+	lReader, err := d.dwarf.LineReader(entry)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init the line table's reader: %w", err)
+	}
+	loc := &dwarfLocation{}
+	loc.compDir, _ = entry.Val(dwarf.AttrCompDir).(string)
+	if err = lReader.SeekPC(vmAddr, &loc.line); err != nil {
+		return nil, fmt.Errorf("unable to locate line entry: %w", err)
+	}
+	loc.files = lReader.Files()
+
+	if indexed {
+		d.dwarfReader.Seek(fr.offset)
+		if loc.subprogram, err = d.dwarfReader.Next(); err != nil {
+			return nil, fmt.Errorf("unable to read the subprogram entry at 0x%x: %w", fr.offset, err)
+		}
+		if loc.ranges, err = d.dwarf.Ranges(loc.subprogram); err != nil {
+			return nil, fmt.Errorf("unable to parse subprogram ranges: %w", err)
+		}
+	} else if loc.subprogram, loc.ranges, err = d.findSubprogram(vmAddr); err != nil {
+		return nil, err
+	}
+	if loc.subprogram.Children {
+		if loc.inlined, loc.inlinedRgs, err = d.inlinedChain(vmAddr); err != nil {
+			return nil, fmt.Errorf("unable to resolve inlined subroutines: %w", err)
+		}
+	}
+	if loc.line.Line == 0 && d.lineZero != LineZeroKeep {
+		d.fixLineZero(loc, lReader, vmAddr)
+	}
+	return loc, nil
+}
+
+// findSubprogram iterates the DIEs of the CU which the reader is positioned in for the subprogram containing
+// vmAddr, and leaves the reader at its children
+func (d *dwarfImage) findSubprogram(vmAddr uint64) (*dwarf.Entry, [][2]uint64, error) {
+	for {
+		entry, err := d.dwarfReader.Next()
+		if entry == nil && err == nil {
+			break // EOF
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to fetch CU Subprogram entry: %w", err)
+		}
+		if entry.Tag == dwarf.TagCompileUnit || entry.Tag == dwarf.TagPartialUnit { // Got next CU or PU
+			return nil, nil, fmt.Errorf("unable to find the target subprogram entry cause current CU has reached the end")
+		}
+		if entry.Tag == dwarf.TagSubprogram {
+			ranges, err := d.dwarf.Ranges(entry)
+			if err != nil {
+				return nil, nil, fmt.Errorf("unable to parse subprogram ranges: %w", err)
+			}
+			if rangesContain(ranges, vmAddr) {
+				return entry, ranges, nil
+			}
+		}
+	}
+
+	return nil, nil, fmt.Errorf("unable to find subprogram entry")
+}
+
+// inlinedChain walks the children of the subprogram which the reader is positioned at,
+// and collects the inlined subroutines containing addr with their ranges, the pre-order walk makes the outer ones go first
+func (d *dwarfImage) inlinedChain(addr uint64) ([]*dwarf.Entry, [][][2]uint64, error) {
+	var (
+		chain  []*dwarf.Entry
+		ranges [][][2]uint64
+	)
+	for depth := 1; depth > 0; {
+		entry, err := d.dwarfReader.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			depth--
+			continue
+		}
+		if entry.Tag == dwarf.TagInlinedSubroutine {
+			rgs, err := d.dwarf.Ranges(entry)
+			if err != nil {
+				return nil, nil, err
+			}
+			if rangesContain(rgs, addr) {
+				chain = append(chain, entry)
+				ranges = append(ranges, rgs)
+			}
+		}
+		if entry.Children {
+			depth++
+		}
+	}
+	return chain, ranges, nil
+}
+
+// entryPC returns the entry address of a subprogram or an inlined subroutine, i.e. DW_AT_entry_pc if present,
+// otherwise DW_AT_low_pc or the start of the first range, which isn't the lowest address of a function split
+// into a hot part and a cold part below it
+func entryPC(entry *dwarf.Entry, ranges [][2]uint64) uint64 {
+	var base uint64
+	if lowPC, ok := entry.Val(dwarf.AttrLowpc).(uint64); ok {
+		base = lowPC
+	} else if len(ranges) > 0 {
+		base = ranges[0][0]
+	}
+	switch v := entry.Val(dwarf.AttrEntrypc).(type) {
+	case uint64:
+		return v
+	case int64: // DWARF 5 allows an offset from the base address
+		return base + uint64(v)
+	}
+	return base
+}
+
+// funcSymbol makes the symbol of a subprogram or an inlined subroutine with its runtime bounds
+func (d *dwarfImage) funcSymbol(entry *dwarf.Entry, ranges [][2]uint64, line *dwarf.LineEntry, compDir string, pc uint64) *Symbol {
+	sym := newSymbol(entryName(d.dwarf, entry), line, compDir)
+	if name := linkageName(d.dwarf, entry); name != sym.Func {
+		sym.LinkageName = name
+	}
+	if low, high := rangesBounds(ranges); high > low {
+		sym.setFuncRange(entryPC(entry, ranges)+d.loadSlide, high+d.loadSlide, pc)
+	}
+	return sym
+}
+
+func (d *dwarfImage) Atos(pc uint64) (*Symbol, error) {
+	loc, err := d.locate(pc - d.loadSlide)
+	if err != nil {
+		return nil, err
+	}
+	sym := d.funcSymbol(loc.subprogram, loc.ranges, &loc.line, loc.compDir, pc)
+	sym.Approximate = loc.approximate
+	return sym, nil
+}
+
+// Frames resolves the PC to the inlined call chain, the innermost inlined function goes first,
+// each outer frame is located at the call site of the inner one
+func (d *dwarfImage) Frames(pc uint64) ([]*Symbol, error) {
+	loc, err := d.locate(pc - d.loadSlide)
+	if err != nil {
+		return nil, err
+	}
+
+	frames := make([]*Symbol, 0, len(loc.inlined)+1)
+	line := &loc.line
+	for i := len(loc.inlined) - 1; i >= 0; i-- {
+		inlined := loc.inlined[i]
+		sym := d.funcSymbol(inlined, loc.inlinedRgs[i], line, loc.compDir, pc)
+		sym.Approximate = line == &loc.line && loc.approximate
+		frames = append(frames, sym)
+
+		callSite := &dwarf.LineEntry{Address: loc.line.Address}
+		if callLine, ok := inlined.Val(dwarf.AttrCallLine).(int64); ok {
+			callSite.Line = int(callLine)
+		}
+		if callColumn, ok := inlined.Val(dwarf.AttrCallColumn).(int64); ok {
+			callSite.Column = int(callColumn)
+		}
+		if callFile, ok := inlined.Val(dwarf.AttrCallFile).(int64); ok && callFile >= 0 && int(callFile) < len(loc.files) {
+			callSite.File = loc.files[callFile]
+		}
+		if callSite.File == nil {
+			callSite.File = line.File
+		}
+		line = callSite
+	}
+	sym := d.funcSymbol(loc.subprogram, loc.ranges, line, loc.compDir, pc)
+	sym.Approximate = line == &loc.line && loc.approximate
+	return append(frames, sym), nil
+}
+
+func (d *dwarfImage) FastLocateCUEntry(addr uint64) (*dwarf.Entry, error) {
+	if len(d.debugAranges) == 0 {
+		return nil, fmt.Errorf("no debug aranges available")
+	}
+	idx, found := sort.Find(len(d.debugAranges), func(i int) int {
+		if d.debugAranges[i].LowPC <= addr && d.debugAranges[i].HighPC >= addr {
+			return 0
+		}
+		if d.debugAranges[i].LowPC > addr {
+			return -1
+		}
+		return 1
+	})
+	if found {
+		if d.debugInfo == nil {
+			return nil, fmt.Errorf("no debug info section available")
+		}
+		cuBodyOff, err := GetCUBodyOffset(d.debugAranges[idx].CUOffset, newBytesReader(d.debugInfo))
+		if err != nil {
+			return nil, fmt.Errorf("unable to locate CU by CU offset: %w", err)
+		}
+		d.dwarfReader.Seek(dwarf.Offset(cuBodyOff))
+		return d.dwarfReader.Next()
+	}
+	return nil, fmt.Errorf("unable to locate CU via __debug_arrages section cause the target PC is not in any PC ranges")
+}
+
+// buildCUIndex collects the PC ranges of all CUs from their DW_AT_low_pc/DW_AT_high_pc or DW_AT_ranges,
+// which resolves DW_FORM_addrx through __debug_addr and DWARF 5 range lists through __debug_rnglists.
+// It covers the CUs missing from __debug_aranges, e.g. clang doesn't emit the aranges by default since DWARF 5
+func (d *dwarfImage) buildCUIndex() {
+	d.cuIndexBuilt = true
+	r := d.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			Log.Debugf("unable to iterate CUs: %v", err)
+			break
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == dwarf.TagCompileUnit || entry.Tag == dwarf.TagPartialUnit {
+			ranges, err := d.dwarf.Ranges(entry)
+			if err != nil {
+				Log.Debugf("unable to parse the ranges of CU at 0x%x: %v", entry.Offset, err)
+			}
+			for _, rg := range ranges {
+				if rg[1] > rg[0] {
+					d.cuIndex = append(d.cuIndex, cuRange{lowPC: rg[0], highPC: rg[1], offset: entry.Offset})
+				}
+			}
+		}
+		r.SkipChildren()
+	}
+	sort.Slice(d.cuIndex, func(i, j int) bool {
+		return d.cuIndex[i].lowPC < d.cuIndex[j].lowPC
+	})
+}
+
+func (d *dwarfImage) locateByCUIndex(addr uint64) (*dwarf.Entry, error) {
+	if !d.cuIndexBuilt {
+		d.buildCUIndex()
+	}
+	idx := sort.Search(len(d.cuIndex), func(i int) bool {
+		return d.cuIndex[i].lowPC > addr
+	}) - 1
+	if idx < 0 || addr >= d.cuIndex[idx].highPC {
+		return nil, fmt.Errorf("the target PC is not in any CU ranges")
+	}
+	d.dwarfReader.Seek(d.cuIndex[idx].offset)
+	return d.dwarfReader.Next()
+}
+
+func (d *dwarfImage) LocateCUEntry(addr uint64) (*dwarf.Entry, error) {
+	if len(d.debugAranges) > 0 {
+		entry, err := d.FastLocateCUEntry(addr)
+		if err == nil {
+			return entry, nil
+		}
+		Log.Debugf("unable to seek CU for addr [0x%x] via __debug_aranges(reason: %v), try the CU ranges", addr, err)
+	}
+	entry, err := d.locateByCUIndex(addr)
+	if err == nil {
+		return entry, nil
+	}
+	Log.Debugf("unable to seek CU for addr [0x%x] via the CU ranges(reason: %v), try to iterate all CUs", addr, err)
+	return d.dwarfReader.SeekPC(addr)
+}
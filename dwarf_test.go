@@ -0,0 +1,117 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"testing"
+)
+
+// arangesUnit builds a 32-bit little-endian __debug_aranges unit with 8 bytes addresses
+func arangesUnit(version uint16, cuOffset uint32, ranges ...[2]uint64) []byte {
+	le := binary.LittleEndian
+	body := le.AppendUint16(nil, version)
+	body = le.AppendUint32(body, cuOffset)
+	body = append(body, 8, 0)       // address size, segment selector size
+	body = append(body, 0, 0, 0, 0) // pad the header to 16 bytes
+	for _, rg := range append(ranges, [2]uint64{}) {
+		body = le.AppendUint64(body, rg[0])
+		body = le.AppendUint64(body, rg[1])
+	}
+	return append(le.AppendUint32(nil, uint32(len(body))), body...)
+}
+
+func TestParseDebugArangesSkipUnknownVersion(t *testing.T) {
+	var data []byte
+	data = append(data, arangesUnit(2, 0x0, [2]uint64{0x2000, 0x10})...)
+	data = append(data, arangesUnit(3, 0x100, [2]uint64{0x3000, 0x10})...)
+	data = append(data, arangesUnit(2, 0x200, [2]uint64{0x1000, 0x20}, [2]uint64{0x4000, 0x8})...)
+
+	aranges, err := ParseDebugAranges(newBytesReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aranges) != 3 {
+		t.Fatalf("expect 3 aranges, got %d", len(aranges))
+	}
+	want := []DwarfArange{
+		{CUOffset: 0x200, LowPC: 0x1000, HighPC: 0x1020},
+		{CUOffset: 0x0, LowPC: 0x2000, HighPC: 0x2010},
+		{CUOffset: 0x200, LowPC: 0x4000, HighPC: 0x4008},
+	}
+	for i, ar := range aranges {
+		if *ar != want[i] {
+			t.Errorf("arange %d: got %+v, want %+v", i, *ar, want[i])
+		}
+	}
+}
+
+// testdata/inline-noaranges.elf is built by "gcc -gdwarf-5 -O2" and stripped of .debug_aranges,
+// the CU is located by its DW_AT_ranges in .debug_rnglists
+func TestLocateCUWithoutAranges(t *testing.T) {
+	ef, err := OpenELF("testdata/inline-noaranges.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+
+	if len(ef.debugAranges) != 0 {
+		t.Fatal("expect no aranges")
+	}
+	symbol, err := ef.Atos(0x1165)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "compute" || symbol.Line != 16 {
+		t.Fatalf("unexpected symbol: %+v", symbol)
+	}
+	if !ef.cuIndexBuilt || len(ef.cuIndex) < 2 {
+		t.Fatalf("expect the CU index built from the range lists, got %+v", ef.cuIndex)
+	}
+}
+
+// testdata/dwarf5.o is assembled from testdata/dwarf5.s by
+// "llvm-mc -triple arm64-apple-macos11 -filetype=obj -g -dwarf-version=5"
+func TestMachODWARF5(t *testing.T) {
+	mf, err := OpenMachO("testdata/dwarf5.o", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+
+	entry, err := mf.LocateCUEntry(0x14)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := entry.Val(dwarf.AttrName).(string); name != "dwarf5.s" {
+		t.Fatalf("unexpected CU name %q", name) // DW_FORM_line_strp from __debug_line_str
+	}
+	lr, err := mf.dwarf.LineReader(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var le dwarf.LineEntry
+	if err = lr.SeekPC(0x14, &le); err != nil {
+		t.Fatal(err)
+	}
+	if le.Line != 14 || le.File.Name != "/src/dwarf5.s" {
+		t.Fatalf("unexpected line entry %s:%d", le.File.Name, le.Line)
+	}
+}
+
+func TestEntryPC(t *testing.T) {
+	// a function split into a hot part at 0x2000 and a cold part at 0x1000
+	ranges := [][2]uint64{{0x2000, 0x2100}, {0x1000, 0x1040}}
+	for _, tc := range []struct {
+		fields []dwarf.Field
+		want   uint64
+	}{
+		{nil, 0x2000},
+		{[]dwarf.Field{{Attr: dwarf.AttrLowpc, Val: uint64(0x2000), Class: dwarf.ClassAddress}}, 0x2000},
+		{[]dwarf.Field{{Attr: dwarf.AttrEntrypc, Val: uint64(0x2010), Class: dwarf.ClassAddress}}, 0x2010},
+		{[]dwarf.Field{{Attr: dwarf.AttrEntrypc, Val: int64(8), Class: dwarf.ClassConstant}}, 0x2008},
+	} {
+		if got := entryPC(&dwarf.Entry{Tag: dwarf.TagSubprogram, Field: tc.fields}, ranges); got != tc.want {
+			t.Errorf("entryPC(%v) = 0x%x, want 0x%x", tc.fields, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package dwarftype renders the DWARF types as C declarations, e.g. "const char *name" or "int (*handler)(int)",
+// and dumps the layouts of the structs, classes and unions with the offsets and sizes of their members
+package dwarftype
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// the attributes of the Objective-C and Swift types
+const (
+	attrAppleRuntimeClass dwarf.Attr = 0x3fe6 // DW_AT_APPLE_runtime_class, the language of an ObjC or Swift class
+	langObjC                         = 0x10   // DW_LANG_ObjC
+	langObjCPlusPlus                 = 0x11   // DW_LANG_ObjC_plus_plus
+)
+
+// Name formats a type in C syntax, e.g. "int[16]", "const char *", "int (*)(int)" or "struct Point"
+func Name(t dwarf.Type) string {
+	return Declare(t, "")
+}
+
+// Declare formats the declaration of a variable or a member of the type, e.g. "int matrix[2][3]" or "int (*handler)(int)"
+func Declare(t dwarf.Type, name string) string {
+	switch t := t.(type) {
+	case *dwarf.ArrayType:
+		dim := "[]"
+		if t.Count >= 0 {
+			dim = "[" + strconv.FormatInt(t.Count, 10) + "]"
+		}
+		return Declare(t.Type, name+dim)
+	case *dwarf.PtrType:
+		switch t.Type.(type) {
+		case *dwarf.FuncType, *dwarf.ArrayType:
+			return Declare(t.Type, "(*"+name+")")
+		}
+		return Declare(t.Type, "*"+name)
+	case *dwarf.QualType:
+		if _, ok := t.Type.(*dwarf.PtrType); ok {
+			// a const pointer, e.g. "char *const p"
+			return Declare(t.Type, t.Qual+" "+name)
+		}
+		return t.Qual + " " + Declare(t.Type, name)
+	case *dwarf.FuncType:
+		params := make([]string, 0, len(t.ParamType))
+		for _, p := range t.ParamType {
+			params = append(params, Name(p))
+		}
+		if len(params) == 0 {
+			params = append(params, "void")
+		}
+		return Declare(t.ReturnType, name+"("+strings.Join(params, ", ")+")")
+	case *dwarf.DotDotDotType:
+		return "..."
+	}
+	return join(baseName(t), name)
+}
+
+// baseName formats the types which aren't composed of other types
+func baseName(t dwarf.Type) string {
+	switch t := t.(type) {
+	case nil, *dwarf.VoidType:
+		return "void"
+	case *dwarf.StructType:
+		if t.StructName == "" {
+			return "(anonymous " + t.Kind + ")"
+		}
+		return t.Kind + " " + t.StructName
+	case *dwarf.EnumType:
+		if t.EnumName == "" {
+			return "(anonymous enum)"
+		}
+		return "enum " + t.EnumName
+	case *dwarf.TypedefType:
+		return t.Name
+	}
+	return t.String()
+}
+
+// join puts a declarator after the type, e.g. "int" and "*p", without a space before an array dimension
+func join(typ, declarator string) string {
+	if declarator == "" || declarator[0] == '[' {
+		return typ + declarator
+	}
+	return typ + " " + declarator
+}
+
+// Printer dumps the types of a DWARF debug info, e.g. the dwarf.Data of a Mach-O or ELF file
+type Printer struct {
+	data *dwarf.Data
+}
+
+func NewPrinter(data *dwarf.Data) *Printer {
+	return &Printer{data: data}
+}
+
+// Layout dumps the type of the DIE at the offset. A struct, class or union has its base classes and members with
+// their offsets and sizes, the holes between them and the padding at the end, e.g.
+//
+//	struct Point {                      // 8 bytes
+//		/* 0x0000       4 */ int x;
+//		/* 0x0004       4 */ int y;
+//	};
+//
+// An enum has its enumerators, a typedef is followed by the layout of the type it names
+func (p *Printer) Layout(off dwarf.Offset) (string, error) {
+	var sb strings.Builder
+	for depth := 0; depth < 8; depth++ {
+		entry, err := p.entry(off)
+		if err != nil {
+			return "", err
+		}
+		t, err := p.data.Type(off)
+		if err != nil {
+			return "", fmt.Errorf("unable to read the type at 0x%x: %w", off, err)
+		}
+		switch t := t.(type) {
+		case *dwarf.TypedefType:
+			next, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+			if !ok || !aggregate(t.Type) {
+				fmt.Fprintf(&sb, "%-36s// %d bytes\n", "typedef "+Declare(t.Type, t.Name)+";", t.Size())
+				return sb.String(), nil
+			}
+			sb.WriteString("typedef " + Declare(t.Type, t.Name) + ";\n")
+			off = next
+			continue
+		case *dwarf.QualType:
+			next, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+			if !ok {
+				return sb.String(), nil
+			}
+			off = next
+			continue
+		case *dwarf.StructType:
+			if err = p.structLayout(&sb, entry, t); err != nil {
+				return "", err
+			}
+		case *dwarf.EnumType:
+			fmt.Fprintf(&sb, "%-36s// %d bytes\n", baseName(t)+" {", t.ByteSize)
+			for _, v := range t.Val {
+				fmt.Fprintf(&sb, "\t%s = %d,\n", v.Name, v.Val)
+			}
+			sb.WriteString("};\n")
+		default:
+			fmt.Fprintf(&sb, "%-36s// %d bytes\n", Name(t)+";", t.Size())
+		}
+		return sb.String(), nil
+	}
+	return "", fmt.Errorf("too many typedefs from 0x%x", off)
+}
+
+// aggregate reports if the type, through the typedefs and the qualifiers, has a layout of its own, i.e. a struct or an enum
+func aggregate(t dwarf.Type) bool {
+	for {
+		switch tt := t.(type) {
+		case *dwarf.TypedefType:
+			t = tt.Type
+		case *dwarf.QualType:
+			t = tt.Type
+		case *dwarf.StructType, *dwarf.EnumType:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (p *Printer) entry(off dwarf.Offset) (*dwarf.Entry, error) {
+	r := p.data.Reader()
+	r.Seek(off)
+	entry, err := r.Next()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the DIE at 0x%x: %w", off, err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("no DIE at 0x%x", off)
+	}
+	return entry, nil
+}
+
+// baseClass is a DW_TAG_inheritance of a class, i.e. a C++ base class or an Objective-C superclass
+type baseClass struct {
+	typ    dwarf.Type
+	offset int64
+}
+
+// baseClasses reads the DW_TAG_inheritance children of a class, which dwarf.StructType doesn't keep
+func (p *Printer) baseClasses(entry *dwarf.Entry) ([]baseClass, error) {
+	if !entry.Children {
+		return nil, nil
+	}
+	r := p.data.Reader()
+	r.Seek(entry.Offset)
+	if _, err := r.Next(); err != nil {
+		return nil, err
+	}
+	var bases []baseClass
+	for {
+		child, err := r.Next()
+		if err != nil {
+			return nil, err
+		}
+		if child == nil || child.Tag == 0 {
+			return bases, nil
+		}
+		if child.Tag == dwarf.TagInheritance {
+			typeOff, ok := child.Val(dwarf.AttrType).(dwarf.Offset)
+			if !ok {
+				continue
+			}
+			t, err := p.data.Type(typeOff)
+			if err != nil {
+				return nil, err
+			}
+			offset, _ := child.Val(dwarf.AttrDataMemberLoc).(int64)
+			bases = append(bases, baseClass{typ: t, offset: offset})
+		}
+		if child.Children {
+			r.SkipChildren()
+		}
+	}
+}
+
+func (p *Printer) structLayout(sb *strings.Builder, entry *dwarf.Entry, t *dwarf.StructType) error {
+	bases, err := p.baseClasses(entry)
+	if err != nil {
+		return fmt.Errorf("unable to read the base classes of %s: %w", t.StructName, err)
+	}
+	lang, _ := entry.Val(attrAppleRuntimeClass).(int64)
+	objc := lang == langObjC || lang == langObjCPlusPlus
+
+	header := baseName(t)
+	if objc {
+		header = "@interface " + t.StructName
+	}
+	for i, base := range bases {
+		sep := ", "
+		if i == 0 {
+			sep = " : "
+		}
+		name := base.typ.String()
+		if st, ok := base.typ.(*dwarf.StructType); ok {
+			name = st.StructName
+		}
+		header += sep + name
+	}
+	if t.Incomplete {
+		sb.WriteString(header + "; // declaration\n")
+		return nil
+	}
+	if linkageName, ok := entry.Val(dwarf.AttrLinkageName).(string); ok {
+		header += " /* " + linkageName + " */" // e.g. the mangled name of a Swift type
+	}
+	fmt.Fprintf(sb, "%-36s// %d bytes\n", header+" {", t.ByteSize)
+
+	var end int64
+	member := func(offset string, size int64, decl string) {
+		fmt.Fprintf(sb, "\t/* %-9s %4d */ %s;\n", offset, size, decl)
+	}
+	hole := func(start int64) {
+		if t.Kind != "union" && start > end {
+			fmt.Fprintf(sb, "\t/* XXX %d bytes hole */\n", start-end)
+		}
+	}
+	for _, base := range bases {
+		name := baseName(base.typ)
+		if st, ok := base.typ.(*dwarf.StructType); ok && objc {
+			name = st.StructName // the superclass of an Objective-C class isn't a struct
+		}
+		hole(base.offset)
+		member(fmt.Sprintf("0x%04x", base.offset), base.typ.Size(), name+" (base class)")
+		end = max(end, base.offset+max(base.typ.Size(), 0))
+	}
+	for _, f := range t.Field {
+		if f.BitSize > 0 {
+			bitOffset := f.DataBitOffset
+			if bitOffset == 0 && f.BitOffset != 0 {
+				// DWARF 2 counts the bits from the most significant bit of the storage unit of ByteSize
+				bitOffset = f.ByteOffset*8 + f.ByteSize*8 - f.BitOffset - f.BitSize
+			}
+			size := f.ByteSize
+			if size <= 0 {
+				size = max(f.Type.Size(), 1)
+			}
+			// the offset of the storage unit, the unused bits of which aren't a hole
+			start := bitOffset / (size * 8) * size
+			hole(start)
+			member(fmt.Sprintf("0x%04x:%d", start, bitOffset-start*8), size, fmt.Sprintf("%s : %d", Declare(f.Type, f.Name), f.BitSize))
+			end = max(end, start+size)
+			continue
+		}
+		hole(f.ByteOffset)
+		size := f.Type.Size()
+		member(fmt.Sprintf("0x%04x", f.ByteOffset), size, Declare(f.Type, f.Name))
+		end = max(end, f.ByteOffset+max(size, 0))
+	}
+	if t.Kind != "union" && t.ByteSize > end {
+		fmt.Fprintf(sb, "\t/* XXX %d bytes padding */\n", t.ByteSize-end)
+	}
+	if objc {
+		sb.WriteString("@end\n")
+	} else {
+		sb.WriteString("};\n")
+	}
+	return nil
+}
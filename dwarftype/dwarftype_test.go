@@ -0,0 +1,168 @@
+package dwarftype
+
+import (
+	"debug/dwarf"
+	"debug/elf"
+	"encoding/binary"
+	"testing"
+)
+
+func TestDeclare(t *testing.T) {
+	intType := &dwarf.IntType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 4, Name: "int"}}}
+	charType := &dwarf.CharType{BasicType: dwarf.BasicType{CommonType: dwarf.CommonType{ByteSize: 1, Name: "char"}}}
+	matrix := &dwarf.ArrayType{Type: &dwarf.ArrayType{Type: intType, Count: 4}, Count: 2}
+	handler := &dwarf.FuncType{ReturnType: intType, ParamType: []dwarf.Type{intType}}
+	for _, tc := range []struct {
+		typ        dwarf.Type
+		name, want string
+	}{
+		{intType, "", "int"},
+		{matrix, "", "int[2][4]"},
+		{matrix, "m", "int m[2][4]"},
+		{&dwarf.PtrType{Type: &dwarf.QualType{Qual: "const", Type: charType}}, "", "const char *"},
+		{&dwarf.QualType{Qual: "const", Type: &dwarf.PtrType{Type: charType}}, "p", "char *const p"},
+		{&dwarf.PtrType{}, "", "void *"},
+		{&dwarf.PtrType{Type: &dwarf.PtrType{Type: intType}}, "argv", "int **argv"},
+		{&dwarf.StructType{Kind: "struct", StructName: "Foo"}, "", "struct Foo"},
+		{handler, "", "int (int)"},
+		{&dwarf.PtrType{Type: handler}, "", "int (*)(int)"},
+		{&dwarf.PtrType{Type: handler}, "handler", "int (*handler)(int)"},
+		{&dwarf.PtrType{Type: matrix}, "pm", "int (*pm)[2][4]"},
+		{&dwarf.FuncType{}, "f", "void f(void)"},
+	} {
+		if got := Declare(tc.typ, tc.name); got != tc.want {
+			t.Errorf("Declare(%s, %q) = %q, want %q", tc.typ, tc.name, got, tc.want)
+		}
+	}
+}
+
+// testdata/types.elf is built from testdata/types.cc by "g++ -g -O0 -fdebug-prefix-map=$PWD=/src"
+func TestLayout(t *testing.T) {
+	f, err := elf.Open("../testdata/types.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := f.DWARF()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	types := make(map[string]dwarf.Offset)
+	r := data.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagStructType, dwarf.TagTypedef, dwarf.TagEnumerationType, dwarf.TagUnionType:
+			if name, ok := entry.Val(dwarf.AttrName).(string); ok {
+				types[name] = entry.Offset
+			}
+		}
+	}
+
+	p := NewPrinter(data)
+	for name, want := range map[string]string{
+		"Widget": `struct Widget : Base {              // 96 bytes
+	/* 0x0000      16 */ struct Base (base class);
+	/* 0x0010       1 */ char tag;
+	/* XXX 3 bytes hole */
+	/* 0x0014       8 */ Point_t origin;
+	/* 0x001c:0     4 */ unsigned int flags : 3;
+	/* 0x001c:3     4 */ unsigned int visible : 1;
+	/* 0x0020       8 */ const char *name;
+	/* 0x0028      24 */ int matrix[2][3];
+	/* 0x0040       8 */ handler_t handler;
+	/* 0x0048       4 */ enum Color color;
+	/* XXX 4 bytes hole */
+	/* 0x0050       8 */ union Value value;
+	/* 0x0058       8 */ struct Widget *next;
+};
+`,
+		"Point_t": `typedef struct Point Point_t;
+struct Point {                      // 8 bytes
+	/* 0x0000       4 */ int x;
+	/* 0x0004       4 */ int y;
+};
+`,
+		"Color": `enum Color {                        // 4 bytes
+	Red = 0,
+	Green = 1,
+	Blue = 4,
+};
+`,
+		"handler_t": "typedef int (*handler_t)(int);      // 8 bytes\n",
+	} {
+		off, ok := types[name]
+		if !ok {
+			t.Fatalf("no type %s", name)
+		}
+		got, err := p.Layout(off)
+		if err != nil {
+			t.Fatalf("Layout(%s): %v", name, err)
+		}
+		if got != want {
+			t.Errorf("Layout(%s):\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
+// objcData builds the DWARF of the Objective-C classes NSObject { Class isa; } and Widget : NSObject { int _count; },
+// which are marked by DW_AT_APPLE_runtime_class like clang does
+func objcData(t *testing.T) (*dwarf.Data, dwarf.Offset) {
+	le := binary.LittleEndian
+	abbrev := []byte{
+		1, 0x11, 1, 0x03, 0x08, 0x13, 0x05, 0, 0, // compile unit: name string, language data2
+		2, 0x13, 1, 0x03, 0x08, 0x0b, 0x0b, 0xe6, 0x7f, 0x0b, 0, 0, // class: name, byte size data1, runtime class data1
+		3, 0x1c, 0, 0x49, 0x13, 0x38, 0x0b, 0, 0, // inheritance: type ref4, member location data1
+		4, 0x0d, 0, 0x03, 0x08, 0x49, 0x13, 0x38, 0x0b, 0, 0, // member: name, type ref4, member location data1
+		5, 0x24, 0, 0x03, 0x08, 0x3e, 0x0b, 0x0b, 0x0b, 0, 0, // base type: name string, encoding data1, byte size data1
+		6, 0x0f, 0, 0x0b, 0x0b, 0, 0, // pointer type: byte size data1
+		0,
+	}
+	info := []byte{0, 0, 0, 0, 4, 0, 0, 0, 0, 0, 8} // the header of DWARF 4, the unit length is patched below
+	info = append(append(info, 1), "widget.m\x00"...)
+	info = le.AppendUint16(info, langObjC)
+	intOff := uint32(len(info))
+	info = append(append(info, 5), "int\x00\x05\x04"...)
+	ptrOff := uint32(len(info))
+	info = append(info, 6, 8)
+	nsObjectOff := uint32(len(info))
+	info = append(append(info, 2), "NSObject\x00\x08\x10"...)
+	info = append(append(info, 4), "isa\x00"...)
+	info = append(le.AppendUint32(info, ptrOff), 0, 0)
+	widgetOff := uint32(len(info))
+	info = append(append(info, 2), "Widget\x00\x10\x10"...)
+	info = append(le.AppendUint32(append(info, 3), nsObjectOff), 0)
+	info = append(append(info, 4), "_count\x00"...)
+	info = append(le.AppendUint32(info, intOff), 8, 0, 0)
+	le.PutUint32(info, uint32(len(info)-4))
+
+	data, err := dwarf.New(abbrev, nil, nil, info, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, dwarf.Offset(widgetOff)
+}
+
+func TestObjCLayout(t *testing.T) {
+	data, widget := objcData(t)
+	got, err := NewPrinter(data).Layout(widget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `@interface Widget : NSObject {      // 16 bytes
+	/* 0x0000       8 */ NSObject (base class);
+	/* 0x0008       4 */ int _count;
+	/* XXX 4 bytes padding */
+@end
+`
+	if got != want {
+		t.Errorf("Layout(Widget):\n%s\nwant:\n%s", got, want)
+	}
+}
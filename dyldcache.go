@@ -0,0 +1,676 @@
+package atos
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// dyldCacheMagic prefixes the magic of the dyld shared caches, e.g. "dyld_v1  arm64e"
+const dyldCacheMagic = "dyld_v1"
+
+// the offsets of the dyld_cache_header fields, the header grows with the dyld versions,
+// and mappingOffset tells the size of the header, i.e. which fields are present
+const (
+	dyldOffMappingOffset       = 16
+	dyldOffImagesOffsetOld     = 24
+	dyldOffLocalSymbolsOffset  = 72
+	dyldOffUUID                = 88
+	dyldOffImagesTextOffset    = 136
+	dyldOffSubCacheArrayOffset = 392
+	dyldOffSymbolFileUUID      = 400
+	dyldOffImagesOffset        = 448
+	dyldOffCacheSubType        = 456 // the subcache entries have a file suffix since this field
+)
+
+// DyldCacheImage is a dylib in a dyld shared cache
+type DyldCacheImage struct {
+	Path    string // the install path, e.g. "/usr/lib/libobjc.A.dylib"
+	Address uint64 // the unslid address of the Mach-O header
+	UUID    [16]byte
+}
+
+// dyldCacheMapping maps a range of the shared region to a file of the cache
+type dyldCacheMapping struct {
+	address, size, fileOffset uint64
+	file                      *os.File
+}
+
+// DyldCache is a dyld shared cache, e.g. dyld_shared_cache_arm64e, with its subcaches
+// (.1, .2 or .01, .02 since iOS 16) and the .symbols file of the local symbols since iOS 15
+type DyldCache struct {
+	path     string
+	arch     Arch
+	uuid     [16]byte
+	order    binary.ByteOrder
+	files    []*os.File
+	mappings []dyldCacheMapping
+	images   []DyldCacheImage
+
+	// the local symbols, which are stripped from the symbol tables of the dylibs
+	localSymbols     *os.File
+	localSymbolsOff  uint64
+	localEntries64   bool   // dylibOffset of the entries is a 64-bit VM offset instead of a file offset
+	baseAddress      uint64 // the address of the first mapping, the base of the VM offsets
+	mainFileMappings []dyldCacheMapping
+}
+
+// dyldCacheHeader is the part of dyld_cache_header used for the lookups
+type dyldCacheHeader struct {
+	raw           []byte
+	order         binary.ByteOrder
+	mappingOffset uint32
+}
+
+func (h *dyldCacheHeader) has(off, size int) bool {
+	return int(h.mappingOffset) >= off+size && len(h.raw) >= off+size
+}
+
+func (h *dyldCacheHeader) uint32(off int) uint32 {
+	if !h.has(off, 4) {
+		return 0
+	}
+	return h.order.Uint32(h.raw[off:])
+}
+
+func (h *dyldCacheHeader) uint64(off int) uint64 {
+	if !h.has(off, 8) {
+		return 0
+	}
+	return h.order.Uint64(h.raw[off:])
+}
+
+func (h *dyldCacheHeader) uuid(off int) (uuid [16]byte) {
+	if h.has(off, 16) {
+		copy(uuid[:], h.raw[off:])
+	}
+	return uuid
+}
+
+func readDyldCacheHeader(r io.ReaderAt) (*dyldCacheHeader, error) {
+	raw := make([]byte, 0x200)
+	n, err := r.ReadAt(raw, 0)
+	if n < dyldOffImagesOffsetOld+8 {
+		return nil, fmt.Errorf("unable to read the dyld cache header: %v", err)
+	}
+	raw = raw[:n]
+	if !bytes.HasPrefix(raw, []byte(dyldCacheMagic)) {
+		return nil, fmt.Errorf("invalid dyld cache magic %q", raw[:16])
+	}
+	h := &dyldCacheHeader{raw: raw, order: binary.LittleEndian}
+	h.mappingOffset = h.order.Uint32(raw[dyldOffMappingOffset:])
+	return h, nil
+}
+
+// readDyldCacheArray reads count entries of entrySize bytes at the offset of a cache file, the counts of
+// a corrupt header or of a file which is not a cache are checked against the file size before the allocation
+func readDyldCacheArray(f *os.File, off, count uint64, entrySize int) ([]byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := uint64(fi.Size())
+	if count > size/uint64(entrySize) || off > size-count*uint64(entrySize) {
+		return nil, fmt.Errorf("%d entries of %d bytes at 0x%x are out of the file of %d bytes", count, entrySize, off, size)
+	}
+	buf := make([]byte, count*uint64(entrySize))
+	if _, err = f.ReadAt(buf, int64(off)); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// mappings reads the dyld_cache_mapping_info entries of a cache file
+func (h *dyldCacheHeader) mappings(f *os.File) ([]dyldCacheMapping, error) {
+	count := h.order.Uint32(h.raw[dyldOffMappingOffset+4:])
+	buf, err := readDyldCacheArray(f, uint64(h.mappingOffset), uint64(count), 32)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the mappings of [%s]: %w", f.Name(), err)
+	}
+	mappings := make([]dyldCacheMapping, count)
+	for i := range mappings {
+		b := buf[32*i:]
+		mappings[i] = dyldCacheMapping{
+			address:    h.order.Uint64(b),
+			size:       h.order.Uint64(b[8:]),
+			fileOffset: h.order.Uint64(b[16:]),
+			file:       f,
+		}
+	}
+	return mappings, nil
+}
+
+// OpenDyldCache opens a dyld shared cache and its subcaches and .symbols file next to it
+func OpenDyldCache(file string) (*DyldCache, error) {
+	c := &DyldCache{path: file, order: binary.LittleEndian}
+	if err := c.open(); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("unable to open dyld shared cache [%s]: %w", file, err)
+	}
+	return c, nil
+}
+
+func (c *DyldCache) openFile(file string, uuid [16]byte) (*os.File, *dyldCacheHeader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.files = append(c.files, f)
+	h, err := readDyldCacheHeader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[%s]: %w", file, err)
+	}
+	if uuid != ([16]byte{}) && h.uuid(dyldOffUUID) != uuid {
+		return nil, nil, fmt.Errorf("the UUID of [%s] doesn't match with the main cache", file)
+	}
+	return f, h, nil
+}
+
+func (c *DyldCache) open() error {
+	f, h, err := c.openFile(c.path, [16]byte{})
+	if err != nil {
+		return err
+	}
+	c.uuid = h.uuid(dyldOffUUID)
+	c.arch, _ = ParseArch(strings.TrimSpace(strings.TrimRight(string(h.raw[len(dyldCacheMagic):16]), "\x00")))
+	if c.mainFileMappings, err = h.mappings(f); err != nil {
+		return err
+	}
+	c.mappings = append(c.mappings, c.mainFileMappings...)
+	if len(c.mappings) > 0 {
+		c.baseAddress = c.mappings[0].address
+	}
+
+	// the subcaches, whose entries are dyld_subcache_entry_v1 {uuid, cacheVMOffset}, or
+	// dyld_subcache_entry {uuid, cacheVMOffset, fileSuffix[32]} since iOS 16
+	if count := h.uint32(dyldOffSubCacheArrayOffset + 4); count > 0 {
+		entrySize := 24
+		if h.has(dyldOffCacheSubType, 4) {
+			entrySize = 56
+		}
+		buf, err := readDyldCacheArray(f, uint64(h.uint32(dyldOffSubCacheArrayOffset)), uint64(count), entrySize)
+		if err != nil {
+			return fmt.Errorf("unable to read the subcache entries: %w", err)
+		}
+		for i := 0; i < int(count); i++ {
+			entry := buf[entrySize*i:]
+			var uuid [16]byte
+			copy(uuid[:], entry)
+			suffix := fmt.Sprintf(".%d", i+1)
+			if entrySize == 56 {
+				suffix = nulTerminated(entry[24:56])
+			}
+			sf, sh, err := c.openFile(c.path+suffix, uuid)
+			if err != nil {
+				return fmt.Errorf("unable to open subcache: %w", err)
+			}
+			mappings, err := sh.mappings(sf)
+			if err != nil {
+				return err
+			}
+			c.mappings = append(c.mappings, mappings...)
+		}
+	}
+
+	// the local symbols are in the .symbols file since iOS 15, or at the end of the cache before
+	c.localEntries64 = h.has(dyldOffSymbolFileUUID, 0)
+	if symbolsUUID := h.uuid(dyldOffSymbolFileUUID); symbolsUUID != ([16]byte{}) {
+		sf, sh, err := c.openFile(c.path+".symbols", symbolsUUID)
+		if err != nil {
+			Log.Debugf("no local symbols of the dyld shared cache [%s]: %v", c.path, err)
+		} else {
+			c.localSymbols, c.localSymbolsOff = sf, sh.uint64(dyldOffLocalSymbolsOffset)
+		}
+	} else if off := h.uint64(dyldOffLocalSymbolsOffset); off > 0 {
+		c.localSymbols, c.localSymbolsOff = f, off
+	}
+
+	return c.readImages(f, h)
+}
+
+// readImages reads the dyld_cache_image_info entries and the UUIDs from the dyld_cache_image_text_info entries
+func (c *DyldCache) readImages(f *os.File, h *dyldCacheHeader) error {
+	imagesOff, count := h.uint32(dyldOffImagesOffsetOld), h.uint32(dyldOffImagesOffsetOld+4)
+	if h.has(dyldOffImagesOffset, 8) {
+		imagesOff, count = h.uint32(dyldOffImagesOffset), h.uint32(dyldOffImagesOffset+4)
+	}
+	buf, err := readDyldCacheArray(f, uint64(imagesOff), uint64(count), 32)
+	if err != nil {
+		return fmt.Errorf("unable to read the images: %w", err)
+	}
+	uuids := make(map[uint64][16]byte)
+	if textCount := h.uint64(dyldOffImagesTextOffset + 8); textCount > 0 {
+		text, err := readDyldCacheArray(f, h.uint64(dyldOffImagesTextOffset), textCount, 32)
+		if err != nil {
+			return fmt.Errorf("unable to read the image text infos: %w", err)
+		}
+		for i := 0; i < int(textCount); i++ {
+			var uuid [16]byte
+			copy(uuid[:], text[32*i:])
+			uuids[c.order.Uint64(text[32*i+16:])] = uuid
+		}
+	}
+
+	c.images = make([]DyldCacheImage, count)
+	name := make([]byte, 1024)
+	for i := range c.images {
+		b := buf[32*i:]
+		image := &c.images[i]
+		image.Address = c.order.Uint64(b)
+		n, _ := f.ReadAt(name, int64(c.order.Uint32(b[24:])))
+		image.Path = nulTerminated(name[:n])
+		if uuid, ok := uuids[image.Address]; ok {
+			image.UUID = uuid
+		} else if mf, err := c.imageFile(image.Address); err == nil {
+			image.UUID, _ = (&MachFile{File: mf}).UUID()
+		}
+	}
+	return nil
+}
+
+// UUID returns the UUID of the main cache file
+func (c *DyldCache) UUID() [16]byte {
+	return c.uuid
+}
+
+// Arch returns the architecture in the cache magic, e.g. "dyld_v1  arm64e"
+func (c *DyldCache) Arch() Arch {
+	return c.arch
+}
+
+// Images returns the dylibs in the cache
+func (c *DyldCache) Images() []DyldCacheImage {
+	return c.images
+}
+
+// Image returns the dylib of the install path, e.g. "/usr/lib/libobjc.A.dylib", or of the UUID
+// in the canonical form, or the first dylib whose file name matches, e.g. "CoreFoundation"
+func (c *DyldCache) Image(name string) (DyldCacheImage, bool) {
+	uuid, uuidErr := ParseUUID(name)
+	for _, image := range c.images {
+		if image.Path == name || uuidErr == nil && image.UUID == uuid {
+			return image, true
+		}
+	}
+	for _, image := range c.images {
+		if path.Base(image.Path) == name {
+			return image, true
+		}
+	}
+	return DyldCacheImage{}, false
+}
+
+// ReadAt reads the cache at an unslid address of the shared region, across the subcaches
+func (c *DyldCache) ReadAt(p []byte, addr int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		a := uint64(addr) + uint64(n)
+		// the mappings of the subcaches are not necessarily sorted
+		var m *dyldCacheMapping
+		for j := range c.mappings {
+			if a >= c.mappings[j].address && a < c.mappings[j].address+c.mappings[j].size {
+				m = &c.mappings[j]
+				break
+			}
+		}
+		if m == nil {
+			return n, fmt.Errorf("address 0x%x is not mapped in the dyld shared cache", a)
+		}
+		size := len(p) - n
+		if rest := m.address + m.size - a; uint64(size) > rest {
+			size = int(rest)
+		}
+		read, err := m.file.ReadAt(p[n:n+size], int64(m.fileOffset+a-m.address))
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// dyldImageReader reads a dylib of the cache as a standalone Mach-O file. The file offsets of the segments
+// are relative to the (sub)cache file of each segment and may overlap, so the load commands are rewritten
+// with the segments laid out one after another, and the segments are read by address
+type dyldImageReader struct {
+	cache    *DyldCache
+	header   []byte // the Mach-O header and the rewritten load commands
+	segments []dyldImageSegment
+}
+
+type dyldImageSegment struct {
+	name      string
+	address   uint64
+	offset    uint64 // the file offset in the (sub)cache file
+	fileSize  uint64
+	newOffset uint64 // the file offset in the standalone layout
+}
+
+func (r *dyldImageReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		o := uint64(off) + uint64(n)
+		if o < uint64(len(r.header)) {
+			n += copy(p[n:], r.header[o:])
+			continue
+		}
+		var seg *dyldImageSegment
+		for i := range r.segments {
+			if o >= r.segments[i].newOffset && o < r.segments[i].newOffset+r.segments[i].fileSize {
+				seg = &r.segments[i]
+				break
+			}
+		}
+		if seg == nil {
+			return n, io.EOF
+		}
+		size := uint64(len(p) - n)
+		if rest := seg.newOffset + seg.fileSize - o; size > rest {
+			size = rest
+		}
+		read, err := r.cache.ReadAt(p[n:n+int(size)], int64(seg.address+o-seg.newOffset))
+		n += read
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// ownedDyldImageReader closes the cache with the dylib, see OpenDyldCacheImage
+type ownedDyldImageReader struct {
+	*dyldImageReader
+}
+
+func (r *ownedDyldImageReader) Close() error {
+	return r.cache.Close()
+}
+
+// load commands of which the offsets into __LINKEDIT are rewritten
+const (
+	loadCmdCodeSignature     = 0x1d
+	loadCmdSegmentSplitInfo  = 0x1e
+	loadCmdDyldInfo          = 0x22
+	loadCmdFunctionStarts    = 0x26
+	loadCmdDataInCode        = 0x29
+	loadCmdDylibCodeSignDRs  = 0x2b
+	loadCmdLinkerOptHint     = 0x2e
+	loadCmdDyldExportsTrie   = 0x80000033
+	loadCmdDyldChainedFixups = 0x80000034
+	loadCmdDyldInfoOnly      = 0x80000022
+)
+
+// imageReader reads the Mach-O header of the dylib at the address, and rewrites the file offsets
+// of its load commands for the standalone layout, the segments go in the order of the load commands
+// and are aligned to 16KB, the offsets into __LINKEDIT are moved with the segment
+func (c *DyldCache) imageReader(addr uint64) (*dyldImageReader, error) {
+	header := make([]byte, 32)
+	if _, err := c.ReadAt(header, int64(addr)); err != nil {
+		return nil, fmt.Errorf("unable to read the Mach-O header at 0x%x: %w", addr, err)
+	}
+	is64 := c.order.Uint32(header) == macho.Magic64
+	headerSize := 28
+	if is64 {
+		headerSize = 32
+	}
+	header = make([]byte, headerSize+int(c.order.Uint32(header[20:])))
+	if _, err := c.ReadAt(header, int64(addr)); err != nil {
+		return nil, fmt.Errorf("unable to read the load commands at 0x%x: %w", addr, err)
+	}
+	r := &dyldImageReader{cache: c, header: header}
+
+	const pageSize = 0x4000
+	var (
+		order    = c.order
+		newOff   uint64
+		linkEdit = -1
+	)
+	forEachLoadCmd(order, header[headerSize:], func(cmd macho.LoadCmd, b []byte) {
+		var (
+			seg              dyldImageSegment
+			nsects, sectSize int
+			sects            []byte
+		)
+		switch {
+		case cmd == macho.LoadCmdSegment64 && len(b) >= 72:
+			seg = dyldImageSegment{address: order.Uint64(b[24:]), offset: order.Uint64(b[40:]), fileSize: order.Uint64(b[48:])}
+			nsects, sectSize, sects = int(order.Uint32(b[64:])), 80, b[72:]
+		case cmd == macho.LoadCmdSegment && len(b) >= 56:
+			seg = dyldImageSegment{address: uint64(order.Uint32(b[24:])), offset: uint64(order.Uint32(b[32:])), fileSize: uint64(order.Uint32(b[36:]))}
+			nsects, sectSize, sects = int(order.Uint32(b[48:])), 68, b[56:]
+		default:
+			return
+		}
+		seg.name = nulTerminated(b[8:24])
+		if seg.fileSize > 0 {
+			seg.newOffset = newOff
+			newOff = (newOff + seg.fileSize + pageSize - 1) &^ (pageSize - 1)
+		}
+		if cmd == macho.LoadCmdSegment64 {
+			order.PutUint64(b[40:], seg.newOffset)
+		} else {
+			order.PutUint32(b[32:], uint32(seg.newOffset))
+		}
+		// the section offsets, the zerofill sections have none
+		for i := 0; i < nsects && len(sects) >= (i+1)*sectSize; i++ {
+			sect := sects[i*sectSize:]
+			if cmd == macho.LoadCmdSegment64 {
+				if order.Uint32(sect[48:]) != 0 {
+					order.PutUint32(sect[48:], uint32(order.Uint64(sect[32:])-seg.address+seg.newOffset))
+				}
+			} else if order.Uint32(sect[40:]) != 0 {
+				order.PutUint32(sect[40:], uint32(uint64(order.Uint32(sect[32:]))-seg.address+seg.newOffset))
+			}
+		}
+		r.segments = append(r.segments, seg)
+		if seg.name == "__LINKEDIT" {
+			linkEdit = len(r.segments) - 1
+		}
+	})
+	if linkEdit < 0 {
+		return r, nil
+	}
+	le := r.segments[linkEdit]
+
+	rebase := func(b []byte, offs ...int) {
+		for _, off := range offs {
+			if len(b) < off+4 {
+				return
+			}
+			if v := uint64(order.Uint32(b[off:])); v != 0 {
+				order.PutUint32(b[off:], uint32(v-le.offset+le.newOffset))
+			}
+		}
+	}
+	forEachLoadCmd(order, header[headerSize:], func(cmd macho.LoadCmd, b []byte) {
+		switch cmd {
+		case macho.LoadCmdSymtab:
+			rebase(b, 8, 16) // symoff, stroff
+		case macho.LoadCmdDysymtab:
+			rebase(b, 32, 40, 48, 56, 64, 72) // tocoff, modtaboff, extrefsymoff, indirectsymoff, extreloff, locreloff
+		case loadCmdDyldInfo, loadCmdDyldInfoOnly:
+			rebase(b, 8, 16, 24, 32, 40) // rebase, bind, weak bind, lazy bind and export
+		case loadCmdCodeSignature, loadCmdSegmentSplitInfo, loadCmdFunctionStarts, loadCmdDataInCode,
+			loadCmdDylibCodeSignDRs, loadCmdLinkerOptHint, loadCmdDyldExportsTrie, loadCmdDyldChainedFixups:
+			rebase(b, 8) // dataoff
+		}
+	})
+	return r, nil
+}
+
+// forEachLoadCmd calls fn with each load command, b is the whole command and can be modified in place
+func forEachLoadCmd(order binary.ByteOrder, cmds []byte, fn func(cmd macho.LoadCmd, b []byte)) {
+	for len(cmds) >= 8 {
+		size := order.Uint32(cmds[4:])
+		if size < 8 || int(size) > len(cmds) {
+			return
+		}
+		fn(macho.LoadCmd(order.Uint32(cmds)), cmds[:size])
+		cmds = cmds[size:]
+	}
+}
+
+func (c *DyldCache) imageFile(addr uint64) (*macho.File, error) {
+	r, err := c.imageReader(addr)
+	if err != nil {
+		return nil, err
+	}
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Mach-O image at 0x%x: %w", addr, err)
+	}
+	return f, nil
+}
+
+// OpenImage opens a dylib of the cache, see Image, as a *MachFile with the exported symbols from its
+// symbol table and the local symbols from the .symbols file. It must be closed before the cache
+func (c *DyldCache) OpenImage(name string) (*MachFile, error) {
+	image, ok := c.Image(name)
+	if !ok {
+		return nil, fmt.Errorf("no image [%s] in the dyld shared cache", name)
+	}
+	r, err := c.imageReader(image.Address)
+	if err != nil {
+		return nil, err
+	}
+	return c.openImage(image, r)
+}
+
+func (c *DyldCache) openImage(image DyldCacheImage, r io.ReaderAt) (*MachFile, error) {
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Mach-O image [%s] in the dyld shared cache: %w", image.Path, err)
+	}
+	mf := &MachFile{name: path.Base(image.Path), r: r, File: f}
+	if err = mf.load(false); err != nil {
+		return nil, err
+	}
+	locals, err := c.localSymbolsOf(image.Address, f.Magic == macho.Magic64)
+	if err != nil {
+		Log.Debugf("unable to read the local symbols of [%s]: %v", image.Path, err)
+	}
+	mf.addSymbols(locals)
+	return mf, nil
+}
+
+// OpenDyldCacheImage opens a dylib of a dyld shared cache file, the cache is closed with the dylib
+func OpenDyldCacheImage(file, name string) (*MachFile, error) {
+	c, err := OpenDyldCache(file)
+	if err != nil {
+		return nil, err
+	}
+	image, ok := c.Image(name)
+	if !ok {
+		_ = c.Close()
+		return nil, fmt.Errorf("no image [%s] in the dyld shared cache [%s]", name, file)
+	}
+	r, err := c.imageReader(image.Address)
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	mf, err := c.openImage(image, &ownedDyldImageReader{r})
+	if err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return mf, nil
+}
+
+// localSymbolsOf reads the local symbols of the dylib at the address, from the dyld_cache_local_symbols_info
+// {nlistOffset, nlistCount, stringsOffset, stringsSize, entriesOffset, entriesCount}
+func (c *DyldCache) localSymbolsOf(addr uint64, is64 bool) ([]macho.Symbol, error) {
+	if c.localSymbols == nil {
+		return nil, nil
+	}
+	info := make([]byte, 24)
+	if _, err := c.localSymbols.ReadAt(info, int64(c.localSymbolsOff)); err != nil {
+		return nil, fmt.Errorf("unable to read the local symbols info: %w", err)
+	}
+	nlistOff, stringsOff := c.order.Uint32(info), c.order.Uint32(info[8:])
+	stringsSize := c.order.Uint32(info[12:])
+	entriesOff, entriesCount := c.order.Uint32(info[16:]), c.order.Uint32(info[20:])
+
+	// the entries are {dylibOffset uint32, nlistStartIndex, nlistCount}, or with a 64-bit
+	// dylibOffset, which is the VM offset of the dylib instead of its file offset, since iOS 15
+	entrySize, dylibOffset := 12, uint64(0)
+	if c.localEntries64 {
+		entrySize, dylibOffset = 16, addr-c.baseAddress
+	} else {
+		for _, m := range c.mainFileMappings {
+			if addr >= m.address && addr < m.address+m.size {
+				dylibOffset = m.fileOffset + addr - m.address
+			}
+		}
+	}
+	entries := make([]byte, entrySize*int(entriesCount))
+	if _, err := c.localSymbols.ReadAt(entries, int64(c.localSymbolsOff)+int64(entriesOff)); err != nil {
+		return nil, fmt.Errorf("unable to read the local symbols entries: %w", err)
+	}
+	for i := 0; i < int(entriesCount); i++ {
+		e := entries[entrySize*i:]
+		var off uint64
+		if c.localEntries64 {
+			off, e = c.order.Uint64(e), e[8:]
+		} else {
+			off, e = uint64(c.order.Uint32(e)), e[4:]
+		}
+		if off != dylibOffset {
+			continue
+		}
+		start, count := c.order.Uint32(e), c.order.Uint32(e[4:])
+		nlistSize := 12
+		if is64 {
+			nlistSize = 16
+		}
+		nlists := make([]byte, nlistSize*int(count))
+		if _, err := c.localSymbols.ReadAt(nlists, int64(c.localSymbolsOff)+int64(nlistOff)+int64(start)*int64(nlistSize)); err != nil {
+			return nil, fmt.Errorf("unable to read the local nlists: %w", err)
+		}
+		strs := make([]byte, stringsSize)
+		if _, err := c.localSymbols.ReadAt(strs, int64(c.localSymbolsOff)+int64(stringsOff)); err != nil {
+			return nil, fmt.Errorf("unable to read the local symbol strings: %w", err)
+		}
+		syms := make([]macho.Symbol, count)
+		for j := range syms {
+			n := nlists[nlistSize*j:]
+			sym := &syms[j]
+			if strx := c.order.Uint32(n); int(strx) < len(strs) {
+				sym.Name = nulTerminated(strs[strx:])
+			}
+			sym.Type, sym.Sect, sym.Desc = n[4], n[5], c.order.Uint16(n[6:])
+			if nlistSize == 16 {
+				sym.Value = c.order.Uint64(n[8:])
+			} else {
+				sym.Value = uint64(c.order.Uint32(n[8:]))
+			}
+		}
+		return syms, nil
+	}
+	return nil, nil
+}
+
+// Close closes the cache files
+func (c *DyldCache) Close() error {
+	var lastErr error
+	for _, f := range c.files {
+		if err := f.Close(); err != nil {
+			lastErr = fmt.Errorf("unable to close dyld shared cache file: %w", err)
+		}
+	}
+	c.files = nil
+	return lastErr
+}
+
+// nulTerminated returns the string before the first NUL of b, or the whole b, e.g. a segment name
+func nulTerminated(b []byte) string {
+	if end := bytes.IndexByte(b, 0); end >= 0 {
+		b = b[:end]
+	}
+	return string(b)
+}
@@ -0,0 +1,278 @@
+package atos
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var (
+	testCacheUUID   = [16]byte{0xca, 0xce, 1}
+	testSubUUID     = [16]byte{0xca, 0xce, 2}
+	testSymbolsUUID = [16]byte{0xca, 0xce, 3}
+	testDylibUUID   = [16]byte{0xd1, 0x1b, 1}
+)
+
+// testDyldCacheHeader builds a dyld_cache_header of 0x200 bytes with a mapping at 0x200
+func testDyldCacheHeader(uuid [16]byte, mappings ...[3]uint64) []byte {
+	le := binary.LittleEndian
+	b := make([]byte, 0x200)
+	copy(b, "dyld_v1  arm64e")
+	le.PutUint32(b[dyldOffMappingOffset:], 0x200)
+	le.PutUint32(b[dyldOffMappingOffset+4:], uint32(len(mappings)))
+	copy(b[dyldOffUUID:], uuid[:])
+	for _, m := range mappings {
+		b = le.AppendUint64(b, m[0]) // address
+		b = le.AppendUint64(b, m[1]) // size
+		b = le.AppendUint64(b, m[2]) // fileOffset
+		b = le.AppendUint64(b, 0x0005_0005)
+	}
+	return b
+}
+
+// writeDyldCache builds a split cache like iOS 16: the main cache with the header and __TEXT of
+// /usr/lib/libtest.dylib, the .01 subcache with __LINKEDIT at the same file offset as __TEXT, and
+// the .symbols file with the local symbols
+func writeDyldCache(t *testing.T) string {
+	le := binary.LittleEndian
+	dir := t.TempDir()
+	file := filepath.Join(dir, "dyld_shared_cache_arm64e")
+
+	main := make([]byte, 0x3000)
+	copy(main, testDyldCacheHeader(testCacheUUID, [3]uint64{0x180000000, 0x3000, 0}))
+	le.PutUint64(main[dyldOffImagesTextOffset:], 0x300)
+	le.PutUint64(main[dyldOffImagesTextOffset+8:], 1)
+	le.PutUint32(main[dyldOffSubCacheArrayOffset:], 0x220)
+	le.PutUint32(main[dyldOffSubCacheArrayOffset+4:], 1)
+	copy(main[dyldOffSymbolFileUUID:], testSymbolsUUID[:])
+	le.PutUint32(main[dyldOffImagesOffset:], 0x280)
+	le.PutUint32(main[dyldOffImagesOffset+4:], 1)
+	// the subcache entry: uuid, cacheVMOffset and fileSuffix
+	copy(main[0x220:], testSubUUID[:])
+	le.PutUint64(main[0x230:], 0x100000)
+	copy(main[0x238:], ".01")
+	// the image info: address, modTime, inode and pathFileOffset
+	le.PutUint64(main[0x280:], 0x180001000)
+	le.PutUint32(main[0x298:], 0x340)
+	// the image text info: uuid, loadAddress, textSegmentSize and pathOffset
+	copy(main[0x300:], testDylibUUID[:])
+	le.PutUint64(main[0x310:], 0x180001000)
+	le.PutUint32(main[0x318:], 0x2000)
+	le.PutUint32(main[0x31c:], 0x340)
+	copy(main[0x340:], "/usr/lib/libtest.dylib")
+
+	cmds := testSegment64("__TEXT", 0x180001000, 0x2000, 0x1000, 0x2000,
+		testSection64("__text", "__TEXT", 0x180002000, 0x100, 0x2000, 0, 0, 0))
+	cmds = append(cmds, testSegment64("__LINKEDIT", 0x180100000, 0x1000, 0x1000, 0x1000)...)
+	cmds = le.AppendUint32(cmds, uint32(macho.LoadCmdSymtab))
+	cmds = le.AppendUint32(cmds, 24)
+	cmds = le.AppendUint32(cmds, 0x1000) // symoff
+	cmds = le.AppendUint32(cmds, 1)
+	cmds = le.AppendUint32(cmds, 0x1010) // stroff
+	cmds = le.AppendUint32(cmds, 0x20)
+	// an external symbol and an indirect symbol of it
+	dysymtab := make([]byte, 80)
+	le.PutUint32(dysymtab, uint32(macho.LoadCmdDysymtab))
+	le.PutUint32(dysymtab[4:], 80)
+	le.PutUint32(dysymtab[16:], 0)      // iextdefsym
+	le.PutUint32(dysymtab[20:], 1)      // nextdefsym
+	le.PutUint32(dysymtab[24:], 1)      // iundefsym
+	le.PutUint32(dysymtab[56:], 0x1040) // indirectsymoff
+	le.PutUint32(dysymtab[60:], 2)
+	cmds = append(cmds, dysymtab...)
+	cmds = le.AppendUint32(cmds, loadCmdUUID)
+	cmds = le.AppendUint32(cmds, 24)
+	cmds = append(cmds, testDylibUUID[:]...)
+
+	header := le.AppendUint32(nil, macho.Magic64)
+	header = le.AppendUint32(header, uint32(macho.CpuArm64))
+	header = le.AppendUint32(header, CpuSubTypeArm64E)
+	header = le.AppendUint32(header, uint32(macho.TypeDylib))
+	header = le.AppendUint32(header, 5)
+	header = le.AppendUint32(header, uint32(len(cmds)))
+	header = le.AppendUint64(header, machoDylibInCache)
+	copy(main[0x1000:], append(header, cmds...))
+
+	nlist := func(strx uint32, typ uint8, value uint64) []byte {
+		b := le.AppendUint32(nil, strx)
+		b = append(b, typ, 1, 0, 0)
+		return le.AppendUint64(b, value)
+	}
+
+	// the exported symbols in __LINKEDIT
+	sub := make([]byte, 0x2000)
+	copy(sub, testDyldCacheHeader(testSubUUID, [3]uint64{0x180100000, 0x1000, 0x1000}))
+	copy(sub[0x1000:], nlist(1, 0x0f, 0x180002000))
+	copy(sub[0x1011:], "_exported_func")
+	le.PutUint32(sub[0x1040:], 0)
+	le.PutUint32(sub[0x1044:], indirectSymbolLocal)
+
+	// the local symbols info, the 64-bit entry and the nlists of the locals
+	symbols := testDyldCacheHeader(testSymbolsUUID)
+	le.PutUint64(symbols[dyldOffLocalSymbolsOffset:], 0x200)
+	info := make([]byte, 0xc0)
+	le.PutUint32(info, 0x40)     // nlistOffset
+	le.PutUint32(info[4:], 2)    // nlistCount
+	le.PutUint32(info[8:], 0x80) // stringsOffset
+	le.PutUint32(info[12:], 0x30)
+	le.PutUint32(info[16:], 0x18) // entriesOffset
+	le.PutUint32(info[20:], 1)
+	le.PutUint64(info[0x18:], 0x1000) // the VM offset of the dylib
+	le.PutUint32(info[0x24:], 2)
+	copy(info[0x40:], nlist(1, 0x0e, 0x180002040))
+	copy(info[0x50:], nlist(15, 0x0e, 0x180002080))
+	copy(info[0x81:], "_local_helper\x00_static_init")
+	symbols = append(symbols, info...)
+
+	for name, data := range map[string][]byte{file: main, file + ".01": sub, file + ".symbols": symbols} {
+		if err := os.WriteFile(name, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return file
+}
+
+func TestDyldCache(t *testing.T) {
+	file := writeDyldCache(t)
+	cache, err := OpenDyldCache(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	images := cache.Images()
+	if cache.Arch() != ArchARM64e || cache.UUID() != testCacheUUID || len(images) != 1 ||
+		images[0].Path != "/usr/lib/libtest.dylib" || images[0].UUID != testDylibUUID || images[0].Address != 0x180001000 {
+		t.Fatalf("unexpected cache %s with images %+v", cache.Arch(), images)
+	}
+
+	mf, err := cache.OpenImage("libtest.dylib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	if uuid, _ := mf.UUID(); uuid != testDylibUUID || mf.ImageName() != "libtest.dylib" || mf.VMAddr() != 0x180001000 {
+		t.Fatalf("unexpected image %s with UUID %x", mf.ImageName(), uuid)
+	}
+
+	mf.SetLoadAddress(0x190001000)
+	for pc, want := range map[uint64]string{
+		0x190002004: "exported_func",
+		0x190002044: "local_helper",
+		0x190002084: "static_init",
+	} {
+		symbol, err := mf.Atos(pc)
+		if err != nil {
+			t.Fatalf("PC 0x%x: %v", pc, err)
+		}
+		if symbol.Func != want || symbol.FuncOffset != 4 {
+			t.Fatalf("PC 0x%x: unexpected symbol %+v", pc, symbol)
+		}
+	}
+	if _, err = cache.OpenImage("/usr/lib/missing.dylib"); err == nil {
+		t.Fatal("expect an error for the missing image")
+	}
+}
+
+func TestCorruptDyldCache(t *testing.T) {
+	le := binary.LittleEndian
+	file := filepath.Join(t.TempDir(), "dyld_shared_cache_arm64e")
+	for _, corrupt := range []func(b []byte){
+		func(b []byte) { le.PutUint32(b[dyldOffMappingOffset+4:], 0xffffffff) },
+		func(b []byte) { le.PutUint32(b[dyldOffSubCacheArrayOffset+4:], 0xffffffff) },
+		func(b []byte) { le.PutUint32(b[dyldOffImagesOffset+4:], 0xffffffff) },
+		func(b []byte) { le.PutUint64(b[dyldOffImagesTextOffset+8:], 1<<58) },
+		func(b []byte) { le.PutUint32(b[dyldOffImagesOffset:], 0xffffffe0) },
+	} {
+		b := testDyldCacheHeader(testCacheUUID, [3]uint64{0x180000000, 0x1000, 0})
+		le.PutUint32(b[dyldOffImagesOffset:], 0x200)
+		corrupt(b)
+		if err := os.WriteFile(file, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if cache, err := OpenDyldCache(file); err == nil {
+			cache.Close()
+			t.Fatal("expect an error for the counts out of the file")
+		}
+	}
+}
+
+func TestSymbolStoreDyldCache(t *testing.T) {
+	file := writeDyldCache(t)
+	store, err := NewSymbolStore(filepath.Dir(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := store.Lookup(testDylibUUID)
+	if store.Len() != 1 || len(entries) != 1 || entries[0].DylibPath != "/usr/lib/libtest.dylib" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	sym, err := store.Open(testDylibUUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sym.SetLoadSlide(0x1000)
+	symbol, err := sym.Atos(0x180003040)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "local_helper" {
+		t.Fatalf("unexpected symbol %+v", symbol)
+	}
+	if err = sym.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractDyldCacheImage(t *testing.T) {
+	file := writeDyldCache(t)
+	out := filepath.Join(t.TempDir(), "libtest.dylib")
+	if err := ExtractDyldCacheImage(file, "D11B0100-0000-0000-0000-000000000000", out); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := macho.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.Flags&machoDylibInCache != 0 || len(f.Loads) != 5 {
+		t.Fatalf("unexpected header flags 0x%x with %d load commands", f.Flags, len(f.Loads))
+	}
+	if seg := f.Segment("__LINKEDIT"); seg == nil || seg.Offset != 0x4000 || seg.Addr != 0x180100000 {
+		t.Fatalf("unexpected __LINKEDIT %+v", seg)
+	}
+	var names []string
+	for _, sym := range f.Symtab.Syms {
+		names = append(names, sym.Name)
+	}
+	if len(names) != 3 || names[0] != "_local_helper" || names[2] != "_exported_func" {
+		t.Fatalf("unexpected symbols %v", names)
+	}
+	if f.Dysymtab.Nlocalsym != 2 || f.Dysymtab.Iextdefsym != 2 || f.Dysymtab.Iundefsym != 3 ||
+		len(f.Dysymtab.IndirectSyms) != 2 || f.Dysymtab.IndirectSyms[0] != 2 || f.Dysymtab.IndirectSyms[1] != indirectSymbolLocal {
+		t.Fatalf("unexpected dynamic symbol table %+v", f.Dysymtab)
+	}
+
+	r, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, err := Parse(r, ArchARM64e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+	if err = mf.load(false); err != nil {
+		t.Fatal(err)
+	}
+	symbol, err := mf.Atos(0x180002088)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "static_init" || symbol.FuncOffset != 8 {
+		t.Fatalf("unexpected symbol %+v", symbol)
+	}
+}
@@ -0,0 +1,297 @@
+package atos
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// machoDylibInCache is MH_DYLIB_IN_CACHE of the Mach-O header flags, which is cleared on extraction
+const machoDylibInCache = 0x80000000
+
+// indirect symbol table entries which are not symbol indices
+const (
+	indirectSymbolLocal = 0x80000000 // INDIRECT_SYMBOL_LOCAL
+	indirectSymbolAbs   = 0x40000000 // INDIRECT_SYMBOL_ABS
+)
+
+// linkEditBuilder lays out the blobs of a rebuilt __LINKEDIT
+type linkEditBuilder struct {
+	buf bytes.Buffer
+}
+
+// add appends the blob aligned to 8 bytes and returns its offset relative to __LINKEDIT
+func (b *linkEditBuilder) add(data []byte) uint32 {
+	for b.buf.Len()%8 != 0 {
+		b.buf.WriteByte(0)
+	}
+	off := b.buf.Len()
+	b.buf.Write(data)
+	return uint32(off)
+}
+
+// ExtractImage rebuilds a dylib of the cache, see Image, as a standalone Mach-O file: the segments are
+// laid out one after another, __LINKEDIT is rebuilt with only the data of the dylib, the local symbols
+// from the .symbols file are merged into the symbol table, and the code signature and the split segment
+// info are dropped. The pointers in the data segments are left as the cache encodes them
+func (c *DyldCache) ExtractImage(name string, w io.Writer) error {
+	image, ok := c.Image(name)
+	if !ok {
+		return fmt.Errorf("no image [%s] in the dyld shared cache", name)
+	}
+	r, err := c.imageReader(image.Address)
+	if err != nil {
+		return err
+	}
+	f, err := macho.NewFile(r)
+	if err != nil {
+		return fmt.Errorf("invalid Mach-O image [%s] in the dyld shared cache: %w", image.Path, err)
+	}
+	is64 := f.Magic == macho.Magic64
+	locals, err := c.localSymbolsOf(image.Address, is64)
+	if err != nil {
+		Log.Debugf("unable to read the local symbols of [%s]: %v", image.Path, err)
+	}
+
+	// the new __LINKEDIT goes after all the other segments
+	var (
+		leOff  uint64
+		leSeg  = -1
+		order  = binary.LittleEndian // the caches are little endian, see OpenDyldCache
+		header = r.header
+	)
+	for i, seg := range r.segments {
+		if seg.name == "__LINKEDIT" {
+			leSeg = i
+		} else if end := seg.newOffset + seg.fileSize; end > leOff {
+			leOff = end
+		}
+	}
+	if leSeg < 0 {
+		return fmt.Errorf("no __LINKEDIT segment in [%s]", image.Path)
+	}
+	const pageSize = 0x4000
+	leOff = (leOff + pageSize - 1) &^ (pageSize - 1)
+
+	readBlob := func(off, size uint32) ([]byte, error) {
+		blob := make([]byte, size)
+		if _, err := r.ReadAt(blob, int64(off)); err != nil {
+			return nil, fmt.Errorf("unable to read the __LINKEDIT data at 0x%x of [%s]: %w", off, image.Path, err)
+		}
+		return blob, nil
+	}
+	var le linkEditBuilder
+	// the offsets of the load commands are patched after the layout of __LINKEDIT
+	type patch struct {
+		field []byte
+		off   uint32
+	}
+	var patches []patch
+	copyBlob := func(cmd []byte, offField, sizeField int) error {
+		off, size := order.Uint32(cmd[offField:]), order.Uint32(cmd[sizeField:])
+		if size == 0 {
+			order.PutUint32(cmd[offField:], 0)
+			return nil
+		}
+		blob, err := readBlob(off, size)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch{cmd[offField:], le.add(blob)})
+		return nil
+	}
+
+	// the load commands are copied except the ones of the dropped data
+	headerSize := 28
+	if is64 {
+		headerSize = 32
+	}
+	var (
+		cmds     []byte
+		ncmds    uint32
+		symtab   []byte
+		dysymtab []byte
+	)
+	forEachLoadCmd(order, header[headerSize:], func(cmd macho.LoadCmd, b []byte) {
+		switch cmd {
+		case loadCmdCodeSignature, loadCmdSegmentSplitInfo, loadCmdDylibCodeSignDRs, loadCmdLinkerOptHint:
+			return
+		}
+		cmds = append(cmds, b...)
+		ncmds++
+	})
+	forEachLoadCmd(order, cmds, func(cmd macho.LoadCmd, b []byte) {
+		if err != nil {
+			return
+		}
+		switch cmd {
+		case macho.LoadCmdSymtab:
+			symtab = b
+		case macho.LoadCmdDysymtab:
+			dysymtab = b
+		case loadCmdDyldInfo, loadCmdDyldInfoOnly:
+			for _, off := range []int{8, 16, 24, 32, 40} { // rebase, bind, weak bind, lazy bind and export
+				if err = copyBlob(b, off, off+4); err != nil {
+					return
+				}
+			}
+		case loadCmdFunctionStarts, loadCmdDataInCode, loadCmdDyldExportsTrie, loadCmdDyldChainedFixups:
+			err = copyBlob(b, 8, 12)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	// the symbol table: the local symbols go first, so the indices of the others are shifted
+	if symtab != nil {
+		var syms []macho.Symbol
+		syms = append(syms, locals...)
+		if f.Symtab != nil {
+			syms = append(syms, f.Symtab.Syms...)
+		}
+		shift := uint32(len(locals))
+		strs := []byte{' ', 0}
+		strIndex := make(map[string]uint32)
+		var nlists []byte
+		for _, sym := range syms {
+			strx, ok := strIndex[sym.Name]
+			if !ok {
+				strx = uint32(len(strs))
+				strIndex[sym.Name] = strx
+				strs = append(append(strs, sym.Name...), 0)
+			}
+			nlists = order.AppendUint32(nlists, strx)
+			nlists = append(nlists, sym.Type, sym.Sect)
+			nlists = order.AppendUint16(nlists, sym.Desc)
+			if is64 {
+				nlists = order.AppendUint64(nlists, sym.Value)
+			} else {
+				nlists = order.AppendUint32(nlists, uint32(sym.Value))
+			}
+		}
+		patches = append(patches, patch{symtab[8:], le.add(nlists)})
+		order.PutUint32(symtab[12:], uint32(len(syms)))
+
+		if dysymtab != nil && f.Dysymtab != nil {
+			d := f.Dysymtab
+			order.PutUint32(dysymtab[8:], 0)
+			order.PutUint32(dysymtab[12:], d.Nlocalsym+shift)
+			order.PutUint32(dysymtab[16:], d.Iextdefsym+shift)
+			order.PutUint32(dysymtab[24:], d.Iundefsym+shift)
+			// the TOC, the module table, the external references and the relocations are not used in the caches
+			for _, off := range []int{32, 36, 40, 44, 48, 52, 64, 68, 72, 76} {
+				order.PutUint32(dysymtab[off:], 0)
+			}
+			var indirect []byte
+			for _, idx := range d.IndirectSyms {
+				if idx&(indirectSymbolLocal|indirectSymbolAbs) == 0 {
+					idx += shift
+				}
+				indirect = order.AppendUint32(indirect, idx)
+			}
+			if len(indirect) > 0 {
+				patches = append(patches, patch{dysymtab[56:], le.add(indirect)})
+			} else {
+				order.PutUint32(dysymtab[56:], 0)
+			}
+		}
+		patches = append(patches, patch{symtab[16:], le.add(strs)})
+		order.PutUint32(symtab[20:], uint32(len(strs)))
+	}
+	for _, p := range patches {
+		order.PutUint32(p.field, uint32(leOff)+p.off)
+	}
+	for le.buf.Len()%8 != 0 {
+		le.buf.WriteByte(0)
+	}
+
+	// the __LINKEDIT segment command
+	leSize := uint64(le.buf.Len())
+	forEachLoadCmd(order, cmds, func(cmd macho.LoadCmd, b []byte) {
+		if (cmd != macho.LoadCmdSegment64 && cmd != macho.LoadCmdSegment) || nulTerminated(b[8:24]) != "__LINKEDIT" {
+			return
+		}
+		vmSize := (leSize + pageSize - 1) &^ (pageSize - 1)
+		if cmd == macho.LoadCmdSegment64 {
+			order.PutUint64(b[32:], vmSize)
+			order.PutUint64(b[40:], leOff)
+			order.PutUint64(b[48:], leSize)
+		} else {
+			order.PutUint32(b[28:], uint32(vmSize))
+			order.PutUint32(b[32:], uint32(leOff))
+			order.PutUint32(b[36:], uint32(leSize))
+		}
+	})
+
+	// the new header replaces the old one, the rest of the old load commands are zeroed
+	newHeader := make([]byte, len(header))
+	copy(newHeader, header[:headerSize])
+	order.PutUint32(newHeader[16:], ncmds)
+	order.PutUint32(newHeader[20:], uint32(len(cmds)))
+	order.PutUint32(newHeader[24:], order.Uint32(header[24:])&^machoDylibInCache)
+	copy(newHeader[headerSize:], cmds)
+	r.header = newHeader
+
+	var pos uint64
+	for i, seg := range r.segments {
+		if i == leSeg || seg.fileSize == 0 {
+			continue
+		}
+		if err = writeZeros(w, seg.newOffset-pos); err != nil {
+			return err
+		}
+		if _, err = io.Copy(w, io.NewSectionReader(r, int64(seg.newOffset), int64(seg.fileSize))); err != nil {
+			return fmt.Errorf("unable to copy segment %s of [%s]: %w", seg.name, image.Path, err)
+		}
+		pos = seg.newOffset + seg.fileSize
+	}
+	if err = writeZeros(w, leOff-pos); err != nil {
+		return err
+	}
+	_, err = w.Write(le.buf.Bytes())
+	return err
+}
+
+func writeZeros(w io.Writer, n uint64) error {
+	_, err := io.CopyN(w, zeroReader{}, int64(n))
+	return err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// ExtractDyldCacheImage extracts a dylib of a dyld shared cache file to a standalone Mach-O file, see ExtractImage
+func ExtractDyldCacheImage(cacheFile, name, outFile string) error {
+	c, err := OpenDyldCache(cacheFile)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return c.ExtractImageFile(name, outFile)
+}
+
+// ExtractImageFile extracts a dylib of the cache to a standalone Mach-O file, see ExtractImage
+func (c *DyldCache) ExtractImageFile(name, outFile string) error {
+	out, err := os.Create(outFile)
+	if err != nil {
+		return fmt.Errorf("unable to create file %s: %v", outFile, err)
+	}
+	if err = c.ExtractImage(name, out); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return fmt.Errorf("unable to close file %s: %v", outFile, err)
+	}
+	return nil
+}
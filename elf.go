@@ -0,0 +1,223 @@
+package atos
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const ntGNUBuildID = 3 // NT_GNU_BUILD_ID
+
+// ELFFile is the ELF backend, e.g. for Linux executables and Android NDK libraries,
+// it shares the DWARF lookups with MachFile
+type ELFFile struct {
+	name string
+	r    io.ReaderAt
+	*elf.File
+	dwarfImage
+	buildID []byte
+}
+
+func OpenELF(file string) (*ELFFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %v", file, err)
+	}
+	ef, err := ParseELF(f)
+	if err != nil {
+		defer f.Close()
+		return nil, fmt.Errorf("unable to parse ELF file [%s]: %w", file, err)
+	}
+	ef.name = filepath.Base(file)
+	return ef, nil
+}
+
+func ParseELF(r io.ReaderAt) (*ELFFile, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ELF file: %w", err)
+	}
+	ef := &ELFFile{
+		r:    r,
+		File: f,
+	}
+
+	// the image base is the lowest PT_LOAD segment, which is 0 for PIE and shared libraries
+	first := true
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		base := prog.Vaddr
+		if prog.Align > 1 {
+			base &^= prog.Align - 1
+		}
+		if first || base < ef.vmAddr {
+			ef.vmAddr = base
+			first = false
+		}
+	}
+
+	ef.buildID = ef.parseBuildID()
+
+	if err = ef.loadDWARF(); err != nil {
+		return nil, fmt.Errorf("unable to parse DWARF debug info: %w", err)
+	}
+	return ef, nil
+}
+
+// loadDWARF loads the DWARF debug info, the SHF_COMPRESSED sections are decompressed by
+// debug/elf, the legacy .zdebug_* sections are handled like __zdebug_* in Mach-O
+func (f *ELFFile) loadDWARF() error {
+	dwarfData, err := f.DWARF()
+	if err != nil {
+		return err
+	}
+	secs := newDWARFSections(f.ByteOrder)
+	for _, section := range f.Sections {
+		name := dwarfSectionName(section.Name)
+		if !rawDWARFSections[name] {
+			continue
+		}
+		b, err := elfSectionData(section)
+		if err != nil {
+			Log.Debugf("unable to read %s: %v", section.Name, err)
+			continue
+		}
+		secs.add(name, b)
+	}
+	f.dwarfImage.init(dwarfData, secs)
+	return nil
+}
+
+func elfSectionData(s *elf.Section) ([]byte, error) {
+	if s.Type == elf.SHT_NOBITS {
+		return nil, fmt.Errorf("section %s has no data", s.Name)
+	}
+	b, err := s.Data()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read ELF section data: %w", err)
+	}
+	if strings.HasPrefix(s.Name, ".zdebug_") {
+		return zdebugData(b)
+	}
+	return b, nil
+}
+
+// parseBuildID reads the GNU build-id note from .note.gnu.build-id or any PT_NOTE segment
+func (f *ELFFile) parseBuildID() []byte {
+	var notes [][]byte
+	if s := f.Section(".note.gnu.build-id"); s != nil {
+		if b, err := s.Data(); err == nil {
+			notes = append(notes, b)
+		}
+	}
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_NOTE {
+			// read up to the end of the file rather than allocating p_filesz of a corrupt header
+			if b, err := io.ReadAll(prog.Open()); err == nil {
+				notes = append(notes, b)
+			}
+		}
+	}
+
+	for _, b := range notes {
+		if id := gnuBuildIDNote(b, f.ByteOrder); id != nil {
+			return id
+		}
+	}
+	return nil
+}
+
+// gnuBuildIDNote returns the desc of the NT_GNU_BUILD_ID note of the notes, nil if there's none
+func gnuBuildIDNote(b []byte, order binary.ByteOrder) []byte {
+	br := newBytesReader(b)
+	for br.Len() >= 12 {
+		nameSize, _ := br.Uint32(order)
+		descSize, _ := br.Uint32(order)
+		noteType, _ := br.Uint32(order)
+		// the name and the desc are padded to 4 bytes, which overflows uint32 for the sizes of a corrupt note
+		nameLen, descLen := (uint64(nameSize)+3)&^3, (uint64(descSize)+3)&^3
+		if nameLen+descLen > uint64(br.Len()) {
+			break
+		}
+		name, _ := br.Bytes(int(nameLen))
+		desc, _ := br.Bytes(int(descLen))
+		if noteType == ntGNUBuildID && bytes.Equal(bytes.TrimRight(name, "\x00"), []byte("GNU")) {
+			return desc[:descSize]
+		}
+	}
+	return nil
+}
+
+// ImageName returns the file name of the ELF file, e.g. "libapp.so"
+func (f *ELFFile) ImageName() string {
+	return f.name
+}
+
+// BuildID returns the GNU build-id of the ELF file, which is usually a 20 bytes SHA-1
+func (f *ELFFile) BuildID() []byte {
+	return f.buildID
+}
+
+// UUID returns the first 16 bytes of the GNU build-id, padded with zeros if it's shorter
+func (f *ELFFile) UUID() ([16]byte, bool) {
+	var uuid [16]byte
+	copy(uuid[:], f.buildID)
+	return uuid, len(f.buildID) > 0
+}
+
+// MatchBuildID reports if the build-id of the ELF file is the hex encoded id, e.g. from an Android tombstone
+func (f *ELFFile) MatchBuildID(id string) bool {
+	b, err := hex.DecodeString(strings.TrimSpace(id))
+	return err == nil && len(b) > 0 && bytes.Equal(b, f.buildID)
+}
+
+// Arch maps the ELF machine to the equivalent Mach-O architecture
+func (f *ELFFile) Arch() Arch {
+	switch f.Machine {
+	case elf.EM_AARCH64:
+		return ArchARM64
+	case elf.EM_X86_64:
+		return ArchX64
+	case elf.EM_386:
+		return ArchI386
+	case elf.EM_ARM:
+		return ArchARM
+	}
+	return Arch{}
+}
+
+func (f *ELFFile) Close() error {
+	if f.File != nil {
+		if err := f.File.Close(); err != nil {
+			return fmt.Errorf("unable to close ELF file: %w", err)
+		}
+	}
+	if c, ok := f.r.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return fmt.Errorf("unable to close os file: %w", err)
+		}
+	}
+	return nil
+}
+
+// BuildIDDebugFile returns the path of the separate debug file of a build-id under the
+// GDB's .build-id directory layout, e.g. /usr/lib/debug/.build-id/8c/ba41a4....debug
+func BuildIDDebugFile(root string, buildID []byte) (string, bool) {
+	if len(buildID) < 2 {
+		return "", false
+	}
+	id := hex.EncodeToString(buildID)
+	file := filepath.Join(root, ".build-id", id[:2], id[2:]+".debug")
+	if _, err := os.Stat(file); err != nil {
+		return "", false
+	}
+	return file, true
+}
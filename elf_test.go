@@ -0,0 +1,85 @@
+package atos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+// testdata/inline.elf is built from testdata/inline.c by "gcc -g -O2 -gz=zlib -fdebug-prefix-map=$PWD=/src",
+// which emits DWARF 5 with SHF_COMPRESSED debug sections
+func TestOpenELF(t *testing.T) {
+	ef, err := OpenELF("testdata/inline.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+
+	if ef.Arch() != ArchX64 || ef.VMAddr() != 0 {
+		t.Fatalf("unexpected arch %s or vmaddr 0x%x", ef.Arch(), ef.VMAddr())
+	}
+	if !ef.MatchBuildID("f8931b3449bcdd685d38211a3effdd7fa827f2d6") {
+		t.Fatalf("unexpected build-id %x", ef.BuildID())
+	}
+	if len(ef.debugAranges) == 0 || ef.debugInfo == nil {
+		t.Fatal("the compressed .debug_aranges and .debug_info are not loaded")
+	}
+
+	ef.SetLoadAddress(0x7f0000000000)
+	symbol, err := ef.Atos(0x7f0000000000 + 0x1165)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "compute" || symbol.Line != 16 {
+		t.Fatalf("unexpected symbol: %+v", symbol)
+	}
+	if symbol.FuncStart != 0x7f0000001150 || symbol.FuncEnd != 0x7f000000116e || symbol.FuncOffset != 0x15 {
+		t.Fatalf("unexpected function bounds: 0x%x-0x%x + 0x%x", symbol.FuncStart, symbol.FuncEnd, symbol.FuncOffset)
+	}
+
+	frames, err := ef.Frames(0x7f0000000000 + 0x1150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var funcs []string
+	for _, frame := range frames {
+		funcs = append(funcs, frame.Func)
+	}
+	if len(frames) != 3 || funcs[0] != "square" || funcs[1] != "sum_squares" || funcs[2] != "compute" {
+		t.Fatalf("unexpected inlined frames: %v", funcs)
+	}
+	if frames[0].Line != 5 || frames[1].Line != 10 || frames[2].Line != 15 {
+		t.Fatalf("unexpected frame lines: %d, %d, %d", frames[0].Line, frames[1].Line, frames[2].Line)
+	}
+	if frames[0].Column != 11 || frames[1].Column != 9 || frames[2].Column != 10 {
+		t.Fatalf("unexpected frame columns: %d, %d, %d", frames[0].Column, frames[1].Column, frames[2].Column)
+	}
+	if frames[0].CompDir != "/src" || frames[0].File != "/src/inline.c" {
+		t.Fatalf("unexpected source file %s in %s", frames[0].File, frames[0].CompDir)
+	}
+}
+
+func TestGNUBuildIDNote(t *testing.T) {
+	le := binary.LittleEndian
+	note := func(nameSize, descSize, noteType uint32, payload ...byte) []byte {
+		b := le.AppendUint32(nil, nameSize)
+		b = le.AppendUint32(b, descSize)
+		b = le.AppendUint32(b, noteType)
+		return append(b, payload...)
+	}
+	id := []byte{0xde, 0xad, 0xbe, 0xef, 0x01}
+	valid := note(4, uint32(len(id)), ntGNUBuildID, append([]byte("GNU\x00"), id...)...)
+	valid = append(valid, 0, 0, 0)
+	if got := gnuBuildIDNote(append(note(4, 0, 1, []byte("ABC\x00")...), valid...), binary.LittleEndian); !bytes.Equal(got, id) {
+		t.Errorf("unexpected build-id %x", got)
+	}
+
+	// the padding of the desc size wraps around to 0 in uint32
+	crafted := note(4, 0xfffffffd, ntGNUBuildID, []byte("GNU\x00")...)
+	if got := gnuBuildIDNote(crafted, binary.LittleEndian); got != nil {
+		t.Errorf("unexpected build-id %x of a corrupt note", got)
+	}
+	if got := gnuBuildIDNote(note(0xfffffffd, 0, ntGNUBuildID), binary.LittleEndian); got != nil {
+		t.Errorf("unexpected build-id %x of a corrupt note", got)
+	}
+}
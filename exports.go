@@ -0,0 +1,256 @@
+package atos
+
+import (
+	"debug/macho"
+	"fmt"
+	"strings"
+)
+
+// the flags of the exports trie, EXPORT_SYMBOL_FLAGS_*
+const (
+	exportSymbolFlagsKindMask    = 0x03
+	exportSymbolFlagsKindRegular = 0x00
+	exportSymbolFlagsReExport    = 0x08
+)
+
+// the section types of the indirect symbols, see sectionTypeMask
+const (
+	sectionNonLazySymbolPointers = 0x06 // S_NON_LAZY_SYMBOL_POINTERS, e.g. __got
+	sectionLazySymbolPointers    = 0x07 // S_LAZY_SYMBOL_POINTERS, e.g. __la_symbol_ptr
+	sectionSymbolStubs           = 0x08 // S_SYMBOL_STUBS, e.g. __stubs and __auth_stubs
+	sectionLazyDylibPointers     = 0x10 // S_LAZY_DYLIB_SYMBOL_POINTERS
+)
+
+// Export is a symbol of the exports trie of LC_DYLD_EXPORTS_TRIE or LC_DYLD_INFO
+type Export struct {
+	Name       string
+	Address    uint64 // the unslid vmaddr, 0 for a re-export
+	Flags      uint64 // EXPORT_SYMBOL_FLAGS_*, e.g. weak definition or thread local
+	ReExport   bool   // if it's re-exported from the library of LibOrdinal
+	LibOrdinal int
+	ImportName string // the name in the library of a re-export, empty if it's the same name
+}
+
+// Exports decodes the exports trie of the image, which lists the exported symbols even if they're stripped from the symbol table
+func (f *MachFile) Exports() ([]Export, error) {
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) < 8 {
+			continue
+		}
+		var off, size uint32
+		switch f.ByteOrder.Uint32(raw) {
+		case loadCmdDyldExportsTrie:
+			if len(raw) < 16 {
+				return nil, fmt.Errorf("malformed LC_DYLD_EXPORTS_TRIE")
+			}
+			off, size = f.ByteOrder.Uint32(raw[8:]), f.ByteOrder.Uint32(raw[12:])
+		case loadCmdDyldInfo, loadCmdDyldInfoOnly:
+			if len(raw) < 48 {
+				return nil, fmt.Errorf("malformed LC_DYLD_INFO")
+			}
+			off, size = f.ByteOrder.Uint32(raw[40:]), f.ByteOrder.Uint32(raw[44:])
+		default:
+			continue
+		}
+		if size == 0 {
+			return nil, nil
+		}
+		trie, err := f.linkEditData(off, size)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the exports trie: %w", err)
+		}
+		base := uint64(0)
+		if text := f.Segment("__TEXT"); text != nil {
+			base = text.Addr
+		}
+		var exports []Export
+		if err = walkExportsTrie(trie, 0, nil, base, make(map[uint64]bool), &exports); err != nil {
+			return nil, fmt.Errorf("invalid exports trie: %w", err)
+		}
+		return exports, nil
+	}
+	return nil, nil
+}
+
+// walkExportsTrie visits the node at the offset of the trie, whose edges from the root spell the prefix
+func walkExportsTrie(trie []byte, off uint64, prefix []byte, base uint64, visited map[uint64]bool, exports *[]Export) error {
+	if off >= uint64(len(trie)) {
+		return fmt.Errorf("the node offset 0x%x is out of the trie", off)
+	}
+	if visited[off] {
+		return fmt.Errorf("a loop at the node 0x%x", off)
+	}
+	visited[off] = true
+
+	br := newBytesReader(trie)
+	br.offset = int(off)
+	terminalSize, err := br.ReadULEB128()
+	if err != nil {
+		return err
+	}
+	children := br.Offset() + int(terminalSize)
+	if terminalSize > 0 {
+		export := Export{Name: string(prefix)}
+		if export.Flags, err = br.ReadULEB128(); err != nil {
+			return err
+		}
+		if export.Flags&exportSymbolFlagsReExport != 0 {
+			export.ReExport = true
+			ordinal, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			export.LibOrdinal = int(ordinal)
+			if export.ImportName, err = br.ReadCString(); err != nil {
+				return err
+			}
+		} else {
+			addr, err := br.ReadULEB128()
+			if err != nil {
+				return err
+			}
+			// the address of a stub and resolver is the stub, followed by the resolver function
+			export.Address = base + addr
+		}
+		*exports = append(*exports, export)
+	}
+
+	if children >= len(trie) {
+		return fmt.Errorf("the children of the node 0x%x are out of the trie", off)
+	}
+	br.offset = children
+	count, _ := br.ReadByte()
+	for i := 0; i < int(count); i++ {
+		edge, err := br.ReadCString()
+		if err != nil {
+			return err
+		}
+		child, err := br.ReadULEB128()
+		if err != nil {
+			return err
+		}
+		label := append(append([]byte(nil), prefix...), edge...)
+		if err = walkExportsTrie(trie, child, label, base, visited, exports); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addExports adds the regular exports which aren't in the symbol table, e.g. of a binary with a stripped symbol table
+func (f *MachFile) addExports() {
+	exports, err := f.Exports()
+	if err != nil {
+		Log.Debugf("unable to read the exports of [%s]: %v", f.name, err)
+		return
+	}
+	defined := make(map[uint64]bool, len(f.symbolTable))
+	for _, sym := range f.symbolTable {
+		if sym.Type&nStab == 0 && sym.Type&nSect == nSect {
+			defined[sym.Value] = true
+		}
+	}
+	var syms []macho.Symbol
+	for _, export := range exports {
+		if export.ReExport || export.Flags&exportSymbolFlagsKindMask != exportSymbolFlagsKindRegular || defined[export.Address] {
+			continue
+		}
+		for i, section := range f.Sections {
+			if export.Address >= section.Addr && export.Address < section.Addr+section.Size {
+				syms = append(syms, macho.Symbol{Name: export.Name, Type: nSect | nExt, Sect: uint8(i + 1), Value: export.Address})
+				defined[export.Address] = true
+				break
+			}
+		}
+	}
+	f.addSymbols(syms)
+}
+
+// indirectSection is a section of the stubs or the symbol pointers, whose entries are described by the indirect symbol table
+type indirectSection struct {
+	addr, size uint64
+	typ        uint32
+	index      uint32 // reserved1, the index of the first entry in the indirect symbol table
+	stride     uint64 // reserved2 of the stubs, the pointer size of the pointers
+}
+
+// indirectSections parses the reserved fields of the sections, which debug/macho doesn't keep
+func (f *MachFile) indirectSections() []indirectSection {
+	headerSize, sectSize, fieldsOff := 56, 68, 56 // LC_SEGMENT, the flags, reserved1 and reserved2 of a section
+	if f.Magic == macho.Magic64 {
+		headerSize, sectSize, fieldsOff = 72, 80, 64
+	}
+	var sections []indirectSection
+	for _, load := range f.Loads {
+		seg, ok := load.(*macho.Segment)
+		if !ok {
+			continue
+		}
+		raw := seg.Raw()
+		for i := 0; i < int(seg.Nsect); i++ {
+			b := raw[min(len(raw), headerSize+i*sectSize):]
+			if len(b) < sectSize {
+				break
+			}
+			s := indirectSection{
+				typ:    f.ByteOrder.Uint32(b[fieldsOff:]) & sectionTypeMask,
+				index:  f.ByteOrder.Uint32(b[fieldsOff+4:]),
+				stride: uint64(f.ByteOrder.Uint32(b[fieldsOff+8:])),
+			}
+			switch s.typ {
+			case sectionSymbolStubs:
+			case sectionNonLazySymbolPointers, sectionLazySymbolPointers, sectionLazyDylibPointers:
+				s.stride = uint64(f.pointerSize())
+			default:
+				continue
+			}
+			if f.Magic == macho.Magic64 {
+				s.addr, s.size = f.ByteOrder.Uint64(b[32:]), f.ByteOrder.Uint64(b[40:])
+			} else {
+				s.addr, s.size = uint64(f.ByteOrder.Uint32(b[32:])), uint64(f.ByteOrder.Uint32(b[36:]))
+			}
+			if s.stride > 0 {
+				sections = append(sections, s)
+			}
+		}
+	}
+	return sections
+}
+
+// IndirectSymbol returns the symbol which the stub or the lazy or non-lazy symbol pointer at the vmaddr
+// refers to by the indirect symbol table, e.g. "_objc_msgSend" of an entry of __stubs or __la_symbol_ptr,
+// and if it's a stub
+func (f *MachFile) IndirectSymbol(addr uint64) (name string, stub bool, ok bool) {
+	if f.Dysymtab == nil || f.Symtab == nil {
+		return "", false, false
+	}
+	for _, s := range f.indirectSections() {
+		if addr < s.addr || addr >= s.addr+s.size {
+			continue
+		}
+		idx := uint64(s.index) + (addr-s.addr)/s.stride
+		if idx >= uint64(len(f.Dysymtab.IndirectSyms)) {
+			return "", false, false
+		}
+		symIdx := f.Dysymtab.IndirectSyms[idx]
+		if symIdx&(indirectSymbolLocal|indirectSymbolAbs) != 0 || int(symIdx) >= len(f.Symtab.Syms) {
+			return "", false, false
+		}
+		return f.Symtab.Syms[symIdx].Name, s.typ == sectionSymbolStubs, true
+	}
+	return "", false, false
+}
+
+// stubSymbol resolves an address in the stubs or the symbol pointers like atos, e.g. "symbol stub for: objc_msgSend"
+func (f *MachFile) stubSymbol(addr uint64) (string, bool) {
+	name, stub, ok := f.IndirectSymbol(addr)
+	if !ok {
+		return "", false
+	}
+	name = strings.TrimPrefix(name, "_")
+	if stub {
+		return "symbol stub for: " + name, true
+	}
+	return "symbol pointer for: " + name, true
+}
@@ -0,0 +1,191 @@
+package atos
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"testing"
+)
+
+func appendULEB128(b []byte, v uint64) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			return append(b, c)
+		}
+		b = append(b, c|0x80)
+	}
+}
+
+// exportsTrie builds a trie of a root node with an edge of the full name for each export
+func exportsTrie(exports []Export) []byte {
+	var nodes [][]byte
+	rootSize := 2 // the terminal size and the child count
+	for _, export := range exports {
+		var info []byte
+		info = appendULEB128(info, export.Flags)
+		if export.ReExport {
+			info = appendULEB128(info, uint64(export.LibOrdinal))
+			info = append(append(info, export.ImportName...), 0)
+		} else {
+			info = appendULEB128(info, export.Address)
+		}
+		node := appendULEB128(nil, uint64(len(info)))
+		nodes = append(nodes, append(append(node, info...), 0))
+		rootSize += len(export.Name) + 2 // the edge and a single byte child offset
+	}
+	trie := []byte{0, byte(len(exports))}
+	off := rootSize
+	for i, export := range exports {
+		trie = append(append(trie, export.Name...), 0)
+		trie = appendULEB128(trie, uint64(off))
+		off += len(nodes[i])
+	}
+	for _, node := range nodes {
+		trie = append(trie, node...)
+	}
+	return trie
+}
+
+// stubsImage builds an arm64 image with __TEXT,__text at 0x100000400, __TEXT,__stubs of two 12 bytes stubs at 0x100000500,
+// __DATA,__la_symbol_ptr of two pointers at 0x100004000, a minimal symbol table and an exports trie
+func stubsImage(t *testing.T) *MachFile {
+	le := binary.LittleEndian
+	// the symbol table has a local function and the two undefined symbols of the stubs
+	var syms, strs []byte
+	strs = append(strs, 0)
+	for _, sym := range []struct {
+		name  string
+		typ   uint8
+		sect  uint8
+		value uint64
+	}{{"_local_func", nSect, 1, 0x100000400}, {"_objc_msgSend", nExt, 0, 0}, {"_malloc", nExt, 0, 0}} {
+		syms = le.AppendUint32(syms, uint32(len(strs)))
+		syms = append(syms, sym.typ, sym.sect)
+		syms = le.AppendUint16(syms, 0)
+		syms = le.AppendUint64(syms, sym.value)
+		strs = append(append(strs, sym.name...), 0)
+	}
+	var indirect []byte
+	for _, idx := range []uint32{1, 2, 2, indirectSymbolLocal} {
+		indirect = le.AppendUint32(indirect, idx)
+	}
+	trie := exportsTrie([]Export{
+		{Name: "_local_func", Address: 0x400},
+		{Name: "_main", Address: 0x440},
+		{Name: "_helper", Address: 0x480},
+		{Name: "_reexported", Flags: exportSymbolFlagsReExport, ReExport: true, LibOrdinal: 1, ImportName: "_other"},
+	})
+	var linkEdit []byte
+	add := func(b []byte) uint32 {
+		off := 0x8000 + uint32(len(linkEdit))
+		linkEdit = append(linkEdit, b...)
+		for len(linkEdit)%8 != 0 {
+			linkEdit = append(linkEdit, 0)
+		}
+		return off
+	}
+	symOff, strOff, indirectOff, trieOff := add(syms), add(strs), add(indirect), add(trie)
+
+	var cmds []byte
+	cmds = append(cmds, testSegment64("__TEXT", 0x100000000, 0x4000, 0, 0x4000,
+		testSection64("__text", "__TEXT", 0x100000400, 0x100, 0x400, 0x80000400, 0, 0),
+		testSection64("__stubs", "__TEXT", 0x100000500, 0x18, 0x500, 0x80000408, 0, 12))...)
+	cmds = append(cmds, testSegment64("__DATA", 0x100004000, 0x4000, 0x4000, 0x4000,
+		testSection64("__la_symbol_ptr", "__DATA", 0x100004000, 0x10, 0x4000, 0x07, 2, 0))...)
+	cmds = append(cmds, testSegment64("__LINKEDIT", 0x100008000, 0x4000, 0x8000, uint64(len(linkEdit)))...)
+	cmds = le.AppendUint32(cmds, uint32(macho.LoadCmdSymtab))
+	cmds = le.AppendUint32(cmds, 24)
+	for _, v := range []uint32{symOff, 3, strOff, uint32(len(strs))} {
+		cmds = le.AppendUint32(cmds, v)
+	}
+	cmds = le.AppendUint32(cmds, uint32(macho.LoadCmdDysymtab))
+	cmds = le.AppendUint32(cmds, 80)
+	for i := 0; i < 18; i++ {
+		switch i {
+		case 1: // nlocalsym
+			cmds = le.AppendUint32(cmds, 1)
+		case 2, 4: // iextdefsym, iundefsym
+			cmds = le.AppendUint32(cmds, 1)
+		case 5: // nundefsym
+			cmds = le.AppendUint32(cmds, 2)
+		case 12: // indirectsymoff
+			cmds = le.AppendUint32(cmds, indirectOff)
+		case 13: // nindirectsyms
+			cmds = le.AppendUint32(cmds, 4)
+		default:
+			cmds = le.AppendUint32(cmds, 0)
+		}
+	}
+	cmds = le.AppendUint32(cmds, loadCmdDyldExportsTrie)
+	cmds = le.AppendUint32(cmds, 16)
+	cmds = le.AppendUint32(cmds, trieOff)
+	cmds = le.AppendUint32(cmds, uint32(len(trie)))
+
+	b := le.AppendUint32(nil, macho.Magic64)
+	b = le.AppendUint32(b, uint32(macho.CpuArm64))
+	b = le.AppendUint32(b, CpuSubTypeArm64All)
+	b = le.AppendUint32(b, uint32(macho.TypeExec))
+	b = le.AppendUint32(b, 6)
+	b = le.AppendUint32(b, uint32(len(cmds)))
+	b = le.AppendUint64(b, 0)
+	b = append(b, cmds...)
+
+	file := make([]byte, 0x8000+len(linkEdit))
+	copy(file, b)
+	copy(file[0x8000:], linkEdit)
+	mf, err := Parse(bytes.NewReader(file), ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf.name = "stubs"
+	if err = mf.load(false); err != nil {
+		t.Fatal(err)
+	}
+	return mf
+}
+
+func TestExportsAndStubs(t *testing.T) {
+	mf := stubsImage(t)
+	defer mf.Close()
+
+	exports, err := mf.Exports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exports) != 4 || exports[1] != (Export{Name: "_main", Address: 0x100000440}) ||
+		exports[3] != (Export{Name: "_reexported", Flags: exportSymbolFlagsReExport, ReExport: true, LibOrdinal: 1, ImportName: "_other"}) {
+		t.Fatalf("unexpected exports %+v", exports)
+	}
+
+	mf.SetLoadAddress(0x104000000)
+	for pc, want := range map[uint64]string{
+		0x104000408: "local_func",
+		0x104000444: "main", // only in the exports trie
+		0x1040004c0: "helper",
+		0x104000500: "symbol stub for: objc_msgSend",
+		0x104000510: "symbol stub for: malloc",
+		0x104004000: "symbol pointer for: malloc",
+	} {
+		symbol, err := mf.Atos(pc)
+		if err != nil {
+			t.Fatalf("0x%x: %v", pc, err)
+		}
+		if symbol.Func != want {
+			t.Fatalf("0x%x: expect %s, got %s", pc, want, symbol.Func)
+		}
+	}
+	if symbol, err := mf.Atos(0x104000444); err != nil || symbol.FuncOffset != 4 {
+		t.Fatalf("unexpected offset of the exported function %+v", symbol)
+	}
+	if _, err = mf.Atos(0x104004008); err == nil {
+		t.Fatal("expect an error for the INDIRECT_SYMBOL_LOCAL pointer")
+	}
+	if name, err := mf.ResolveNameFromSymTab(0x10000050c); err != nil || name != "symbol stub for: malloc" {
+		t.Fatalf("unexpected name of the stub %q: %v", name, err)
+	}
+	if name, stub, ok := mf.IndirectSymbol(0x100004000); !ok || stub || name != "_malloc" {
+		t.Fatalf("unexpected indirect symbol %q %v %v", name, stub, ok)
+	}
+}
@@ -0,0 +1,669 @@
+package atos
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Fixup is a pointer in the data segments which dyld fixes up at load time, it's either rebased
+// to an address in the image or bound to a symbol imported from a library
+type Fixup struct {
+	Address    uint64 // the vmaddr of the pointer
+	Bind       bool   // if the pointer is bound to Symbol, otherwise it's rebased to Target
+	Target     uint64 // the unslid vmaddr which a rebased pointer points to
+	Symbol     string // the imported symbol of a bind, e.g. "_objc_msgSend"
+	LibOrdinal int    // the library ordinal of Symbol, 0 for the image itself, -1 for the main executable, -2 for the flat lookup of weak symbols
+	Addend     int64
+	WeakImport bool
+	Auth       bool   // if the pointer is signed with pointer authentication, arm64e only
+	Key        uint8  // the PAC key of an authenticated pointer: 0 IA, 1 IB, 2 DA, 3 DB
+	Diversity  uint16 // the extra discriminator of an authenticated pointer
+	AddrDiv    bool   // if the address of the pointer is blended into the discriminator
+}
+
+// pointer formats of the chained fixups, DYLD_CHAINED_PTR_*
+const (
+	chainedPtrARM64E           = 1
+	chainedPtr64               = 2
+	chainedPtr32               = 3
+	chainedPtr64Offset         = 6
+	chainedPtrARM64EKernel     = 7
+	chainedPtr64KernelCache    = 8
+	chainedPtrARM64EUserland   = 9
+	chainedPtrARM64EUserland24 = 12
+)
+
+// the page starts of dyld_chained_starts_in_segment
+const (
+	chainedPageStartNone  = 0xffff
+	chainedPageStartMulti = 0x8000 // DYLD_CHAINED_PTR_START_MULTI, the index of the other starts of the page
+	chainedPageStartLast  = 0x8000 // DYLD_CHAINED_PTR_START_LAST, the last of the multiple starts
+)
+
+// the opcodes of the rebase and bind info of LC_DYLD_INFO
+const (
+	rebaseOpcodeDone                          = 0x00
+	rebaseOpcodeSetTypeImm                    = 0x10
+	rebaseOpcodeSetSegmentAndOffsetULEB       = 0x20
+	rebaseOpcodeAddAddrULEB                   = 0x30
+	rebaseOpcodeAddAddrImmScaled              = 0x40
+	rebaseOpcodeDoRebaseImmTimes              = 0x50
+	rebaseOpcodeDoRebaseULEBTimes             = 0x60
+	rebaseOpcodeDoRebaseAddAddrULEB           = 0x70
+	rebaseOpcodeDoRebaseULEBTimesSkippingULEB = 0x80
+
+	bindOpcodeDone                        = 0x00
+	bindOpcodeSetDylibOrdinalImm          = 0x10
+	bindOpcodeSetDylibOrdinalULEB         = 0x20
+	bindOpcodeSetDylibSpecialImm          = 0x30
+	bindOpcodeSetSymbolTrailingFlagsImm   = 0x40
+	bindOpcodeSetTypeImm                  = 0x50
+	bindOpcodeSetAddendSLEB               = 0x60
+	bindOpcodeSetSegmentAndOffsetULEB     = 0x70
+	bindOpcodeAddAddrULEB                 = 0x80
+	bindOpcodeDoBind                      = 0x90
+	bindOpcodeDoBindAddAddrULEB           = 0xa0
+	bindOpcodeDoBindAddAddrImmScaled      = 0xb0
+	bindOpcodeDoBindULEBTimesSkippingULEB = 0xc0
+	bindOpcodeThreaded                    = 0xd0
+	bindSymbolFlagsWeakImport             = 0x1
+	dyldInfoOpcodeMask                    = 0xf0
+	dyldInfoImmediateMask                 = 0x0f
+)
+
+// fixupTable is the decoded fixups of a Mach-O file, which are loaded on the first use
+type fixupTable struct {
+	fixups []Fixup // sorted by the addresses
+	err    error
+}
+
+// Fixups returns the fixups of the pointers in the data segments sorted by the addresses, decoded from
+// LC_DYLD_CHAINED_FIXUPS or from the rebase and bind opcodes of LC_DYLD_INFO(_ONLY). It's empty for the
+// images without any of them, e.g. the object files and the old binaries with the external relocations
+func (f *MachFile) Fixups() ([]Fixup, error) {
+	if f.fixups == nil {
+		f.fixups = &fixupTable{}
+		f.fixups.fixups, f.fixups.err = f.loadFixups()
+	}
+	return f.fixups.fixups, f.fixups.err
+}
+
+// ResolvePointer resolves the pointer at the vmaddr, e.g. of an ObjC class or a vtable entry, to the address
+// it points to or to the symbol it's bound to. The pointers without any fixup are returned as they're in the file
+func (f *MachFile) ResolvePointer(addr uint64) (Fixup, error) {
+	fixups, err := f.Fixups()
+	if err != nil {
+		return Fixup{}, err
+	}
+	i := sort.Search(len(fixups), func(i int) bool { return fixups[i].Address >= addr })
+	if i < len(fixups) && fixups[i].Address == addr {
+		return fixups[i], nil
+	}
+	raw, err := f.readPointer(addr)
+	if err != nil {
+		return Fixup{}, err
+	}
+	return Fixup{Address: addr, Target: raw}, nil
+}
+
+func (f *MachFile) loadFixups() ([]Fixup, error) {
+	fixups := make(map[uint64]Fixup)
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		if len(raw) < 8 {
+			continue
+		}
+		var err error
+		switch f.ByteOrder.Uint32(raw) {
+		case loadCmdDyldChainedFixups:
+			if len(raw) < 16 {
+				return nil, fmt.Errorf("malformed LC_DYLD_CHAINED_FIXUPS")
+			}
+			err = f.chainedFixups(f.ByteOrder.Uint32(raw[8:]), f.ByteOrder.Uint32(raw[12:]), fixups)
+		case loadCmdDyldInfo, loadCmdDyldInfoOnly:
+			if len(raw) < 48 {
+				return nil, fmt.Errorf("malformed LC_DYLD_INFO")
+			}
+			err = f.dyldInfoFixups(raw, fixups)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	list := make([]Fixup, 0, len(fixups))
+	for _, fixup := range fixups {
+		list = append(list, fixup)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Address < list[j].Address })
+	return list, nil
+}
+
+// segments returns the segments in the order of the load commands, which the segment indices of the fixups refer to
+func (f *MachFile) segments() []*macho.Segment {
+	var segs []*macho.Segment
+	for _, load := range f.Loads {
+		if seg, ok := load.(*macho.Segment); ok {
+			segs = append(segs, seg)
+		}
+	}
+	return segs
+}
+
+// linkEditData reads the data at the file offset of a load command, e.g. the chained fixups in __LINKEDIT
+func (f *MachFile) linkEditData(off, size uint32) ([]byte, error) {
+	for _, seg := range f.segments() {
+		if uint64(off) >= seg.Offset && uint64(off)+uint64(size) <= seg.Offset+seg.Filesz {
+			data := make([]byte, size)
+			if _, err := seg.ReadAt(data, int64(uint64(off)-seg.Offset)); err != nil {
+				return nil, fmt.Errorf("unable to read the data at 0x%x of segment %s: %w", off, seg.Name, err)
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("the data at 0x%x of size 0x%x is out of the segments", off, size)
+}
+
+func (f *MachFile) pointerSize() int {
+	if f.Magic == macho.Magic64 {
+		return 8
+	}
+	return 4
+}
+
+// readPointer reads the raw pointer at the vmaddr
+func (f *MachFile) readPointer(addr uint64) (uint64, error) {
+	size := f.pointerSize()
+	for _, seg := range f.segments() {
+		if addr >= seg.Addr && addr+uint64(size) <= seg.Addr+seg.Filesz {
+			b := make([]byte, size)
+			if _, err := seg.ReadAt(b, int64(addr-seg.Addr)); err != nil {
+				return 0, fmt.Errorf("unable to read the pointer at 0x%x: %w", addr, err)
+			}
+			if size == 8 {
+				return f.ByteOrder.Uint64(b), nil
+			}
+			return uint64(f.ByteOrder.Uint32(b)), nil
+		}
+	}
+	return 0, fmt.Errorf("no segment data at 0x%x", addr)
+}
+
+// chainedImport is an entry of the imports table of the chained fixups
+type chainedImport struct {
+	name       string
+	libOrdinal int
+	weakImport bool
+	addend     int64
+}
+
+// chainedFixups walks the chains of all the pages in the dyld_chained_fixups_header at the file offset
+func (f *MachFile) chainedFixups(off, size uint32, fixups map[uint64]Fixup) error {
+	data, err := f.linkEditData(off, size)
+	if err != nil {
+		return fmt.Errorf("unable to read the chained fixups: %w", err)
+	}
+	if len(data) < 28 {
+		return fmt.Errorf("malformed chained fixups header")
+	}
+	order := f.ByteOrder
+	// fixups_version, starts_offset, imports_offset, symbols_offset, imports_count, imports_format, symbols_format
+	startsOff := order.Uint32(data[4:])
+	importsOff, symbolsOff := order.Uint32(data[8:]), order.Uint32(data[12:])
+	importsCount, importsFormat := order.Uint32(data[16:]), order.Uint32(data[20:])
+	if order.Uint32(data[24:]) != 0 {
+		return fmt.Errorf("compressed symbols of the chained fixups are not supported")
+	}
+
+	var entrySize uint64
+	switch importsFormat {
+	case 1, 2: // DYLD_CHAINED_IMPORT and DYLD_CHAINED_IMPORT_ADDEND
+		entrySize = 4 * uint64(importsFormat)
+	case 3: // DYLD_CHAINED_IMPORT_ADDEND64
+		entrySize = 16
+	default:
+		return fmt.Errorf("unknown chained imports format %d", importsFormat)
+	}
+	if uint64(importsOff) > uint64(len(data)) || uint64(importsCount) > (uint64(len(data))-uint64(importsOff))/entrySize {
+		return fmt.Errorf("the %d chained imports are out of range", importsCount)
+	}
+
+	imports := make([]chainedImport, importsCount)
+	symbol := func(nameOff uint64) string {
+		if uint64(symbolsOff)+nameOff >= uint64(len(data)) {
+			return ""
+		}
+		return nulTerminated(data[uint64(symbolsOff)+nameOff:])
+	}
+	for i := range imports {
+		var imp chainedImport
+		p := uint64(importsOff) + uint64(i)*entrySize
+		switch importsFormat {
+		case 1, 2:
+			v := order.Uint32(data[p:])
+			imp = chainedImport{
+				name:       symbol(uint64(v >> 9)),
+				libOrdinal: int(v & 0xff),
+				weakImport: v>>8&1 != 0,
+			}
+			if imp.libOrdinal >= 0xfd { // the special ordinals are negative, e.g. BIND_SPECIAL_DYLIB_WEAK_LOOKUP
+				imp.libOrdinal = int(int8(v))
+			}
+			if importsFormat == 2 {
+				imp.addend = int64(int32(order.Uint32(data[p+4:])))
+			}
+		case 3:
+			v := order.Uint64(data[p:])
+			imp = chainedImport{
+				name:       symbol(v >> 32),
+				libOrdinal: int(v & 0xffff),
+				weakImport: v>>16&1 != 0,
+				addend:     int64(order.Uint64(data[p+8:])),
+			}
+			if imp.libOrdinal >= 0xfff0 {
+				imp.libOrdinal = int(int16(v))
+			}
+		}
+		imports[i] = imp
+	}
+
+	// dyld_chained_starts_in_image: seg_count and seg_info_offset[seg_count]
+	if uint64(startsOff)+4 > uint64(len(data)) {
+		return fmt.Errorf("the chained starts are out of range")
+	}
+	segs := f.segments()
+	base := uint64(0)
+	if text := f.Segment("__TEXT"); text != nil {
+		base = text.Addr
+	}
+	segCount := order.Uint32(data[startsOff:])
+	for i := uint32(0); i < segCount && int(i) < len(segs); i++ {
+		p := uint64(startsOff) + 4 + 4*uint64(i)
+		if p+4 > uint64(len(data)) {
+			return fmt.Errorf("the chained starts of segment %d are out of range", i)
+		}
+		segInfoOff := order.Uint32(data[p:])
+		if segInfoOff == 0 {
+			continue
+		}
+		if uint64(startsOff)+uint64(segInfoOff) >= uint64(len(data)) {
+			return fmt.Errorf("the chained starts of segment %d are out of range", i)
+		}
+		if err = f.chainedSegment(data[uint64(startsOff)+uint64(segInfoOff):], segs[i], base, imports, fixups); err != nil {
+			return fmt.Errorf("invalid chained fixups of segment %s: %w", segs[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// chainedSegment walks the chains of the pages of a segment from its dyld_chained_starts_in_segment
+func (f *MachFile) chainedSegment(starts []byte, seg *macho.Segment, base uint64, imports []chainedImport, fixups map[uint64]Fixup) error {
+	order := f.ByteOrder
+	// size, page_size, pointer_format, segment_offset, max_valid_pointer, page_count and page_start[page_count],
+	// which is followed by the overflow starts of the DYLD_CHAINED_PTR_32 pages with multiple starts up to the size
+	if len(starts) < 22 {
+		return fmt.Errorf("malformed chained starts")
+	}
+	if size := uint64(order.Uint32(starts)); size < uint64(len(starts)) {
+		starts = starts[:size]
+	}
+	pageSize := uint64(order.Uint16(starts[4:]))
+	format := order.Uint16(starts[6:])
+	maxValidPointer := uint64(order.Uint32(starts[16:]))
+	pageCount := int(order.Uint16(starts[20:]))
+	if len(starts) < 22+2*pageCount {
+		return fmt.Errorf("malformed chained page starts")
+	}
+	pageStart := func(i int) uint16 { return order.Uint16(starts[22+2*i:]) }
+	startCount := (len(starts) - 22) / 2
+
+	data := make([]byte, seg.Filesz)
+	if _, err := seg.ReadAt(data, 0); err != nil && err != io.EOF {
+		return fmt.Errorf("unable to read the segment data: %w", err)
+	}
+	walk := func(off uint64) error {
+		for {
+			fixup, next, err := decodeChainedPointer(format, data, off, order, maxValidPointer)
+			if err != nil {
+				return err
+			}
+			if fixup != nil {
+				fixup.Address = seg.Addr + off
+				if fixup.Bind {
+					ordinal := fixup.LibOrdinal
+					if ordinal >= len(imports) {
+						return fmt.Errorf("the bind ordinal %d at 0x%x is out of the imports", ordinal, fixup.Address)
+					}
+					imp := imports[ordinal]
+					fixup.Symbol, fixup.LibOrdinal, fixup.WeakImport = imp.name, imp.libOrdinal, imp.weakImport
+					fixup.Addend += imp.addend
+				} else if chainedTargetIsOffset(format, fixup.Auth) {
+					fixup.Target += base
+				}
+				fixups[fixup.Address] = *fixup
+			}
+			if next == 0 {
+				return nil
+			}
+			off += next
+		}
+	}
+	for i := 0; i < pageCount; i++ {
+		start := pageStart(i)
+		if start == chainedPageStartNone {
+			continue
+		}
+		pageOff := uint64(i) * pageSize
+		if format == chainedPtr32 && start&chainedPageStartMulti != 0 {
+			// the chains of the page start at page_start[start&0x7fff] and the following ones until the last
+			for j := int(start &^ chainedPageStartMulti); ; j++ {
+				if j >= startCount {
+					return fmt.Errorf("the multiple starts of page %d are out of range", i)
+				}
+				s := pageStart(j)
+				if err := walk(pageOff + uint64(s&^chainedPageStartLast)); err != nil {
+					return err
+				}
+				if s&chainedPageStartLast != 0 {
+					break
+				}
+			}
+			continue
+		}
+		if err := walk(pageOff + uint64(start)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chainedTargetIsOffset reports if the rebase targets of the pointer format are offsets from the Mach-O header
+func chainedTargetIsOffset(format uint16, auth bool) bool {
+	switch format {
+	case chainedPtrARM64E:
+		return auth
+	case chainedPtr64, chainedPtr32:
+		return false
+	}
+	return true
+}
+
+// decodeChainedPointer decodes a pointer of the chain at the offset of the segment data, and returns the offset
+// of the next pointer in the chain, or 0 if it's the last one. The fixup is nil for the non-pointers of DYLD_CHAINED_PTR_32,
+// and the LibOrdinal of a bind is the index of the chained imports
+func decodeChainedPointer(format uint16, data []byte, off uint64, order binary.ByteOrder, maxValidPointer uint64) (*Fixup, uint64, error) {
+	size := uint64(8)
+	if format == chainedPtr32 {
+		size = 4
+	}
+	if off+size > uint64(len(data)) {
+		return nil, 0, fmt.Errorf("the chained pointer at 0x%x is out of the segment", off)
+	}
+
+	switch format {
+	case chainedPtrARM64E, chainedPtrARM64EKernel, chainedPtrARM64EUserland, chainedPtrARM64EUserland24:
+		raw := order.Uint64(data[off:])
+		stride := uint64(8)
+		if format == chainedPtrARM64EKernel {
+			stride = 4
+		}
+		fixup := &Fixup{Bind: raw>>62&1 != 0, Auth: raw>>63 != 0}
+		if fixup.Auth {
+			fixup.Diversity = uint16(raw >> 32)
+			fixup.AddrDiv = raw>>48&1 != 0
+			fixup.Key = uint8(raw >> 49 & 3)
+		}
+		switch {
+		case fixup.Bind:
+			if format == chainedPtrARM64EUserland24 {
+				fixup.LibOrdinal = int(raw & 0xffffff)
+			} else {
+				fixup.LibOrdinal = int(raw & 0xffff)
+			}
+			if !fixup.Auth {
+				fixup.Addend = int64(raw<<(64-51)) >> (64 - 19) // the signed 19 bits at bit 32
+			}
+		case fixup.Auth:
+			fixup.Target = raw & 0xffffffff
+		default:
+			fixup.Target = raw&0x7ffffffffff | (raw>>43&0xff)<<56
+		}
+		return fixup, (raw >> 51 & 0x7ff) * stride, nil
+	case chainedPtr64, chainedPtr64Offset:
+		raw := order.Uint64(data[off:])
+		fixup := &Fixup{Bind: raw>>63 != 0}
+		if fixup.Bind {
+			fixup.LibOrdinal = int(raw & 0xffffff)
+			fixup.Addend = int64(raw >> 24 & 0xff)
+		} else {
+			fixup.Target = raw&0xfffffffff | (raw>>36&0xff)<<56
+		}
+		return fixup, (raw >> 51 & 0xfff) * 4, nil
+	case chainedPtr64KernelCache:
+		raw := order.Uint64(data[off:])
+		fixup := &Fixup{Target: raw & 0x3fffffff, Auth: raw>>63 != 0}
+		if fixup.Auth {
+			fixup.Diversity = uint16(raw >> 32)
+			fixup.AddrDiv = raw>>48&1 != 0
+			fixup.Key = uint8(raw >> 49 & 3)
+		}
+		return fixup, (raw >> 51 & 0xfff) * 4, nil
+	case chainedPtr32:
+		raw := uint64(order.Uint32(data[off:]))
+		next := (raw >> 26 & 0x1f) * 4
+		if raw>>31 != 0 {
+			return &Fixup{Bind: true, LibOrdinal: int(raw & 0xfffff), Addend: int64(raw >> 20 & 0x3f)}, next, nil
+		}
+		target := raw & 0x3ffffff
+		if target > maxValidPointer {
+			return nil, next, nil // a non-pointer value which shares the chain
+		}
+		return &Fixup{Target: target}, next, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported chained pointer format %d", format)
+}
+
+// dyldInfoFixups runs the rebase opcodes, then the bind, the lazy bind and the weak bind opcodes of LC_DYLD_INFO(_ONLY)
+func (f *MachFile) dyldInfoFixups(cmd []byte, fixups map[uint64]Fixup) error {
+	order := f.ByteOrder
+	read := func(offField int) ([]byte, error) {
+		off, size := order.Uint32(cmd[offField:]), order.Uint32(cmd[offField+4:])
+		if size == 0 {
+			return nil, nil
+		}
+		return f.linkEditData(off, size)
+	}
+	segs := f.segments()
+	rebase, err := read(8)
+	if err != nil {
+		return fmt.Errorf("unable to read the rebase info: %w", err)
+	}
+	if err = f.rebaseFixups(rebase, segs, fixups); err != nil {
+		return fmt.Errorf("invalid rebase info: %w", err)
+	}
+	for _, bind := range []struct {
+		name     string
+		offField int
+		weak     bool
+	}{{"bind", 16, false}, {"lazy bind", 32, false}, {"weak bind", 24, true}} {
+		data, err := read(bind.offField)
+		if err != nil {
+			return fmt.Errorf("unable to read the %s info: %w", bind.name, err)
+		}
+		if err = f.bindFixups(data, segs, bind.weak, fixups); err != nil {
+			return fmt.Errorf("invalid %s info: %w", bind.name, err)
+		}
+	}
+	return nil
+}
+
+func (f *MachFile) rebaseFixups(data []byte, segs []*macho.Segment, fixups map[uint64]Fixup) error {
+	var (
+		br      = newBytesReader(data)
+		ptrSize = uint64(f.pointerSize())
+		seg     *macho.Segment
+		off     uint64
+	)
+	rebase := func() error {
+		if seg == nil {
+			return fmt.Errorf("rebase without a segment")
+		}
+		addr := seg.Addr + off
+		target, err := f.readPointer(addr)
+		if err != nil {
+			return err
+		}
+		fixups[addr] = Fixup{Address: addr, Target: target}
+		off += ptrSize
+		return nil
+	}
+	for br.Len() > 0 {
+		b, _ := br.ReadByte()
+		imm := uint64(b & dyldInfoImmediateMask)
+		var err error
+		switch b & dyldInfoOpcodeMask {
+		case rebaseOpcodeDone:
+			return nil
+		case rebaseOpcodeSetTypeImm:
+		case rebaseOpcodeSetSegmentAndOffsetULEB:
+			if imm >= uint64(len(segs)) {
+				return fmt.Errorf("segment index %d is out of range", imm)
+			}
+			seg = segs[imm]
+			off, err = br.ReadULEB128()
+		case rebaseOpcodeAddAddrULEB:
+			var n uint64
+			n, err = br.ReadULEB128()
+			off += n
+		case rebaseOpcodeAddAddrImmScaled:
+			off += imm * ptrSize
+		case rebaseOpcodeDoRebaseImmTimes:
+			for i := uint64(0); i < imm && err == nil; i++ {
+				err = rebase()
+			}
+		case rebaseOpcodeDoRebaseULEBTimes:
+			var count uint64
+			if count, err = br.ReadULEB128(); err == nil {
+				for i := uint64(0); i < count && err == nil; i++ {
+					err = rebase()
+				}
+			}
+		case rebaseOpcodeDoRebaseAddAddrULEB:
+			if err = rebase(); err == nil {
+				var n uint64
+				n, err = br.ReadULEB128()
+				off += n
+			}
+		case rebaseOpcodeDoRebaseULEBTimesSkippingULEB:
+			var count, skip uint64
+			if count, err = br.ReadULEB128(); err == nil {
+				if skip, err = br.ReadULEB128(); err == nil {
+					for i := uint64(0); i < count && err == nil; i++ {
+						if err = rebase(); err == nil {
+							off += skip
+						}
+					}
+				}
+			}
+		default:
+			return fmt.Errorf("unknown rebase opcode 0x%x", b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindFixups runs the bind opcodes, the weak binds don't override the other binds at the same addresses
+func (f *MachFile) bindFixups(data []byte, segs []*macho.Segment, weak bool, fixups map[uint64]Fixup) error {
+	var (
+		br      = newBytesReader(data)
+		ptrSize = uint64(f.pointerSize())
+		seg     *macho.Segment
+		off     uint64
+		current Fixup
+	)
+	bind := func() error {
+		if seg == nil {
+			return fmt.Errorf("bind without a segment")
+		}
+		fixup := current
+		fixup.Address, fixup.Bind = seg.Addr+off, true
+		if existing, ok := fixups[fixup.Address]; !weak || !ok || !existing.Bind {
+			fixups[fixup.Address] = fixup
+		}
+		off += ptrSize
+		return nil
+	}
+	for br.Len() > 0 {
+		b, _ := br.ReadByte()
+		imm := uint64(b & dyldInfoImmediateMask)
+		var err error
+		switch b & dyldInfoOpcodeMask {
+		case bindOpcodeDone:
+			// the lazy binds of the symbols are separated by DONE
+		case bindOpcodeSetDylibOrdinalImm:
+			current.LibOrdinal = int(imm)
+		case bindOpcodeSetDylibOrdinalULEB:
+			var n uint64
+			n, err = br.ReadULEB128()
+			current.LibOrdinal = int(n)
+		case bindOpcodeSetDylibSpecialImm:
+			if imm == 0 {
+				current.LibOrdinal = 0
+			} else {
+				current.LibOrdinal = int(int8(0xf0 | byte(imm)))
+			}
+		case bindOpcodeSetSymbolTrailingFlagsImm:
+			current.Symbol, err = br.ReadCString()
+			current.WeakImport = imm&bindSymbolFlagsWeakImport != 0
+		case bindOpcodeSetTypeImm:
+		case bindOpcodeSetAddendSLEB:
+			current.Addend, err = br.ReadSLEB128()
+		case bindOpcodeSetSegmentAndOffsetULEB:
+			if imm >= uint64(len(segs)) {
+				return fmt.Errorf("segment index %d is out of range", imm)
+			}
+			seg = segs[imm]
+			off, err = br.ReadULEB128()
+		case bindOpcodeAddAddrULEB:
+			var n uint64
+			n, err = br.ReadULEB128()
+			off += n
+		case bindOpcodeDoBind:
+			err = bind()
+		case bindOpcodeDoBindAddAddrULEB:
+			if err = bind(); err == nil {
+				var n uint64
+				n, err = br.ReadULEB128()
+				off += n
+			}
+		case bindOpcodeDoBindAddAddrImmScaled:
+			if err = bind(); err == nil {
+				off += imm * ptrSize
+			}
+		case bindOpcodeDoBindULEBTimesSkippingULEB:
+			var count, skip uint64
+			if count, err = br.ReadULEB128(); err == nil {
+				if skip, err = br.ReadULEB128(); err == nil {
+					for i := uint64(0); i < count && err == nil; i++ {
+						if err = bind(); err == nil {
+							off += skip
+						}
+					}
+				}
+			}
+		case bindOpcodeThreaded:
+			return fmt.Errorf("the threaded binds are not supported")
+		default:
+			return fmt.Errorf("unknown bind opcode 0x%x", b)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package atos
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"testing"
+)
+
+// fixupsImage builds a 64-bit image of __TEXT at 0x100000000, the data segment at 0x100004000 (file offset 0x4000)
+// and __LINKEDIT at 0x100008000 (file offset 0x8000), with the load command of the fixups in __LINKEDIT
+func fixupsImage(t *testing.T, cpu macho.Cpu, subCpu uint32, data, fixupsCmd, linkEdit []byte) *MachFile {
+	le := binary.LittleEndian
+	var cmds []byte
+	cmds = append(cmds, testSegment64("__TEXT", 0x100000000, 0x4000, 0, 0x4000)...)
+	cmds = append(cmds, testSegment64("__DATA_CONST", 0x100004000, 0x4000, 0x4000, 0x4000)...)
+	cmds = append(cmds, testSegment64("__LINKEDIT", 0x100008000, 0x4000, 0x8000, uint64(len(linkEdit)))...)
+	cmds = append(cmds, fixupsCmd...)
+
+	b := le.AppendUint32(nil, macho.Magic64)
+	b = le.AppendUint32(b, uint32(cpu))
+	b = le.AppendUint32(b, subCpu)
+	b = le.AppendUint32(b, uint32(macho.TypeExec))
+	b = le.AppendUint32(b, 4)
+	b = le.AppendUint32(b, uint32(len(cmds)))
+	b = le.AppendUint64(b, 0)
+	b = append(b, cmds...)
+
+	file := make([]byte, 0x8000+len(linkEdit))
+	copy(file, b)
+	copy(file[0x4000:], data)
+	copy(file[0x8000:], linkEdit)
+	f, err := macho.NewFile(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &MachFile{File: f}
+}
+
+func TestChainedFixups(t *testing.T) {
+	le := binary.LittleEndian
+	// DYLD_CHAINED_PTR_ARM64E pointers at the start of __DATA_CONST, 0x10 isn't in the chain
+	data := le.AppendUint64(nil, 1<<63|1<<51|2<<49|1<<48|0x1234<<32|0x1000) // auth rebase to the offset 0x1000
+	data = le.AppendUint64(data, 2<<51|0x100001234)                         // rebase to the vmaddr
+	data = le.AppendUint64(data, 0xdeadbeef)
+	data = le.AppendUint64(data, 1<<62|1<<51|(uint64(0x7fff8)<<32)) // bind import 0 with the addend -8
+	data = le.AppendUint64(data, 1<<63|1<<62|1)                     // auth bind import 1
+
+	// dyld_chained_fixups_header, starts_in_image, starts_in_segment, the imports and the symbols
+	var blob []byte
+	for _, v := range []uint32{0, 32, 72, 80, 2, 1, 0} {
+		blob = le.AppendUint32(blob, v)
+	}
+	blob = append(blob, 0, 0, 0, 0)
+	for _, v := range []uint32{3, 0, 16, 0} {
+		blob = le.AppendUint32(blob, v)
+	}
+	blob = le.AppendUint32(blob, 24)
+	blob = le.AppendUint16(blob, 0x4000)
+	blob = le.AppendUint16(blob, chainedPtrARM64E)
+	blob = le.AppendUint64(blob, 0x4000)
+	blob = le.AppendUint32(blob, 0)
+	blob = le.AppendUint16(blob, 1)
+	blob = le.AppendUint16(blob, 0)
+	blob = le.AppendUint32(blob, 1|0<<9)       // ordinal 1
+	blob = le.AppendUint32(blob, 2|1<<8|14<<9) // ordinal 2, weak
+	blob = append(blob, "_objc_msgSend\x00_OBJC_CLASS_$_NSObject\x00"...)
+
+	cmd := le.AppendUint32(nil, loadCmdDyldChainedFixups)
+	cmd = le.AppendUint32(cmd, 16)
+	cmd = le.AppendUint32(cmd, 0x8000)
+	cmd = le.AppendUint32(cmd, uint32(len(blob)))
+	mf := fixupsImage(t, macho.CpuArm64, CpuSubTypeArm64E, data, cmd, blob)
+
+	fixups, err := mf.Fixups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixups) != 4 {
+		t.Fatalf("unexpected fixups %+v", fixups)
+	}
+	for _, want := range []Fixup{
+		{Address: 0x100004000, Target: 0x100001000, Auth: true, Key: 2, Diversity: 0x1234, AddrDiv: true},
+		{Address: 0x100004008, Target: 0x100001234},
+		{Address: 0x100004010, Target: 0xdeadbeef},
+		{Address: 0x100004018, Bind: true, Symbol: "_objc_msgSend", LibOrdinal: 1, Addend: -8},
+		{Address: 0x100004020, Bind: true, Symbol: "_OBJC_CLASS_$_NSObject", LibOrdinal: 2, WeakImport: true, Auth: true},
+	} {
+		fixup, err := mf.ResolvePointer(want.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixup != want {
+			t.Fatalf("ResolvePointer(0x%x) = %+v, want %+v", want.Address, fixup, want)
+		}
+	}
+}
+
+func TestChainedFixupsMultipleStarts(t *testing.T) {
+	le := binary.LittleEndian
+	// DYLD_CHAINED_PTR_32 rebases, the page 0 has the chains at 0 and 0x100, the page 1 has the one at 0x1000
+	data := make([]byte, 0x1004)
+	le.PutUint32(data, 0x1000)
+	le.PutUint32(data[0x100:], 0x2000)
+	le.PutUint32(data[0x1000:], 0x3000)
+
+	// dyld_chained_fixups_header, starts_in_image, and starts_in_segment with 2 pages and 2 overflow starts
+	var blob []byte
+	for _, v := range []uint32{0, 32, 74, 74, 0, 1, 0, 0} {
+		blob = le.AppendUint32(blob, v)
+	}
+	for _, v := range []uint32{2, 0, 12} {
+		blob = le.AppendUint32(blob, v)
+	}
+	blob = le.AppendUint32(blob, 30)
+	blob = le.AppendUint16(blob, 0x1000)
+	blob = le.AppendUint16(blob, chainedPtr32)
+	blob = le.AppendUint64(blob, 0x4000)
+	blob = le.AppendUint32(blob, 0x100000)
+	blob = le.AppendUint16(blob, 2)
+	for _, v := range []uint16{chainedPageStartMulti | 2, 0, 0, chainedPageStartLast | 0x100} {
+		blob = le.AppendUint16(blob, v)
+	}
+
+	cmd := le.AppendUint32(nil, loadCmdDyldChainedFixups)
+	cmd = le.AppendUint32(cmd, 16)
+	cmd = le.AppendUint32(cmd, 0x8000)
+	cmd = le.AppendUint32(cmd, uint32(len(blob)))
+	mf := fixupsImage(t, macho.CpuArm, CpuSubTypeArmV7, data, cmd, blob)
+
+	fixups, err := mf.Fixups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixups) != 3 {
+		t.Fatalf("unexpected fixups %+v", fixups)
+	}
+	for addr, target := range map[uint64]uint64{0x100004000: 0x1000, 0x100004100: 0x2000, 0x100005000: 0x3000} {
+		fixup, err := mf.ResolvePointer(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixup.Target != target {
+			t.Fatalf("ResolvePointer(0x%x) = %+v, want the target 0x%x", addr, fixup, target)
+		}
+	}
+}
+
+func TestCorruptChainedFixups(t *testing.T) {
+	le := binary.LittleEndian
+	for _, tc := range []struct {
+		importsCount uint32
+		segInfoOff   uint32
+	}{
+		{0xffffffff, 0}, // the imports count is larger than the blob
+		{0, 0x7fffffff}, // the seg_info_offset of __DATA_CONST is out of the blob
+	} {
+		var blob []byte
+		for _, v := range []uint32{0, 32, 44, 44, tc.importsCount, 1, 0, 0} {
+			blob = le.AppendUint32(blob, v)
+		}
+		for _, v := range []uint32{2, 0, tc.segInfoOff} {
+			blob = le.AppendUint32(blob, v)
+		}
+		cmd := le.AppendUint32(nil, loadCmdDyldChainedFixups)
+		cmd = le.AppendUint32(cmd, 16)
+		cmd = le.AppendUint32(cmd, 0x8000)
+		cmd = le.AppendUint32(cmd, uint32(len(blob)))
+		mf := fixupsImage(t, macho.CpuArm64, CpuSubTypeArm64E, nil, cmd, blob)
+		if _, err := mf.Fixups(); err == nil {
+			t.Fatalf("expect an error for %+v", tc)
+		}
+	}
+}
+
+func TestDyldInfoFixups(t *testing.T) {
+	le := binary.LittleEndian
+	data := le.AppendUint64(nil, 0x100001000)
+	data = le.AppendUint64(data, 0x100002000)
+
+	rebase := []byte{
+		rebaseOpcodeSetTypeImm | 1,
+		rebaseOpcodeSetSegmentAndOffsetULEB | 1, 0,
+		rebaseOpcodeDoRebaseImmTimes | 2,
+		rebaseOpcodeDone,
+	}
+	bind := []byte{bindOpcodeSetDylibOrdinalImm | 1, bindOpcodeSetSymbolTrailingFlagsImm}
+	bind = append(bind, "_malloc\x00"...)
+	bind = append(bind, bindOpcodeSetTypeImm|1, bindOpcodeSetAddendSLEB, 0x10,
+		bindOpcodeSetSegmentAndOffsetULEB|1, 0x10, bindOpcodeDoBind, bindOpcodeDone)
+	lazy := []byte{bindOpcodeSetSegmentAndOffsetULEB | 1, 0x18, bindOpcodeSetDylibSpecialImm | 0xe,
+		bindOpcodeSetSymbolTrailingFlagsImm | bindSymbolFlagsWeakImport}
+	lazy = append(lazy, "_weak\x00"...)
+	lazy = append(lazy, bindOpcodeDoBind, bindOpcodeDone)
+
+	var linkEdit []byte
+	cmd := le.AppendUint32(nil, loadCmdDyldInfoOnly)
+	cmd = le.AppendUint32(cmd, 48)
+	for _, info := range [][]byte{rebase, bind, nil, lazy, nil} { // rebase, bind, weak bind, lazy bind and export
+		if info == nil {
+			cmd = le.AppendUint64(cmd, 0)
+			continue
+		}
+		cmd = le.AppendUint32(cmd, 0x8000+uint32(len(linkEdit)))
+		cmd = le.AppendUint32(cmd, uint32(len(info)))
+		linkEdit = append(linkEdit, info...)
+	}
+	mf := fixupsImage(t, macho.CpuAmd64, 3, data, cmd, linkEdit)
+
+	fixups, err := mf.Fixups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Fixup{
+		{Address: 0x100004000, Target: 0x100001000},
+		{Address: 0x100004008, Target: 0x100002000},
+		{Address: 0x100004010, Bind: true, Symbol: "_malloc", LibOrdinal: 1, Addend: 0x10},
+		{Address: 0x100004018, Bind: true, Symbol: "_weak", LibOrdinal: -2, WeakImport: true},
+	}
+	if len(fixups) != len(want) {
+		t.Fatalf("unexpected fixups %+v", fixups)
+	}
+	for i := range want {
+		if fixups[i] != want[i] {
+			t.Fatalf("fixup %d = %+v, want %+v", i, fixups[i], want[i])
+		}
+	}
+}
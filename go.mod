@@ -2,6 +2,9 @@ module github.com/zhyee/atos-go
 
 go 1.21
 
-require go.uber.org/zap v1.27.0
+require (
+	github.com/ianlancetaylor/demangle v0.0.0-20250417193237-f615e6bd150b
+	go.uber.org/zap v1.27.0
+)
 
 require go.uber.org/multierr v1.10.0 // indirect
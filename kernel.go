@@ -0,0 +1,154 @@
+package atos
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	machoFileset        macho.Type = 0xc        // MH_FILESET, a kernel collection
+	loadCmdFilesetEntry            = 0x80000035 // LC_FILESET_ENTRY
+)
+
+// KernelFilesetEntry is the entry id of the kernel itself in a kernel collection
+const KernelFilesetEntry = "com.apple.kernel"
+
+// FilesetEntry is a Mach-O image embedded in a kernel collection (MH_FILESET), i.e. the kernel or a kext
+type FilesetEntry struct {
+	ID         string // the entry id, which is the kext bundle id, e.g. "com.apple.driver.AppleMobileFileIntegrity"
+	VMAddr     uint64 // the vmaddr of the image's Mach-O header
+	FileOffset uint64 // the file offset of the image's Mach-O header
+}
+
+// IsFileset reports if the Mach-O file is a kernel collection, e.g. a kernelcache of macOS 11+ or iOS 14+
+func (f *MachFile) IsFileset() bool {
+	return f.Type == machoFileset
+}
+
+// FilesetEntries returns the images of a kernel collection from the LC_FILESET_ENTRY load commands
+func (f *MachFile) FilesetEntries() []FilesetEntry {
+	var entries []FilesetEntry
+	for _, load := range f.Loads {
+		raw := load.Raw()
+		// cmd, cmdsize, vmaddr, fileoff, entry_id and reserved
+		if len(raw) < 32 || f.ByteOrder.Uint32(raw) != loadCmdFilesetEntry {
+			continue
+		}
+		entry := FilesetEntry{
+			VMAddr:     f.ByteOrder.Uint64(raw[8:]),
+			FileOffset: f.ByteOrder.Uint64(raw[16:]),
+		}
+		if idOff := f.ByteOrder.Uint32(raw[24:]); int(idOff) < len(raw) {
+			id := raw[idOff:]
+			if end := bytes.IndexByte(id, 0); end >= 0 {
+				id = id[:end]
+			}
+			entry.ID = string(id)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// filesetReader reads an image embedded in a kernel collection, whose Mach-O header and load commands
+// start at the entry's file offset, but the segment, section and symbol table offsets are relative to
+// the start of the collection
+type filesetReader struct {
+	r         io.ReaderAt
+	base      int64
+	headerLen int64
+}
+
+func (fr *filesetReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < fr.headerLen {
+		return fr.r.ReadAt(p, fr.base+off)
+	}
+	return fr.r.ReadAt(p, off)
+}
+
+// filesetEntryFile parses the Mach-O header and the load commands of an image in a kernel collection
+func filesetEntryFile(r io.ReaderAt, order binary.ByteOrder, entry FilesetEntry) (*macho.File, error) {
+	header := make([]byte, 32)
+	if _, err := r.ReadAt(header, int64(entry.FileOffset)); err != nil {
+		return nil, fmt.Errorf("unable to read the Mach-O header of [%s]: %w", entry.ID, err)
+	}
+	sizeOfCmds := order.Uint32(header[20:])
+	f, err := macho.NewFile(&filesetReader{
+		r:         r,
+		base:      int64(entry.FileOffset),
+		headerLen: 32 + int64(sizeOfCmds),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Mach-O image [%s] in the kernel collection: %w", entry.ID, err)
+	}
+	return f, nil
+}
+
+// ParseFilesetEntry parses the image of the entry id in a kernel collection, e.g. KernelFilesetEntry or a kext bundle id
+func ParseFilesetEntry(r io.ReaderAt, id string, arch Arch) (*MachFile, error) {
+	collection, err := Parse(r, arch)
+	if err != nil {
+		return nil, err
+	}
+	if !collection.IsFileset() {
+		return nil, fmt.Errorf("not a kernel collection (MH_FILESET) but file type %s", collection.Type)
+	}
+	var (
+		entry FilesetEntry
+		found bool
+	)
+	for _, e := range collection.FilesetEntries() {
+		if e.ID == id {
+			entry, found = e, true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no entry [%s] in the kernel collection", id)
+	}
+
+	f, err := filesetEntryFile(r, collection.ByteOrder, entry)
+	if err != nil {
+		return nil, err
+	}
+	mf := &MachFile{name: id, r: r, File: f}
+	if err = mf.load(false); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return mf, nil
+}
+
+// OpenFilesetEntry opens the image of the entry id in a kernel collection file, the images of
+// a kernel collection usually have no debug info and are symbolicated from their symbol tables
+func OpenFilesetEntry(file, id string, arch Arch) (*MachFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %v", file, err)
+	}
+	mf, err := ParseFilesetEntry(f, id, arch)
+	if err != nil {
+		defer f.Close()
+		return nil, fmt.Errorf("unable to parse kernel collection [%s]: %w", file, err)
+	}
+	return mf, nil
+}
+
+// TextExecVMAddr returns the vmaddr of __TEXT_EXEC, where the code of the kernel and the kexts is,
+// or the vmaddr of __TEXT for the other images
+func (f *MachFile) TextExecVMAddr() uint64 {
+	if seg := f.Segment("__TEXT_EXEC"); seg != nil {
+		return seg.Addr
+	}
+	return f.vmAddr
+}
+
+// SetTextExecAddress sets the slide from the runtime address of __TEXT_EXEC, which the kernel panic
+// reports print as "Kernel text exec base" for the kernel, and in "Kernel Extensions in backtrace" for the kexts
+func (f *MachFile) SetTextExecAddress(addr uint64) {
+	f.loadSlide = addr - f.TextExecVMAddr()
+}
@@ -0,0 +1,159 @@
+package atos
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// filesetUUID is the LC_UUID of the test image at vmaddr
+func filesetUUID(vmaddr uint64) [16]byte {
+	var uuid [16]byte
+	binary.BigEndian.PutUint64(uuid[:], vmaddr)
+	binary.BigEndian.PutUint64(uuid[8:], ^vmaddr)
+	return uuid
+}
+
+// filesetImage builds an embedded image of a kernel collection at the file offset base, with a
+// __TEXT_EXEC,__text section of 0x100 bytes at vmaddr+0x1000 and a function symbol at every 0x40 bytes
+func filesetImage(base, vmaddr uint64, fileType macho.Type, funcs ...string) []byte {
+	le := binary.LittleEndian
+	textOff := base + 0x400
+	symOff := textOff + 0x100
+	strOff := symOff + 16*uint64(len(funcs))
+
+	var cmds []byte
+	cmds = append(cmds, testSegment64("__TEXT", vmaddr, 0x1000, base, 0x400)...)
+	cmds = append(cmds, testSegment64("__TEXT_EXEC", vmaddr+0x1000, 0x1000, textOff, 0x100,
+		testSection64("__text", "__TEXT_EXEC", vmaddr+0x1000, 0x100, uint32(textOff), 0, 0, 0))...)
+
+	var syms, strs []byte
+	strs = append(strs, 0)
+	for i, name := range funcs {
+		syms = le.AppendUint32(syms, uint32(len(strs)))
+		syms = append(syms, 0x0f, 1) // N_SECT|N_EXT in section 1
+		syms = le.AppendUint16(syms, 0)
+		syms = le.AppendUint64(syms, vmaddr+0x1000+uint64(i)*0x40)
+		strs = append(append(strs, "_"+name...), 0)
+	}
+	cmds = le.AppendUint32(cmds, uint32(macho.LoadCmdSymtab))
+	cmds = le.AppendUint32(cmds, 24)
+	cmds = le.AppendUint32(cmds, uint32(symOff))
+	cmds = le.AppendUint32(cmds, uint32(len(funcs)))
+	cmds = le.AppendUint32(cmds, uint32(strOff))
+	cmds = le.AppendUint32(cmds, uint32(len(strs)))
+	uuid := filesetUUID(vmaddr)
+	cmds = le.AppendUint32(cmds, loadCmdUUID)
+	cmds = le.AppendUint32(cmds, 24)
+	cmds = append(cmds, uuid[:]...)
+
+	b := le.AppendUint32(nil, macho.Magic64)
+	b = le.AppendUint32(b, uint32(macho.CpuArm64))
+	b = le.AppendUint32(b, 0x80000000|CpuSubTypeArm64E) // with the pointer authentication ABI bit
+	b = le.AppendUint32(b, uint32(fileType))
+	b = le.AppendUint32(b, 4)
+	b = le.AppendUint32(b, uint32(len(cmds)))
+	b = le.AppendUint64(b, 0) // flags and reserved
+	b = append(b, cmds...)
+
+	// the offsets above are absolute in the collection
+	image := make([]byte, strOff+uint64(len(strs))-base)
+	copy(image, b)
+	copy(image[symOff-base:], syms)
+	copy(image[strOff-base:], strs)
+	return image
+}
+
+func writeFileset(t *testing.T) string {
+	le := binary.LittleEndian
+	entry := func(id string, vmaddr, fileoff uint64) []byte {
+		size := (32 + len(id) + 1 + 7) &^ 7
+		b := le.AppendUint32(nil, loadCmdFilesetEntry)
+		b = le.AppendUint32(b, uint32(size))
+		b = le.AppendUint64(b, vmaddr)
+		b = le.AppendUint64(b, fileoff)
+		b = le.AppendUint32(b, 32) // entry_id offset
+		b = le.AppendUint32(b, 0)
+		b = append(b, id...)
+		return append(b, make([]byte, size-len(b))...)
+	}
+	cmds := append(entry(KernelFilesetEntry, 0xfffffe0007004000, 0x1000), entry("com.example.driver", 0xfffffe0007104000, 0x2000)...)
+
+	b := le.AppendUint32(nil, macho.Magic64)
+	b = le.AppendUint32(b, uint32(macho.CpuArm64))
+	b = le.AppendUint32(b, 0x80000000|CpuSubTypeArm64E)
+	b = le.AppendUint32(b, uint32(machoFileset))
+	b = le.AppendUint32(b, 2)
+	b = le.AppendUint32(b, uint32(len(cmds)))
+	b = le.AppendUint64(b, 0)
+	b = append(b, cmds...)
+
+	data := make([]byte, 0x3000)
+	copy(data, b)
+	copy(data[0x1000:], filesetImage(0x1000, 0xfffffe0007004000, macho.TypeExec, "panic", "kernel_func"))
+	copy(data[0x2000:], filesetImage(0x2000, 0xfffffe0007104000, 0xb, "driver_start", "driver_crash"))
+	file := filepath.Join(t.TempDir(), "kernelcache")
+	if err := os.WriteFile(file, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestKernelCollection(t *testing.T) {
+	file := writeFileset(t)
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collection, err := Parse(f, ArchARM64e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := collection.FilesetEntries()
+	_ = collection.Close()
+	if !collection.IsFileset() || len(entries) != 2 || entries[1].ID != "com.example.driver" || entries[1].FileOffset != 0x2000 {
+		t.Fatalf("unexpected fileset entries: %+v", entries)
+	}
+
+	// OpenMachO opens the kernel of a kernel collection
+	kernel, err := OpenMachO(file, ArchARM64e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kernel.Close()
+	if kernel.ImageName() != KernelFilesetEntry || kernel.TextExecVMAddr() != 0xfffffe0007005000 {
+		t.Fatalf("unexpected kernel image %s with __TEXT_EXEC at 0x%x", kernel.ImageName(), kernel.TextExecVMAddr())
+	}
+	kernel.SetTextExecAddress(0xfffffe0027ec4000)
+	symbol, err := kernel.Atos(0xfffffe0027ec4048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Func != "kernel_func" || symbol.FuncOffset != 8 {
+		t.Fatalf("unexpected kernel symbol %+v", symbol)
+	}
+
+	kext, err := OpenFilesetEntry(file, "com.example.driver", ArchARM64e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kext.Close()
+	kext.SetTextExecAddress(0xfffffe00293b8000)
+	frames, err := kext.Frames(0xfffffe00293b8010)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || frames[0].Func != "driver_start" || frames[0].FuncStart != 0xfffffe00293b8000 {
+		t.Fatalf("unexpected kext frames %+v", frames)
+	}
+	if _, err = kext.Atos(0xfffffe00293b8200); err == nil {
+		t.Fatal("expect an error for the PC beyond __TEXT_EXEC,__text")
+	}
+
+	if _, err = OpenFilesetEntry(file, "com.example.missing", ArchARM64e); err == nil {
+		t.Fatal("expect an error for the missing entry")
+	}
+}
@@ -0,0 +1,105 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LineZeroPolicy controls how a PC is resolved when its line table row has line 0, which the
+// compilers emit for the code not attributable to any source line, e.g. the blocks and thunks they generate
+type LineZeroPolicy int
+
+const (
+	// LineZeroKeep reports line 0 as is, which is the behavior of Apple's atos
+	LineZeroKeep LineZeroPolicy = iota
+	// LineZeroNearest takes the nearest preceding non-zero row in the same sequence,
+	// and falls back to the DW_AT_decl_line of the function if there is none
+	LineZeroNearest
+	// LineZeroDeclLine takes the DW_AT_decl_line of the function
+	LineZeroDeclLine
+)
+
+var lineZeroPolicies = map[string]LineZeroPolicy{
+	"keep":    LineZeroKeep,
+	"nearest": LineZeroNearest,
+	"decl":    LineZeroDeclLine,
+}
+
+// ParseLineZeroPolicy parses the name of a LineZeroPolicy, i.e. "keep", "nearest" or "decl"
+func ParseLineZeroPolicy(name string) (LineZeroPolicy, error) {
+	if p, ok := lineZeroPolicies[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return p, nil
+	}
+	return LineZeroKeep, fmt.Errorf("unknown line zero policy: %s", name)
+}
+
+// SetLineZeroPolicy sets how the PCs of line 0 are resolved, the default is LineZeroKeep,
+// the guessed lines are flagged by Symbol.Approximate
+func (d *dwarfImage) SetLineZeroPolicy(p LineZeroPolicy) {
+	d.lineZero = p
+}
+
+// fixLineZero replaces the line 0 row of the location following the policy
+func (d *dwarfImage) fixLineZero(loc *dwarfLocation, lr *dwarf.LineReader, vmAddr uint64) {
+	if d.lineZero == LineZeroNearest {
+		prev, err := nearestNonZeroLine(lr, vmAddr)
+		if err != nil {
+			Log.Debugf("unable to find the nearest line of [0x%x]: %v", vmAddr, err)
+		}
+		if prev != nil {
+			loc.line, loc.approximate = *prev, true
+			return
+		}
+	}
+
+	// the innermost function declares the code at the PC
+	fn := loc.subprogram
+	if len(loc.inlined) > 0 {
+		fn = loc.inlined[len(loc.inlined)-1]
+	}
+	declLine, ok := entryAttr(d.dwarf, fn, dwarf.AttrDeclLine).(int64)
+	if !ok || declLine <= 0 {
+		return
+	}
+	line := loc.line
+	line.Line, line.Column = int(declLine), 0
+	if declFile, ok := entryAttr(d.dwarf, fn, dwarf.AttrDeclFile).(int64); ok && declFile >= 0 && int(declFile) < len(loc.files) && loc.files[declFile] != nil {
+		line.File = loc.files[declFile]
+	}
+	loc.line, loc.approximate = line, true
+}
+
+// nearestNonZeroLine returns the last row with a non-zero line before vmAddr in the sequence containing vmAddr
+func nearestNonZeroLine(lr *dwarf.LineReader, vmAddr uint64) (*dwarf.LineEntry, error) {
+	lr.Reset()
+	var (
+		le, nearest dwarf.LineEntry
+		found       bool
+		seqStart    uint64
+		seqBegun    bool
+	)
+	for {
+		if err := lr.Next(&le); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if le.EndSequence {
+			if seqBegun && seqStart <= vmAddr && vmAddr < le.Address && found {
+				return &nearest, nil
+			}
+			found, seqBegun = false, false
+			continue
+		}
+		if !seqBegun {
+			seqStart, seqBegun = le.Address, true
+		}
+		if le.Address <= vmAddr && le.Line != 0 {
+			nearest, found = le, true
+		}
+	}
+}
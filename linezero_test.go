@@ -0,0 +1,50 @@
+package atos
+
+import (
+	"testing"
+)
+
+func TestLineZeroPolicy(t *testing.T) {
+	mf, err := OpenMachO("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mf.Close()
+
+	// the row of 0x100003f80 in main has line 0
+	cases := []struct {
+		policy      LineZeroPolicy
+		line        int
+		approximate bool
+	}{
+		{LineZeroKeep, 0, false},
+		{LineZeroNearest, 18, true},
+		{LineZeroDeclLine, 15, true},
+	}
+	for _, c := range cases {
+		mf.SetLineZeroPolicy(c.policy)
+		symbol, err := mf.Atos(0x100003f84)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if symbol.Func != "main" || symbol.Line != c.line || symbol.Approximate != c.approximate || symbol.File != "/Users/zy/segment.c" {
+			t.Errorf("policy %d: unexpected symbol %+v", c.policy, symbol)
+		}
+	}
+
+	// the rows of non-zero lines are never approximate
+	symbol, err := mf.Atos(0x100003f9c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if symbol.Line != 21 || symbol.Approximate {
+		t.Fatalf("unexpected symbol %+v", symbol)
+	}
+
+	if p, err := ParseLineZeroPolicy("Nearest"); err != nil || p != LineZeroNearest {
+		t.Fatalf("unexpected policy %d, %v", p, err)
+	}
+	if _, err := ParseLineZeroPolicy("closest"); err == nil {
+		t.Fatal("expect an error for the unknown policy")
+	}
+}
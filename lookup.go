@@ -0,0 +1,163 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AddressRange is a runtime address range found by a reverse lookup
+type AddressRange struct {
+	Low     uint64 // the first address
+	High    uint64 // the end address, exclusive
+	Func    string // the innermost function containing the range
+	Inlined bool   // the range is an inlined copy of Func
+	File    string // the source file of a line lookup
+	Line    int
+}
+
+// ParseLookupQuery splits a query of the form "file:line", e.g. "Crasher.mm:42", otherwise the query is
+// a function name, e.g. "-[Crasher throwUncaughtNSException]" or "foo::bar"
+func ParseLookupQuery(query string) (file string, line int, ok bool) {
+	idx := strings.LastIndexByte(query, ':')
+	if idx <= 0 || idx == len(query)-1 {
+		return "", 0, false
+	}
+	line, err := strconv.Atoi(query[idx+1:])
+	if err != nil || line <= 0 {
+		return "", 0, false
+	}
+	return query[:idx], line, true
+}
+
+// LookupName returns the address ranges of the function of the name, including the inlined copies
+func (d *dwarfImage) LookupName(name string) ([]AddressRange, error) {
+	subs, err := d.LookupFunction(name)
+	if err != nil {
+		return nil, err
+	}
+	var ranges []AddressRange
+	for _, sub := range subs {
+		for _, rg := range sub.PCRanges {
+			ranges = append(ranges, AddressRange{Low: rg[0], High: rg[1], Func: sub.Name, Inlined: sub.Inlined})
+		}
+	}
+	sortAddressRanges(ranges)
+	return ranges, nil
+}
+
+// matchSourceFile reports if the path of the line table is the queried file, which is either
+// a full path or a trailing part of it, e.g. "Crasher.mm" or "App/Crasher.mm"
+func matchSourceFile(path, file string) bool {
+	return path == file || strings.HasSuffix(path, "/"+file)
+}
+
+// lineFunc is a subprogram or an inlined subroutine of a CU with its ranges
+type lineFunc struct {
+	entry  *dwarf.Entry
+	ranges [][2]uint64
+}
+
+// LookupLine returns the address ranges generated for the source line from the line tables,
+// the ranges of the inlined copies are tagged with the function they are inlined from
+func (d *dwarfImage) LookupLine(file string, line int) ([]AddressRange, error) {
+	if d.dwarf == nil {
+		return nil, errNoDWARF
+	}
+	var (
+		ranges []AddressRange
+		cu     []AddressRange // the ranges of the current CU
+		funcs  []lineFunc     // the functions of the current CU in pre-order
+	)
+	finishCU := func() {
+		for i := range cu {
+			// the innermost function goes last in pre-order
+			for j := len(funcs) - 1; j >= 0; j-- {
+				if rangesContain(funcs[j].ranges, cu[i].Low) {
+					cu[i].Func = entryName(d.dwarf, funcs[j].entry)
+					cu[i].Inlined = funcs[j].entry.Tag == dwarf.TagInlinedSubroutine
+					break
+				}
+			}
+			cu[i].Low += d.loadSlide
+			cu[i].High += d.loadSlide
+		}
+		ranges = append(ranges, cu...)
+		cu, funcs = nil, nil
+	}
+
+	r := d.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unable to iterate DIEs: %w", err)
+		}
+		if entry == nil {
+			break
+		}
+		switch entry.Tag {
+		case dwarf.TagCompileUnit, dwarf.TagPartialUnit:
+			finishCU()
+			if cu, err = d.lineRanges(entry, file, line); err != nil {
+				return nil, err
+			}
+			if len(cu) == 0 {
+				r.SkipChildren()
+			}
+		case dwarf.TagSubprogram, dwarf.TagInlinedSubroutine:
+			fnRanges, err := d.dwarf.Ranges(entry)
+			if err != nil {
+				Log.Debugf("unable to parse the ranges of DIE at 0x%x: %v", entry.Offset, err)
+				continue
+			}
+			if len(fnRanges) > 0 {
+				funcs = append(funcs, lineFunc{entry: entry, ranges: fnRanges})
+			}
+		}
+	}
+	finishCU()
+	sortAddressRanges(ranges)
+	return ranges, nil
+}
+
+// lineRanges collects the line table rows of the source line in the CU, the adjacent rows are merged
+func (d *dwarfImage) lineRanges(cu *dwarf.Entry, file string, line int) ([]AddressRange, error) {
+	lr, err := d.dwarf.LineReader(cu)
+	if err != nil {
+		return nil, fmt.Errorf("unable to init the line table's reader: %w", err)
+	}
+	if lr == nil {
+		return nil, nil
+	}
+	var (
+		ranges   []AddressRange
+		prev, le dwarf.LineEntry
+		havePrev bool
+	)
+	for {
+		if err = lr.Next(&le); err != nil {
+			if errors.Is(err, io.EOF) {
+				return ranges, nil
+			}
+			return nil, fmt.Errorf("unable to read line table: %w", err)
+		}
+		if havePrev && le.Address > prev.Address && prev.Line == line && matchSourceFile(prev.File.Name, file) {
+			if n := len(ranges); n > 0 && ranges[n-1].High == prev.Address && ranges[n-1].File == prev.File.Name {
+				ranges[n-1].High = le.Address
+			} else {
+				ranges = append(ranges, AddressRange{Low: prev.Address, High: le.Address, File: prev.File.Name, Line: line})
+			}
+		}
+		prev, havePrev = le, !le.EndSequence && le.File != nil
+	}
+}
+
+func sortAddressRanges(ranges []AddressRange) {
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].Low < ranges[j].Low
+	})
+}
@@ -0,0 +1,64 @@
+package atos
+
+import (
+	"testing"
+)
+
+func TestParseLookupQuery(t *testing.T) {
+	cases := []struct {
+		query string
+		file  string
+		line  int
+		ok    bool
+	}{
+		{"Crasher.mm:42", "Crasher.mm", 42, true},
+		{"/src/App/main.m:18", "/src/App/main.m", 18, true},
+		{"main", "", 0, false},
+		{"-[Crasher throwUncaughtNSException]", "", 0, false},
+		{"-[NSObject performSelector:withObject:]", "", 0, false},
+		{"foo::bar", "", 0, false},
+		{"main.m:", "", 0, false},
+		{":12", "", 0, false},
+	}
+	for _, c := range cases {
+		file, line, ok := ParseLookupQuery(c.query)
+		if file != c.file || line != c.line || ok != c.ok {
+			t.Errorf("ParseLookupQuery(%q) = %q, %d, %v", c.query, file, line, ok)
+		}
+	}
+}
+
+func TestReverseLookup(t *testing.T) {
+	ef, err := OpenELF("testdata/inline.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	ef.SetLoadAddress(0x5550000000)
+
+	ranges, err := ef.LookupName("compute")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 1 || ranges[0] != (AddressRange{Low: 0x5550001150, High: 0x555000116e, Func: "compute"}) {
+		t.Fatalf("unexpected ranges of compute: %+v", ranges)
+	}
+
+	// square is inlined twice into sum_squares, which is inlined into compute
+	ranges, err = ef.LookupLine("inline.c", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ranges) != 2 {
+		t.Fatalf("expect 2 inlined copies of inline.c:5, got %+v", ranges)
+	}
+	for _, rg := range ranges {
+		if rg.Func != "square" || !rg.Inlined || rg.File != "/src/inline.c" || rg.Line != 5 || rg.Low < 0x5550001150 {
+			t.Fatalf("unexpected range of inline.c:5: %+v", rg)
+		}
+	}
+
+	if ranges, err = ef.LookupLine("other.c", 5); err != nil || len(ranges) != 0 {
+		t.Fatalf("expect no range, got %+v, %v", ranges, err)
+	}
+}
@@ -0,0 +1,308 @@
+package atos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// KernelPanic is a kernel panic report of macOS or iOS, i.e. the panic string of a panic-full-*.ips
+// file or a legacy .panic file
+type KernelPanic struct {
+	Panic              string // the first line, e.g. "panic(cpu 0 caller 0xfffffe0017c7f0a8): ..."
+	OSVersion          string // the build, e.g. "19C56"
+	KernelVersion      string // e.g. "Darwin Kernel Version 21.2.0: ...; root:xnu-8019.62.2~1/RELEASE_ARM64_T8101"
+	KernelUUID         [16]byte
+	HasKernelUUID      bool
+	KernelSlide        uint64
+	KernelTextBase     uint64
+	KernelTextExecBase uint64 // the runtime address of the kernel __TEXT_EXEC, 0 on x86_64
+	Backtraces         []PanicBacktrace
+	Kexts              []PanicKext // the kexts in the backtraces and their dependencies
+}
+
+// PanicBacktrace is the backtrace of a CPU or the panicked thread
+type PanicBacktrace struct {
+	Title  string   // e.g. "Backtrace (CPU 0), panicked thread: 0xffffff8b4b7dc540, Frame : Return Address"
+	Frames []uint64 // the return addresses, the innermost first
+}
+
+// PanicKext is a kext of "Kernel Extensions in backtrace", e.g.
+// "com.apple.driver.AppleAVE2(501.26.1)[1F3A2D4B-...]@0xfffffe0019ad8000->0xfffffe0019b5ffff"
+type PanicKext struct {
+	ID         string // the bundle id
+	Version    string
+	UUID       [16]byte
+	Start, End uint64 // the runtime address range, Start is the address of __TEXT_EXEC
+	Dependency bool   // if it's listed as a dependency of a kext in the backtrace
+}
+
+// Contains reports if the runtime address is in the kext
+func (k *PanicKext) Contains(addr uint64) bool {
+	return addr >= k.Start && addr <= k.End
+}
+
+var panicKextRegexp = regexp.MustCompile(`^(dependency:\s*)?(\S+)\(([^)]*)\)\[([0-9A-Fa-f-]+)\]@(0x[0-9A-Fa-f]+)->(0x[0-9A-Fa-f]+)`)
+
+// ParseKernelPanic parses a kernel panic report, the panic-full-*.ips files of macOS 12+ and iOS 15+
+// are a JSON header line followed by a JSON body with the panic string, the legacy .panic files are plain text
+func ParseKernelPanic(r io.Reader) (*KernelPanic, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the panic report: %w", err)
+	}
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("{")) {
+		if data, err = ipsPanicString(data); err != nil {
+			return nil, err
+		}
+	}
+
+	p := &KernelPanic{}
+	var (
+		bt     *PanicBacktrace
+		inKext bool
+	)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			bt, inKext = nil, false
+			continue
+		}
+		if p.Panic == "" && strings.HasPrefix(line, "panic(") {
+			p.Panic = line
+			continue
+		}
+		if strings.HasPrefix(line, "Backtrace (") ||
+			strings.HasPrefix(line, "Panicked thread:") && strings.Contains(line, "backtrace:") {
+			p.Backtraces = append(p.Backtraces, PanicBacktrace{Title: line})
+			bt, inKext = &p.Backtraces[len(p.Backtraces)-1], false
+			continue
+		}
+		if strings.HasPrefix(line, "Kernel Extensions in backtrace") {
+			inKext = true
+			continue
+		}
+		if inKext {
+			if kext, ok := parsePanicKext(line); ok {
+				p.addKext(kext)
+				continue
+			}
+			inKext = false
+		}
+		if bt != nil {
+			if pc, ok := parsePanicFrame(line); ok {
+				bt.Frames = append(bt.Frames, pc)
+				continue
+			}
+			bt = nil
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "OS version":
+			p.OSVersion = value
+		case "Kernel version":
+			p.KernelVersion = value
+		case "Kernel UUID":
+			if p.KernelUUID, err = ParseUUID(value); err != nil {
+				return nil, fmt.Errorf("invalid kernel UUID: %w", err)
+			}
+			p.HasKernelUUID = true
+		case "Kernel slide":
+			p.KernelSlide, err = strconv.ParseUint(value, 0, 64)
+		case "Kernel text base":
+			p.KernelTextBase, err = strconv.ParseUint(value, 0, 64)
+		case "Kernel text exec base":
+			p.KernelTextExecBase, err = strconv.ParseUint(value, 0, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s [%s]: %w", key, value, err)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read the panic report: %w", err)
+	}
+	if len(p.Backtraces) == 0 {
+		return nil, fmt.Errorf("no backtrace found in the panic report")
+	}
+	return p, nil
+}
+
+// ipsPanicString extracts the panic string from the JSON body of a panic-full-*.ips file
+func ipsPanicString(data []byte) ([]byte, error) {
+	// the first line is the header, e.g. {"bug_type":"210","os_version":"iPhone OS 15.2 (19C56)",...}
+	_, body, _ := bytes.Cut(data, []byte("\n"))
+	var report struct {
+		PanicString string `json:"panicString"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		return nil, fmt.Errorf("invalid panic-full .ips body: %w", err)
+	}
+	if report.PanicString == "" {
+		return nil, fmt.Errorf("no panicString in the .ips file")
+	}
+	return []byte(report.PanicString), nil
+}
+
+// parsePanicFrame parses a frame of the arm64 form "lr: 0xfffffe0017c6e4a8  fp: 0xfffffe1b2ff0b5f0"
+// or of the x86_64 form "0xffffffa0cfa1b970 : 0xffffff8018a9d2fd"
+func parsePanicFrame(line string) (uint64, bool) {
+	var s string
+	if strings.HasPrefix(line, "lr:") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return 0, false
+		}
+		s = fields[1]
+	} else {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[1] != ":" {
+			return 0, false
+		}
+		s = fields[2]
+	}
+	pc, err := strconv.ParseUint(s, 0, 64)
+	return pc, err == nil && pc != 0
+}
+
+func parsePanicKext(line string) (PanicKext, bool) {
+	m := panicKextRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return PanicKext{}, false
+	}
+	uuid, err := ParseUUID(m[4])
+	if err != nil {
+		return PanicKext{}, false
+	}
+	start, _ := strconv.ParseUint(m[5], 0, 64)
+	end, _ := strconv.ParseUint(m[6], 0, 64)
+	return PanicKext{
+		ID:         m[2],
+		Version:    m[3],
+		UUID:       uuid,
+		Start:      start,
+		End:        end,
+		Dependency: m[1] != "",
+	}, true
+}
+
+// addKext adds a kext unless it's listed already, e.g. in the backtrace of another CPU
+func (p *KernelPanic) addKext(kext PanicKext) {
+	for i := range p.Kexts {
+		if p.Kexts[i].UUID == kext.UUID && p.Kexts[i].Start == kext.Start {
+			p.Kexts[i].Dependency = p.Kexts[i].Dependency && kext.Dependency
+			return
+		}
+	}
+	p.Kexts = append(p.Kexts, kext)
+}
+
+// Kext returns the kext which the runtime address belongs to
+func (p *KernelPanic) Kext(addr uint64) (*PanicKext, bool) {
+	for i := range p.Kexts {
+		if p.Kexts[i].Contains(addr) {
+			return &p.Kexts[i], true
+		}
+	}
+	return nil, false
+}
+
+// PanicFrame is a symbolicated frame of a kernel panic backtrace
+type PanicFrame struct {
+	BacktraceFrame
+	Image string // KernelFilesetEntry for the kernel or the bundle id of a kext
+}
+
+// textExecSetter is implemented by the Mach-O images, whose panic addresses are relative to __TEXT_EXEC
+type textExecSetter interface {
+	SetTextExecAddress(addr uint64)
+}
+
+// Symbolicate resolves the backtraces with the kernel and the kext symbols of the UUIDs in the store,
+// the kernel is slid by "Kernel text exec base" or "Kernel slide", and a kext by its start address.
+// The frames are return addresses and always adjusted, see BacktraceOptions.ReturnAddresses
+func (p *KernelPanic) Symbolicate(store *SymbolStore, opts BacktraceOptions) [][]PanicFrame {
+	opts.ReturnAddresses = true
+
+	type image struct {
+		sym Symbolizer
+		err error
+	}
+	images := make(map[string]*image)
+	defer func() {
+		for _, img := range images {
+			if img.sym != nil {
+				_ = img.sym.Close()
+			}
+		}
+	}()
+	open := func(addr uint64) (string, *image) {
+		if kext, ok := p.Kext(addr); ok {
+			if img := images[kext.ID]; img != nil {
+				return kext.ID, img
+			}
+			img := &image{}
+			var entry *StoreEntry
+			if img.sym, entry, img.err = openStoreEntries(kext.UUID, store.Lookup(kext.UUID)); img.err == nil {
+				if ts, ok := img.sym.(textExecSetter); ok {
+					ts.SetTextExecAddress(kext.Start)
+				} else {
+					img.sym.SetLoadAddress(kext.Start)
+				}
+				if opts.ImageOpened != nil {
+					opts.ImageOpened(img.sym, entry.Path)
+				}
+			}
+			images[kext.ID] = img
+			return kext.ID, img
+		}
+
+		if img := images[KernelFilesetEntry]; img != nil {
+			return KernelFilesetEntry, img
+		}
+		img := &image{}
+		var entry *StoreEntry
+		if !p.HasKernelUUID {
+			img.err = fmt.Errorf("no kernel UUID in the panic report")
+		} else if img.sym, entry, img.err = openStoreEntries(p.KernelUUID, store.Lookup(p.KernelUUID)); img.err == nil {
+			if ts, ok := img.sym.(textExecSetter); ok && p.KernelTextExecBase != 0 {
+				ts.SetTextExecAddress(p.KernelTextExecBase)
+			} else {
+				img.sym.SetLoadSlide(p.KernelSlide)
+			}
+			if opts.ImageOpened != nil {
+				opts.ImageOpened(img.sym, entry.Path)
+			}
+		}
+		images[KernelFilesetEntry] = img
+		return KernelFilesetEntry, img
+	}
+
+	backtraces := make([][]PanicFrame, len(p.Backtraces))
+	for i, bt := range p.Backtraces {
+		frames := make([]PanicFrame, len(bt.Frames))
+		for j, pc := range bt.Frames {
+			name, img := open(pc)
+			frames[j].Image = name
+			if img.err != nil {
+				frames[j].PC, frames[j].LookupPC, frames[j].Err = pc, pc, img.err
+				continue
+			}
+			frames[j].BacktraceFrame = SymbolicateFrame(img.sym, pc, j, opts)
+		}
+		backtraces[i] = frames
+	}
+	return backtraces
+}
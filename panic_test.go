@@ -0,0 +1,125 @@
+package atos
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testPanicString is an arm64 panic string of the kernel and the kext in writeFileset, and of
+// a.out loaded as a kext, which has no __TEXT_EXEC and is slid by its __TEXT
+const testPanicString = `panic(cpu 4 caller 0xfffffe0029000050): "driver_crash: bad state" @driver.cpp:42
+Debugger message: panic
+OS version: 19C56
+Kernel version: Darwin Kernel Version 21.2.0: Sun Nov 28 20:43:40 PST 2021; root:xnu-8019.62.2~1/RELEASE_ARM64_T8101
+Kernel UUID: FFFFFE00-0700-4000-0000-01FFF8FFBFFF
+Kernel slide:      0x0000000020ec0000
+Kernel text base:  0xfffffe0027ec3000
+Kernel text exec base:  0xfffffe0027ec4000
+
+Panicked task 0xfffffe1b2e5d4a58: 0 pages, 188 threads: pid 0: kernel_task
+Panicked thread: 0xfffffe1b2e8e8000, backtrace: 0xfffffe1b2ff0b580, tid: 5301
+		  lr: 0xfffffe0027ec4048  fp: 0xfffffe1b2ff0b5f0
+		  lr: 0xfffffe0029000050  fp: 0xfffffe1b2ff0b660
+		  lr: 0xfffffe0030003f00  fp: 0xfffffe1b2ff0b6d0
+		  lr: 0xfffffe002a000010  fp: 0x0000000000000000
+      Kernel Extensions in backtrace:
+         com.example.driver(1.0)[FFFFFE00-0710-4000-0000-01FFF8EFBFFF]@0xfffffe0029000000->0xfffffe0029000fff
+         com.example.aout(2.1)[6D5A41E1-4474-3744-BFF4-785083F1020E]@0xfffffe0030000000->0xfffffe0030007fff
+            dependency: com.example.missing(1)[00000000-0000-0000-0000-000000000001]@0xfffffe002a000000->0xfffffe002a000fff
+
+last started kext at 1234: com.example.driver	1.0 (addr 0xfffffe0029000000, size 4096)
+`
+
+func TestParseKernelPanic(t *testing.T) {
+	body, _ := json.Marshal(map[string]string{"build": "iPhone OS 15.2 (19C56)", "panicString": testPanicString})
+	ips := `{"bug_type":"210","os_version":"iPhone OS 15.2 (19C56)"}` + "\n" + string(body)
+
+	for name, report := range map[string]string{"panic-full.ips": ips, "legacy.panic": testPanicString} {
+		p, err := ParseKernelPanic(strings.NewReader(report))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !strings.HasPrefix(p.Panic, "panic(cpu 4") || p.OSVersion != "19C56" || !p.HasKernelUUID ||
+			p.KernelUUID != filesetUUID(0xfffffe0007004000) {
+			t.Fatalf("%s: unexpected panic info %+v", name, p)
+		}
+		if p.KernelSlide != 0x20ec0000 || p.KernelTextBase != 0xfffffe0027ec3000 || p.KernelTextExecBase != 0xfffffe0027ec4000 {
+			t.Fatalf("%s: unexpected kernel addresses %+v", name, p)
+		}
+		if len(p.Backtraces) != 1 || len(p.Backtraces[0].Frames) != 4 || p.Backtraces[0].Frames[1] != 0xfffffe0029000050 {
+			t.Fatalf("%s: unexpected backtraces %+v", name, p.Backtraces)
+		}
+		if len(p.Kexts) != 3 || p.Kexts[1].ID != "com.example.aout" || p.Kexts[1].Version != "2.1" ||
+			p.Kexts[0].Dependency || !p.Kexts[2].Dependency || p.Kexts[0].End != 0xfffffe0029000fff {
+			t.Fatalf("%s: unexpected kexts %+v", name, p.Kexts)
+		}
+	}
+
+	x86 := `Backtrace (CPU 0), panicked thread: 0xffffff8b4b7dc540, Frame : Return Address
+0xffffffa0cfa1b970 : 0xffffff8018a9d2fd mach_kernel : _handle_debugger_trap + 0x3fd
+0xffffffa0cfa1b9c0 : 0xffffff7f9b4f5010
+      Kernel Extensions in backtrace:
+         com.apple.driver.AppleIntelCPUPowerManagement(222.0)[E0C1A7E6-1D3C-3C5A-9F8B-2A4B5C6D7E8F]@0xffffff7f9b4f4000->0xffffff7f9b51efff
+
+BSD process name corresponding to current thread: kernel_task
+`
+	p, err := ParseKernelPanic(strings.NewReader(x86))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Backtraces) != 1 || len(p.Backtraces[0].Frames) != 2 || p.Backtraces[0].Frames[0] != 0xffffff8018a9d2fd {
+		t.Fatalf("unexpected x86_64 backtraces %+v", p.Backtraces)
+	}
+	if kext, ok := p.Kext(0xffffff7f9b4f5010); !ok || kext.ID != "com.apple.driver.AppleIntelCPUPowerManagement" {
+		t.Fatalf("unexpected kext of the frame: %+v", kext)
+	}
+
+	if _, err = ParseKernelPanic(strings.NewReader("panic(cpu 0 caller 0x0): no backtrace")); err == nil {
+		t.Fatal("expect an error for the report without any backtrace")
+	}
+}
+
+func TestSymbolicateKernelPanic(t *testing.T) {
+	kernelcache := writeFileset(t)
+	store, err := NewSymbolStore(filepath.Dir(kernelcache), "testdata/a.out.dSYM")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParseKernelPanic(strings.NewReader(testPanicString))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backtraces := p.Symbolicate(store, BacktraceOptions{})
+	if len(backtraces) != 1 || len(backtraces[0]) != 4 {
+		t.Fatalf("unexpected backtraces %+v", backtraces)
+	}
+	frames := backtraces[0]
+	for i, want := range []struct {
+		image, fn string
+		offset    uint64
+	}{
+		{KernelFilesetEntry, "kernel_func", 8},
+		{"com.example.driver", "driver_crash", 0x10},
+		{"com.example.aout", "fib", 0x1c},
+	} {
+		frame := frames[i]
+		if frame.Err != nil {
+			t.Fatalf("frame %d: %v", i, frame.Err)
+		}
+		if frame.Image != want.image || frame.Symbols[0].Func != want.fn || frame.Symbols[0].FuncOffset != want.offset {
+			t.Fatalf("frame %d: unexpected %s %+v", i, frame.Image, frame.Symbols[0])
+		}
+		if frame.LookupPC != frame.PC-4 {
+			t.Fatalf("frame %d: the return address 0x%x is not adjusted", i, frame.PC)
+		}
+	}
+	if frames[2].Symbols[0].Line != 5 {
+		t.Fatalf("unexpected line of the dSYM frame %+v", frames[2].Symbols[0])
+	}
+	if frames[3].Image != "com.example.missing" || frames[3].Err == nil {
+		t.Fatalf("expect an error for the kext without symbols: %+v", frames[3])
+	}
+}
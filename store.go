@@ -0,0 +1,324 @@
+package atos
+
+import (
+	"bufio"
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// StoreEntry is a symbol file of an image found in a SymbolStore
+type StoreEntry struct {
+	Path      string
+	UUID      [16]byte
+	Arch      Arch
+	FilesetID string // the entry id if the image is embedded in a kernel collection
+	DylibPath string // the install path if the image is in a dyld shared cache
+	HasDWARF  bool   // if the image has DWARF debug info, e.g. a dSYM
+	Breakpad  bool   // if it's a Breakpad .sym file
+	OSVersion string // the OS version of the device support directory which the file is in, e.g. "15.2 (19C56)"
+}
+
+// Open opens the symbol file of the entry
+func (e *StoreEntry) Open() (Symbolizer, error) {
+	switch {
+	case e.Breakpad:
+		return OpenBreakpad(e.Path)
+	case e.FilesetID != "":
+		return OpenFilesetEntry(e.Path, e.FilesetID, e.Arch)
+	case e.DylibPath != "":
+		return OpenDyldCacheImage(e.Path, e.DylibPath)
+	}
+	return openMachO(e.Path, e.Arch, e.HasDWARF)
+}
+
+// SymbolStore indexes the symbol files under some directories by UUID, i.e. the dSYMs and the binaries
+// of the apps and the kexts, the kernel collections (e.g. the kernelcaches of a KDK), the dyld shared
+// caches and the Breakpad .sym files
+type SymbolStore struct {
+	index         map[[16]byte][]*StoreEntry
+	deviceSupport []*deviceSupportDir
+	osVersion     string // the OS version of the entries being added, see addDir
+}
+
+// deviceSupportDir is a version directory of an Xcode device support directory, which is indexed on demand
+type deviceSupportDir struct {
+	path    string
+	os      OSVersion
+	indexed bool
+}
+
+// NewSymbolStore creates a symbol store of the symbol files under the directories
+func NewSymbolStore(dirs ...string) (*SymbolStore, error) {
+	s := &SymbolStore{index: make(map[[16]byte][]*StoreEntry)}
+	for _, dir := range dirs {
+		if err := s.AddDir(dir); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddDir indexes all the symbol files under the directory recursively, the files of
+// unknown formats are skipped
+func (s *SymbolStore) AddDir(dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if err = s.AddFile(path); err != nil {
+			Log.Debugf("skip [%s] in the symbol store: %v", path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to index the symbol store [%s]: %w", dir, err)
+	}
+	return nil
+}
+
+// AddDeviceSupport registers an Xcode device support directory, e.g. "~/Library/Developer/Xcode/iOS DeviceSupport",
+// of which the version directories like "15.2 (19C56)" or "iPhone14,2 15.2 (19C56)" hold the unslid system
+// libraries under Symbols. The version directories are only indexed when the OS version is looked up, see LookupOS
+func (s *SymbolStore) AddDeviceSupport(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read the device support directory [%s]: %w", dir, err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		v := ParseOSVersion(entry.Name())
+		if v.Version == "" {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name(), "Symbols")
+		if _, err = os.Stat(path); err != nil {
+			path = filepath.Join(dir, entry.Name())
+		}
+		s.deviceSupport = append(s.deviceSupport, &deviceSupportDir{path: path, os: v})
+	}
+	return nil
+}
+
+// indexDeviceSupport indexes the device support directories of the OS version,
+// or all of them if none matches, e.g. the crash report has no OS version
+func (s *SymbolStore) indexDeviceSupport(v OSVersion) error {
+	var dirs []*deviceSupportDir
+	for _, d := range s.deviceSupport {
+		if d.os.Matches(v) {
+			dirs = append(dirs, d)
+		}
+	}
+	if len(dirs) == 0 {
+		dirs = s.deviceSupport
+	}
+	for _, d := range dirs {
+		if d.indexed {
+			continue
+		}
+		d.indexed = true
+		s.osVersion = d.os.String()
+		err := s.AddDir(d.path)
+		s.osVersion = ""
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddFile indexes the images of a Mach-O (fat) file, a kernel collection, a dyld shared cache or a Breakpad .sym file
+func (s *SymbolStore) AddFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	magic := make([]byte, 7)
+	n, _ := f.ReadAt(magic, 0)
+	if bytes.Equal(magic[:n], []byte("MODULE ")) {
+		return s.addBreakpad(path, f)
+	}
+	if bytes.Equal(magic[:n], []byte(dyldCacheMagic)) {
+		return s.addDyldCache(path)
+	}
+	if n < 4 {
+		return fmt.Errorf("unknown file format")
+	}
+	if binary.BigEndian.Uint32(magic) == macho.MagicFat {
+		ff, err := macho.NewFatFile(f)
+		if err != nil {
+			return fmt.Errorf("invalid Fat Mach-O file: %w", err)
+		}
+		for _, fa := range ff.Arches {
+			s.addMachO(path, io.NewSectionReader(f, int64(fa.Offset), int64(fa.Size)), fa.File)
+		}
+		return nil
+	}
+	mf, err := macho.NewFile(f)
+	if err != nil {
+		return fmt.Errorf("unknown file format: %w", err)
+	}
+	s.addMachO(path, f, mf)
+	return nil
+}
+
+func (s *SymbolStore) addMachO(path string, r io.ReaderAt, f *macho.File) {
+	arch := Arch{Cpu: f.Cpu, SubCpu: f.SubCpu & cpuSubTypeMask}
+	if f.Type != machoFileset {
+		s.add(path, &MachFile{File: f}, arch, "")
+		return
+	}
+	for _, entry := range (&MachFile{File: f}).FilesetEntries() {
+		ef, err := filesetEntryFile(r, f.ByteOrder, entry)
+		if err != nil {
+			Log.Debugf("skip [%s] of the kernel collection [%s]: %v", entry.ID, path, err)
+			continue
+		}
+		s.add(path, &MachFile{File: ef}, arch, entry.ID)
+	}
+}
+
+func (s *SymbolStore) add(path string, mf *MachFile, arch Arch, filesetID string) {
+	uuid, ok := mf.UUID()
+	if !ok {
+		return
+	}
+	s.index[uuid] = append(s.index[uuid], &StoreEntry{
+		Path:      path,
+		UUID:      uuid,
+		Arch:      arch,
+		FilesetID: filesetID,
+		HasDWARF:  mf.Section("__debug_info") != nil || mf.Section("__zdebug_info") != nil,
+		OSVersion: s.osVersion,
+	})
+}
+
+// addDyldCache indexes the dylibs of a dyld shared cache, the subcaches and the .symbols
+// files have no images and are skipped
+func (s *SymbolStore) addDyldCache(path string) error {
+	c, err := OpenDyldCache(path)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, image := range c.Images() {
+		if image.UUID == ([16]byte{}) {
+			continue
+		}
+		s.index[image.UUID] = append(s.index[image.UUID], &StoreEntry{
+			Path:      path,
+			UUID:      image.UUID,
+			Arch:      c.Arch(),
+			DylibPath: image.Path,
+			OSVersion: s.osVersion,
+		})
+	}
+	return nil
+}
+
+func (s *SymbolStore) addBreakpad(path string, r io.Reader) error {
+	line, _, err := bufio.NewReader(r).ReadLine()
+	if err != nil {
+		return fmt.Errorf("unable to read the MODULE record: %w", err)
+	}
+	// MODULE operatingsystem architecture id name
+	fields := strings.SplitN(string(line), " ", 5)
+	if len(fields) != 5 {
+		return fmt.Errorf("malformed MODULE record")
+	}
+	bf := &BreakpadFile{id: fields[3]}
+	uuid, ok := bf.UUID()
+	if !ok {
+		return fmt.Errorf("invalid Breakpad debug identifier %s", fields[3])
+	}
+	arch, _ := ParseArch(fields[2])
+	s.index[uuid] = append(s.index[uuid], &StoreEntry{Path: path, UUID: uuid, Arch: arch, Breakpad: true, OSVersion: s.osVersion})
+	return nil
+}
+
+// Len returns the number of the indexed images
+func (s *SymbolStore) Len() int {
+	n := 0
+	for _, entries := range s.index {
+		n += len(entries)
+	}
+	return n
+}
+
+// Lookup returns the symbol files of the UUID, the ones with DWARF debug info go first,
+// then the Mach-O binaries and the Breakpad files
+func (s *SymbolStore) Lookup(uuid [16]byte) []*StoreEntry {
+	entries := append([]*StoreEntry(nil), s.index[uuid]...)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].HasDWARF != entries[j].HasDWARF {
+			return entries[i].HasDWARF
+		}
+		return !entries[i].Breakpad && entries[j].Breakpad
+	})
+	return entries
+}
+
+// Open opens the best symbol file of the UUID, see Lookup
+func (s *SymbolStore) Open(uuid [16]byte) (Symbolizer, error) {
+	sym, _, err := openStoreEntries(uuid, s.Lookup(uuid))
+	return sym, err
+}
+
+// LookupOS is Lookup after indexing the device support directories of the OS version, see AddDeviceSupport
+func (s *SymbolStore) LookupOS(uuid [16]byte, v OSVersion) []*StoreEntry {
+	if err := s.indexDeviceSupport(v); err != nil {
+		Log.Debugf("unable to index the device support of OS version [%s]: %v", v, err)
+	}
+	return s.Lookup(uuid)
+}
+
+// OpenOS opens the best symbol file of the UUID, see LookupOS
+func (s *SymbolStore) OpenOS(uuid [16]byte, v OSVersion) (Symbolizer, error) {
+	sym, _, err := openStoreEntries(uuid, s.LookupOS(uuid, v))
+	return sym, err
+}
+
+// openStoreEntries opens the first entry which can be opened, and returns it with the symbolizer
+func openStoreEntries(uuid [16]byte, entries []*StoreEntry) (Symbolizer, *StoreEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil, fmt.Errorf("no symbol file of UUID %s in the symbol store", FormatUUID(uuid))
+	}
+	var lastErr error
+	for _, entry := range entries {
+		sym, err := entry.Open()
+		if err == nil {
+			return sym, entry, nil
+		}
+		Log.Debugf("unable to open [%s] for UUID %s: %v", entry.Path, FormatUUID(uuid), err)
+		lastErr = err
+	}
+	return nil, nil, lastErr
+}
+
+// ParseUUID parses a UUID of the canonical form, with or without the dashes
+func ParseUUID(s string) ([16]byte, error) {
+	var uuid [16]byte
+	h := strings.ReplaceAll(strings.TrimSpace(s), "-", "")
+	if len(h) != 32 {
+		return uuid, fmt.Errorf("invalid UUID %q", s)
+	}
+	if _, err := hex.Decode(uuid[:], []byte(h)); err != nil {
+		return uuid, fmt.Errorf("invalid UUID %q: %w", s, err)
+	}
+	return uuid, nil
+}
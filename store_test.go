@@ -0,0 +1,60 @@
+package atos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSymbolStore(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.out.sym"), []byte(testBreakpadSym), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a symbol file"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	kernelcache := writeFileset(t)
+
+	store, err := NewSymbolStore(dir, "testdata/a.out.dSYM", filepath.Dir(kernelcache))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 4 {
+		t.Fatalf("expect the dSYM, the .sym file and 2 fileset entries, got %d images", store.Len())
+	}
+
+	uuid, err := ParseUUID("6D5A41E1-4474-3744-BFF4-785083F1020E")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := store.Lookup(uuid)
+	if len(entries) != 2 || !entries[0].HasDWARF || !entries[1].Breakpad || entries[0].Arch != ArchARM64 {
+		t.Fatalf("unexpected entries of a.out: %+v", entries)
+	}
+	sym, err := store.Open(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sym.(*MachFile); !ok {
+		t.Fatalf("expect the dSYM to be opened first, got %T", sym)
+	}
+	_ = sym.Close()
+
+	kext := store.Lookup(filesetUUID(0xfffffe0007104000))
+	if len(kext) != 1 || kext[0].FilesetID != "com.example.driver" || kext[0].Arch != ArchARM64e {
+		t.Fatalf("unexpected entries of the kext: %+v", kext)
+	}
+	sym, err = store.Open(kext[0].UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sym.ImageName() != "com.example.driver" {
+		t.Fatalf("unexpected kext image %s", sym.ImageName())
+	}
+	_ = sym.Close()
+
+	if _, err = store.Open([16]byte{1}); err == nil {
+		t.Fatal("expect an error for an unknown UUID")
+	}
+}
@@ -0,0 +1,85 @@
+package atos
+
+import (
+	"bytes"
+	"debug/dwarf"
+	"debug/elf"
+	"fmt"
+	"os"
+)
+
+// Symbolizer is the common interface of the symbol sources, e.g. *MachFile and *BreakpadFile,
+// so that the callers can mix different backends or plug in their own ones
+type Symbolizer interface {
+	// Atos resolves the function and the source line of a runtime PC
+	Atos(pc uint64) (*Symbol, error)
+	// Frames resolves a runtime PC to its inlined call chain, the innermost frame goes first
+	// and the last one is the function which the PC really belongs to
+	Frames(pc uint64) ([]*Symbol, error)
+	// UUID returns the identifier which matches a binary with its debug symbols
+	UUID() ([16]byte, bool)
+	Arch() Arch
+	// ImageName returns the name of the binary image, e.g. "App"
+	ImageName() string
+	// VMAddr returns the address at which the binary image was built
+	VMAddr() uint64
+	SetLoadAddress(lAddr uint64)
+	LoadAddress() uint64
+	SetLoadSlide(loadSlide uint64)
+	LoadSlide() uint64
+	Close() error
+}
+
+var (
+	_ Symbolizer = (*MachFile)(nil)
+	_ Symbolizer = (*BreakpadFile)(nil)
+	_ Symbolizer = (*ELFFile)(nil)
+)
+
+// DWARFSymbolizer is a Symbolizer backed by DWARF debug info, i.e. *MachFile and *ELFFile,
+// which supports the lookups needing more than the line table and the symbol table
+type DWARFSymbolizer interface {
+	Symbolizer
+	// LookupName returns the address ranges of the function, including the inlined copies
+	LookupName(name string) ([]AddressRange, error)
+	// LookupLine returns the address ranges generated for the source line, including the inlined copies
+	LookupLine(file string, line int) ([]AddressRange, error)
+	// FrameVariables lists the parameters and the local variables in scope at a runtime PC with their locations
+	FrameVariables(pc uint64) ([]FrameVariable, error)
+	// CompileUnits lists the compile units with their producers, source files and the lines having code
+	CompileUnits() ([]*CompileUnit, error)
+	// LookupTypeDefinitions returns the DIE offsets of the type definitions of the name, to be dumped with DWARFData
+	LookupTypeDefinitions(name string) ([]dwarf.Offset, error)
+	// DWARFData returns the DWARF debug info, nil if it's not loaded
+	DWARFData() *dwarf.Data
+}
+
+var (
+	_ DWARFSymbolizer = (*MachFile)(nil)
+	_ DWARFSymbolizer = (*ELFFile)(nil)
+)
+
+// FormatUUID formats a UUID in the canonical upper case form, e.g. "6D5A41E1-4474-3744-BFF4-785083F1020E"
+func FormatUUID(uuid [16]byte) string {
+	return fmt.Sprintf("%X-%X-%X-%X-%X", uuid[:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+}
+
+// Open opens a symbol file of any supported format, a Breakpad .sym file is detected by
+// its leading MODULE record and an ELF file by its magic, otherwise it's opened as Mach-O
+func Open(file string, arch Arch) (Symbolizer, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open file %s: %v", file, err)
+	}
+	magic := make([]byte, 7)
+	n, _ := f.Read(magic)
+	_ = f.Close()
+
+	if bytes.Equal(magic[:n], []byte("MODULE ")) {
+		return OpenBreakpad(file)
+	}
+	if bytes.HasPrefix(magic[:n], []byte(elf.ELFMAG)) {
+		return OpenELF(file)
+	}
+	return OpenMachO(file, arch)
+}
@@ -0,0 +1,59 @@
+package atos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenSymbolizer(t *testing.T) {
+	machO, err := Open("testdata/a.out.dSYM/Contents/Resources/DWARF/a.out", ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer machO.Close()
+	if _, ok := machO.(*MachFile); !ok {
+		t.Fatalf("expect a *MachFile, got %T", machO)
+	}
+	if uuid, ok := machO.UUID(); !ok || FormatUUID(uuid) != "6D5A41E1-4474-3744-BFF4-785083F1020E" {
+		t.Fatalf("unexpected UUID %s", FormatUUID(uuid))
+	}
+
+	symFile := filepath.Join(t.TempDir(), "a.out.sym")
+	out, err := os.Create(symFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = machO.(*MachFile).WriteBreakpadSymbols(out, "a.out"); err != nil {
+		t.Fatal(err)
+	}
+	_ = out.Close()
+
+	breakpad, err := Open(symFile, ArchARM64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer breakpad.Close()
+	if _, ok := breakpad.(*BreakpadFile); !ok {
+		t.Fatalf("expect a *BreakpadFile, got %T", breakpad)
+	}
+
+	machO.SetLoadAddress(0x104480000)
+	breakpad.SetLoadAddress(0x104480000)
+	for _, sym := range []Symbolizer{machO, breakpad} {
+		if sym.ImageName() != "a.out" || sym.Arch() != ArchARM64 {
+			t.Errorf("%T: unexpected image %s %s", sym, sym.ImageName(), sym.Arch())
+		}
+		uuid, ok := sym.UUID()
+		if !ok || uuid != [16]byte{0x6d, 0x5a, 0x41, 0xe1, 0x44, 0x74, 0x37, 0x44, 0xbf, 0xf4, 0x78, 0x50, 0x83, 0xf1, 0x02, 0x0e} {
+			t.Errorf("%T: unexpected UUID %x", sym, uuid)
+		}
+		frames, err := sym.Frames(0x104483f9c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(frames) != 1 || frames[0].Func != "main" || frames[0].Line != 21 {
+			t.Errorf("%T: unexpected frames %+v", sym, frames)
+		}
+	}
+}
@@ -0,0 +1,16 @@
+	.section	__TEXT,__text,regular,pure_instructions
+	.globl	_add
+	.p2align	2
+_add:
+	add	w0, w0, w1
+	ret
+
+	.globl	_main
+	.p2align	2
+_main:
+	stp	x29, x30, [sp, #-16]!
+	mov	w0, #1
+	mov	w1, #2
+	bl	_add
+	ldp	x29, x30, [sp], #16
+	ret
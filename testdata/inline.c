@@ -0,0 +1,23 @@
+#include <stdio.h>
+
+static inline int square(int x)
+{
+	return x * x;
+}
+
+static inline int sum_squares(int a, int b)
+{
+	return square(a) + square(b);
+}
+
+__attribute__((noinline)) int compute(int a, int b)
+{
+	int s = sum_squares(a, b);
+	printf("%d\n", s);
+	return s;
+}
+
+int main(int argc, char **argv)
+{
+	return compute(argc, argc + 1);
+}
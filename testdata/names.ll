@@ -0,0 +1,26 @@
+target triple = "x86_64-unknown-linux-gnu"
+
+define dso_local i32 @Square(i32 %x) !dbg !10 {
+  %r = mul i32 %x, %x, !dbg !14
+  ret i32 %r, !dbg !14
+}
+
+define dso_local i32 @main() !dbg !15 {
+  %r = call i32 @Square(i32 3), !dbg !16
+  ret i32 %r, !dbg !16
+}
+
+!llvm.dbg.cu = !{!0}
+!llvm.module.flags = !{!3, !4}
+
+!0 = distinct !DICompileUnit(language: DW_LANG_C99, file: !1, producer: "clang", isOptimized: false, runtimeVersion: 0, emissionKind: FullDebug, nameTableKind: Default)
+!1 = !DIFile(filename: "names.c", directory: "/src")
+!3 = !{i32 7, !"Dwarf Version", i32 5}
+!4 = !{i32 2, !"Debug Info Version", i32 3}
+!10 = distinct !DISubprogram(name: "Square", scope: !1, file: !1, line: 1, type: !11, scopeLine: 1, spFlags: DISPFlagDefinition, unit: !0)
+!11 = !DISubroutineType(types: !12)
+!12 = !{!13, !13}
+!13 = !DIBasicType(name: "int", size: 32, encoding: DW_ATE_signed)
+!14 = !DILocation(line: 2, column: 3, scope: !10)
+!15 = distinct !DISubprogram(name: "main", scope: !1, file: !1, line: 5, type: !11, scopeLine: 5, spFlags: DISPFlagDefinition, unit: !0)
+!16 = !DILocation(line: 6, column: 3, scope: !15)
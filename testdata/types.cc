@@ -0,0 +1,43 @@
+#include <stdint.h>
+
+typedef int (*handler_t)(int);
+
+enum Color { Red, Green, Blue = 4 };
+
+struct Point {
+	int x;
+	int y;
+};
+
+typedef struct Point Point_t;
+
+struct Base {
+	virtual ~Base() {}
+	long id;
+};
+
+union Value {
+	int64_t i;
+	double d;
+	const char *s;
+};
+
+struct Widget : Base {
+	char tag;
+	Point_t origin;
+	unsigned flags : 3;
+	unsigned visible : 1;
+	const char *name;
+	int matrix[2][3];
+	handler_t handler;
+	Color color;
+	Value value;
+	Widget *next;
+};
+
+Widget gWidget;
+
+int main()
+{
+	return gWidget.tag;
+}
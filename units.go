@@ -0,0 +1,109 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// CompileUnit is a compile unit of the DWARF debug info, i.e. a source file compiled into the image
+type CompileUnit struct {
+	Name     string // DW_AT_name, the main source file, e.g. "App/main.m"
+	CompDir  string // DW_AT_comp_dir, the working directory of the compiler
+	Producer string // DW_AT_producer, the compiler and often its flags, e.g. "Apple clang version 15.0.0 (clang-1500.0.40.1)"
+	Language int64  // DW_AT_language, e.g. 0x0c of C99 or 0x10 of Objective-C, 0 if unknown
+	Files    []*SourceFile
+}
+
+// SourceFile is a file of the line table of a compile unit, e.g. the main source file or an included header
+type SourceFile struct {
+	Path  string // the path joined with its include directory and the compilation dir
+	Lines []int  // the lines having code in the unit, in ascending order, empty if none
+}
+
+// CompileUnits lists the compile units with the source files of their line tables, and the lines having code of each
+// file. A header included by several units is listed in each of them with the lines of its code in the unit
+func (d *dwarfImage) CompileUnits() ([]*CompileUnit, error) {
+	if d.dwarf == nil {
+		return nil, errNoDWARF
+	}
+	var units []*CompileUnit
+	r := d.dwarf.Reader()
+	for {
+		entry, err := r.Next()
+		if err != nil {
+			return units, fmt.Errorf("unable to iterate CUs: %w", err)
+		}
+		if entry == nil {
+			return units, nil
+		}
+		if entry.Tag != dwarf.TagCompileUnit && entry.Tag != dwarf.TagPartialUnit {
+			r.SkipChildren()
+			continue
+		}
+		unit := &CompileUnit{}
+		unit.Name, _ = entry.Val(dwarf.AttrName).(string)
+		unit.CompDir, _ = entry.Val(dwarf.AttrCompDir).(string)
+		unit.Producer, _ = entry.Val(dwarf.AttrProducer).(string)
+		unit.Language, _ = entry.Val(dwarf.AttrLanguage).(int64)
+		if unit.Files, err = d.unitFiles(entry); err != nil {
+			return units, fmt.Errorf("unable to read the line table of CU %s: %w", unit.Name, err)
+		}
+		units = append(units, unit)
+		r.SkipChildren()
+	}
+}
+
+// unitFiles reads the file table and the rows of the line table of a CU
+func (d *dwarfImage) unitFiles(cu *dwarf.Entry) ([]*SourceFile, error) {
+	lr, err := d.dwarf.LineReader(cu)
+	if err != nil || lr == nil {
+		return nil, err // no line table if both are nil
+	}
+	var (
+		files  []*SourceFile
+		byName = make(map[string]*SourceFile)
+		lines  = make(map[*SourceFile]map[int]bool)
+	)
+	file := func(lf *dwarf.LineFile) *SourceFile {
+		if sf, ok := byName[lf.Name]; ok {
+			return sf
+		}
+		sf := &SourceFile{Path: lf.Name}
+		byName[lf.Name] = sf
+		files = append(files, sf)
+		return sf
+	}
+	for _, lf := range lr.Files() {
+		if lf != nil {
+			file(lf)
+		}
+	}
+
+	var row dwarf.LineEntry
+	for {
+		if err = lr.Next(&row); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return files, err
+		}
+		if row.EndSequence || row.Line == 0 || row.File == nil {
+			continue
+		}
+		sf := file(row.File)
+		if lines[sf] == nil {
+			lines[sf] = make(map[int]bool)
+		}
+		lines[sf][row.Line] = true
+	}
+	for sf, set := range lines {
+		sf.Lines = make([]int, 0, len(set))
+		for line := range set {
+			sf.Lines = append(sf.Lines, line)
+		}
+		sort.Ints(sf.Lines)
+	}
+	return files, nil
+}
@@ -0,0 +1,38 @@
+package atos
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompileUnits(t *testing.T) {
+	ef, err := OpenELF("testdata/inline.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+
+	units, err := ef.CompileUnits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(units) != 1 {
+		t.Fatalf("unexpected compile units %+v", units)
+	}
+	unit := units[0]
+	if unit.Name != "inline.c" || unit.CompDir != "/src" || unit.Language != 0x1d ||
+		unit.Producer != "GNU C17 12.2.0 -mtune=generic -march=x86-64 -g -gz=zlib -O2 -fasynchronous-unwind-tables" {
+		t.Fatalf("unexpected compile unit %+v", unit)
+	}
+	// the file table of DWARF 5 lists inline.c twice, as the primary source file and the file 1
+	want := []*SourceFile{
+		{Path: "/src/inline.c", Lines: []int{3, 5, 8, 10, 14, 15, 16, 17, 18, 21, 22}},
+		{Path: "/usr/include/stdio.h"},
+	}
+	if !reflect.DeepEqual(unit.Files, want) {
+		for _, f := range unit.Files {
+			t.Logf("%+v", *f)
+		}
+		t.Fatal("unexpected source files")
+	}
+}
@@ -0,0 +1,576 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zhyee/atos-go/dwarftype"
+)
+
+// FrameVariable is a formal parameter or a local variable in scope at a PC
+type FrameVariable struct {
+	Name        string
+	Type        string // the declared type in C syntax, e.g. "const char *"
+	Parameter   bool   // if it's a formal parameter of the function
+	Function    string // the function declaring it, which is an inlined function if InlineDepth > 0
+	InlineDepth int    // the depth of the function in the inlined call chain, 0 is the function the PC belongs to
+	DeclFile    string
+	DeclLine    int
+	// Location is the DWARF location expression valid at the PC, see FormatLocation,
+	// nil if the variable is optimized out at the PC. A leading DW_OP_addrx or DW_OP_constx of DWARF 5,
+	// e.g. of a static local, is replaced by DW_OP_addr or DW_OP_const4u/8u of the address in __debug_addr
+	Location []byte
+}
+
+// FrameVariables lists the formal parameters and the local variables in scope at a runtime PC, including the ones
+// of the lexical blocks and the inlined functions containing it. Like Frames, the variables of the innermost inlined
+// function go first, the ones of each function are in the order of their declarations
+func (d *dwarfImage) FrameVariables(pc uint64) ([]FrameVariable, error) {
+	if d.dwarf == nil {
+		return nil, errNoDWARF
+	}
+	vmAddr := pc - d.loadSlide
+	cu, err := d.LocateCUEntry(vmAddr)
+	if err != nil {
+		return nil, err
+	}
+	if cu.Tag != dwarf.TagCompileUnit && cu.Tag != dwarf.TagPartialUnit {
+		return nil, fmt.Errorf("expect a compile unit entry but got %s", cu.Tag.String())
+	}
+	var files []*dwarf.LineFile
+	if lr, err := d.dwarf.LineReader(cu); err == nil && lr != nil {
+		files = lr.Files()
+	}
+	locs := &locationLists{d: d, cu: cu}
+	locs.version, locs.addrSize = d.unitHeader(cu.Offset)
+
+	for {
+		entry, err := d.dwarfReader.Next()
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch CU Subprogram entry: %w", err)
+		}
+		if entry == nil || entry.Tag == dwarf.TagCompileUnit || entry.Tag == dwarf.TagPartialUnit {
+			break
+		}
+		if entry.Tag != dwarf.TagSubprogram {
+			continue
+		}
+		ranges, err := d.dwarf.Ranges(entry)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse subprogram ranges: %w", err)
+		}
+		if !rangesContain(ranges, vmAddr) {
+			if entry.Children {
+				d.dwarfReader.SkipChildren()
+			}
+			continue
+		}
+		if !entry.Children {
+			return nil, nil
+		}
+		return d.scopeVariables(entry, vmAddr, files, locs)
+	}
+	return nil, fmt.Errorf("unable to find subprogram entry")
+}
+
+// scopeVariables walks the children of the subprogram which the reader is positioned at, and collects the
+// variables of the lexical blocks and the inlined subroutines containing vmAddr
+func (d *dwarfImage) scopeVariables(subprogram *dwarf.Entry, vmAddr uint64, files []*dwarf.LineFile, locs *locationLists) ([]FrameVariable, error) {
+	type scope struct {
+		inScope  bool
+		function string
+		depth    int
+	}
+	scopes := []scope{{inScope: true, function: entryName(d.dwarf, subprogram)}}
+	var (
+		vars     []FrameVariable
+		maxDepth int
+	)
+	for len(scopes) > 0 {
+		entry, err := d.dwarfReader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			break
+		}
+		if entry.Tag == 0 {
+			scopes = scopes[:len(scopes)-1]
+			continue
+		}
+		parent := scopes[len(scopes)-1]
+		child := scope{function: parent.function, depth: parent.depth}
+		switch entry.Tag {
+		case dwarf.TagFormalParameter, dwarf.TagVariable:
+			if parent.inScope {
+				v, err := d.frameVariable(entry, vmAddr, files, locs)
+				if err != nil {
+					return nil, err
+				}
+				v.Parameter = entry.Tag == dwarf.TagFormalParameter
+				v.Function, v.InlineDepth = parent.function, parent.depth
+				if v.Name != "" {
+					vars = append(vars, v)
+				}
+			}
+		case dwarf.TagLexDwarfBlock, dwarf.TagInlinedSubroutine:
+			if !parent.inScope {
+				break
+			}
+			ranges, err := d.dwarf.Ranges(entry)
+			if err != nil {
+				return nil, err
+			}
+			// a lexical block without the PC ranges spans its whole parent
+			child.inScope = (len(ranges) == 0 && entry.Tag == dwarf.TagLexDwarfBlock) || rangesContain(ranges, vmAddr)
+			if child.inScope && entry.Tag == dwarf.TagInlinedSubroutine {
+				child.function, child.depth = entryName(d.dwarf, entry), parent.depth+1
+				maxDepth = max(maxDepth, child.depth)
+			}
+		}
+		if entry.Children {
+			scopes = append(scopes, child)
+		}
+	}
+
+	// the depth is counted from the outermost function while walking, flip it to count from the PC's function
+	// and move the innermost function first
+	sorted := make([]FrameVariable, 0, len(vars))
+	for depth := maxDepth; depth >= 0; depth-- {
+		for _, v := range vars {
+			if v.InlineDepth == depth {
+				v.InlineDepth = maxDepth - depth
+				sorted = append(sorted, v)
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// frameVariable resolves the name, the type, the declaration and the location at vmAddr of a variable entry
+func (d *dwarfImage) frameVariable(entry *dwarf.Entry, vmAddr uint64, files []*dwarf.LineFile, locs *locationLists) (FrameVariable, error) {
+	v := FrameVariable{Name: entryName(d.dwarf, entry)}
+	if typeOff, ok := entryAttr(d.dwarf, entry, dwarf.AttrType).(dwarf.Offset); ok {
+		if t, err := d.dwarf.Type(typeOff); err == nil {
+			v.Type = dwarftype.Name(t)
+		}
+	}
+	if line, ok := entryAttr(d.dwarf, entry, dwarf.AttrDeclLine).(int64); ok {
+		v.DeclLine = int(line)
+	}
+	if file, ok := entryAttr(d.dwarf, entry, dwarf.AttrDeclFile).(int64); ok && file >= 0 && int(file) < len(files) && files[file] != nil {
+		v.DeclFile = files[file].Name
+	}
+	switch loc := entry.Val(dwarf.AttrLocation).(type) {
+	case []byte: // an expression valid in the whole scope
+		v.Location = locs.resolveAddrx(loc)
+	case int64: // DW_FORM_sec_offset of a location list
+		expr, err := locs.find(uint64(loc), false, vmAddr)
+		if err != nil {
+			return v, fmt.Errorf("invalid location list of %s: %w", v.Name, err)
+		}
+		v.Location = locs.resolveAddrx(expr)
+	case uint64: // DW_FORM_loclistx
+		expr, err := locs.find(loc, true, vmAddr)
+		if err != nil {
+			return v, fmt.Errorf("invalid location list of %s: %w", v.Name, err)
+		}
+		v.Location = locs.resolveAddrx(expr)
+	}
+	return v, nil
+}
+
+// the entry kinds of the DWARF 5 location lists, DW_LLE_*
+const (
+	dwLLEEndOfList       = 0x00
+	dwLLEBaseAddressx    = 0x01
+	dwLLEStartxEndx      = 0x02
+	dwLLEStartxLength    = 0x03
+	dwLLEOffsetPair      = 0x04
+	dwLLEDefaultLocation = 0x05
+	dwLLEBaseAddress     = 0x06
+	dwLLEStartEnd        = 0x07
+	dwLLEStartLength     = 0x08
+)
+
+// locationLists reads the location lists of a CU from __debug_loc of DWARF 4 or __debug_loclists of DWARF 5
+type locationLists struct {
+	d        *dwarfImage
+	cu       *dwarf.Entry
+	version  int // the DWARF version of the CU
+	addrSize int // the address size of the CU, 4 of the 32-bit images, e.g. armv7 and i386
+}
+
+// find returns the expression of the location list at the offset, or of the index of DW_FORM_loclistx,
+// which is valid at vmAddr, nil if there's none
+func (l *locationLists) find(off uint64, index bool, vmAddr uint64) ([]byte, error) {
+	base, _ := l.cu.Val(dwarf.AttrLowpc).(uint64)
+	if index || l.version >= 5 {
+		return l.findV5(off, index, base, vmAddr)
+	}
+	return l.findV4(off, base, vmAddr)
+}
+
+// readAddress reads an address of the CU's address size
+func (l *locationLists) readAddress(r *bytesReader) (uint64, error) {
+	if l.addrSize == 4 {
+		v, err := r.Uint32(l.d.order)
+		return uint64(v), err
+	}
+	return r.Uint64(l.d.order)
+}
+
+func (l *locationLists) findV4(off, base, vmAddr uint64) ([]byte, error) {
+	data := l.d.rawSections["debug_loc"]
+	if off >= uint64(len(data)) {
+		return nil, fmt.Errorf("the offset 0x%x is out of __debug_loc", off)
+	}
+	order := l.d.order
+	// the base address selection entry starts with the largest address
+	maxAddr := ^uint64(0) >> (64 - 8*l.addrSize)
+	r := newBytesReader(data)
+	r.offset = int(off)
+	for {
+		begin, err := l.readAddress(r)
+		if err != nil {
+			return nil, err
+		}
+		end, err := l.readAddress(r)
+		if err != nil {
+			return nil, err
+		}
+		if begin == 0 && end == 0 {
+			return nil, nil
+		}
+		if begin == maxAddr {
+			base = end
+			continue
+		}
+		size, err := r.Uint16(order)
+		if err != nil {
+			return nil, err
+		}
+		expr, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+		if vmAddr >= base+begin && vmAddr < base+end {
+			return expr, nil
+		}
+	}
+}
+
+func (l *locationLists) findV5(off uint64, index bool, base, vmAddr uint64) ([]byte, error) {
+	data := l.d.rawSections["debug_loclists"]
+	order := l.d.order
+	if index {
+		listsBase, _ := l.cu.Val(dwarf.AttrLoclistsBase).(int64)
+		entryOff := uint64(listsBase) + off*4
+		if entryOff+4 > uint64(len(data)) {
+			return nil, fmt.Errorf("the index %d is out of __debug_loclists", off)
+		}
+		off = uint64(listsBase) + uint64(order.Uint32(data[entryOff:]))
+	}
+	if off >= uint64(len(data)) {
+		return nil, fmt.Errorf("the offset 0x%x is out of __debug_loclists", off)
+	}
+	r := newBytesReader(data)
+	r.offset = int(off)
+	// DW_LLE_default_location applies if none of the bounded entries of the list contains vmAddr
+	var defaultExpr []byte
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		var begin, end uint64
+		switch kind {
+		case dwLLEEndOfList:
+			return defaultExpr, nil
+		case dwLLEBaseAddressx:
+			idx, err := r.ReadULEB128()
+			if err != nil {
+				return nil, err
+			}
+			if base, err = l.address(idx); err != nil {
+				return nil, err
+			}
+			continue
+		case dwLLEBaseAddress:
+			if base, err = l.readAddress(r); err != nil {
+				return nil, err
+			}
+			continue
+		case dwLLEStartxEndx, dwLLEStartxLength:
+			idx, err := r.ReadULEB128()
+			if err != nil {
+				return nil, err
+			}
+			if begin, err = l.address(idx); err != nil {
+				return nil, err
+			}
+			if end, err = r.ReadULEB128(); err != nil {
+				return nil, err
+			}
+			if kind == dwLLEStartxEndx {
+				if end, err = l.address(end); err != nil {
+					return nil, err
+				}
+			} else {
+				end += begin
+			}
+		case dwLLEOffsetPair:
+			if begin, err = r.ReadULEB128(); err != nil {
+				return nil, err
+			}
+			if end, err = r.ReadULEB128(); err != nil {
+				return nil, err
+			}
+			begin, end = base+begin, base+end
+		case dwLLEDefaultLocation:
+		case dwLLEStartEnd, dwLLEStartLength:
+			if begin, err = l.readAddress(r); err != nil {
+				return nil, err
+			}
+			if kind == dwLLEStartEnd {
+				end, err = l.readAddress(r)
+			} else {
+				end, err = r.ReadULEB128()
+				end += begin
+			}
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("unknown location list entry kind 0x%x", kind)
+		}
+		size, err := r.ReadULEB128()
+		if err != nil {
+			return nil, err
+		}
+		expr, err := r.Bytes(int(size))
+		if err != nil {
+			return nil, err
+		}
+		if kind == dwLLEDefaultLocation {
+			defaultExpr = expr
+		} else if vmAddr >= begin && vmAddr < end {
+			return expr, nil
+		}
+	}
+}
+
+// address reads an address of __debug_addr by the index of the CU's DW_AT_addr_base
+func (l *locationLists) address(idx uint64) (uint64, error) {
+	return l.d.debugAddr(l.cu, l.addrSize, idx)
+}
+
+// resolveAddrx replaces a leading DW_OP_addrx or DW_OP_constx of the expression by DW_OP_addr or DW_OP_const4u/8u
+// of the address, so that the expression can be used without the CU. It's returned as is if the index is invalid
+func (l *locationLists) resolveAddrx(expr []byte) []byte {
+	if len(expr) == 0 || (expr[0] != dwOpAddrx && expr[0] != dwOpConstx) {
+		return expr
+	}
+	r := newBytesReader(expr[1:])
+	idx, err := r.ReadULEB128()
+	if err != nil {
+		return expr
+	}
+	addr, err := l.address(idx)
+	if err != nil {
+		Log.Debugf("unable to resolve the address index %d: %v", idx, err)
+		return expr
+	}
+	op := byte(dwOpAddr)
+	if expr[0] == dwOpConstx {
+		op = 0x0c // DW_OP_const4u
+		if l.addrSize == 8 {
+			op = 0x0e // DW_OP_const8u
+		}
+	}
+	resolved := make([]byte, 1+l.addrSize, 1+l.addrSize+r.Len())
+	resolved[0] = op
+	if l.addrSize == 4 {
+		l.d.order.PutUint32(resolved[1:], uint32(addr))
+	} else {
+		l.d.order.PutUint64(resolved[1:], addr)
+	}
+	return append(resolved, expr[1+r.Offset():]...)
+}
+
+// unitHeader returns the DWARF version and the address size of the unit containing the DIE offset, by walking
+// the unit headers of the debug info, DWARF 4 and 8 bytes addresses if unknown
+func (d *dwarfImage) unitHeader(off dwarf.Offset) (version, addrSize int) {
+	for start := uint64(0); start+6 <= uint64(len(d.debugInfo)); {
+		length, headerSize := uint64(d.order.Uint32(d.debugInfo[start:])), uint64(4)
+		offSize := uint64(4)
+		if length == 0xffffffff {
+			if start+14 > uint64(len(d.debugInfo)) {
+				break
+			}
+			length, headerSize, offSize = d.order.Uint64(d.debugInfo[start+4:]), 12, 8
+		}
+		end := start + headerSize + length
+		if uint64(off) < end {
+			h := d.debugInfo[start+headerSize : min(end, uint64(len(d.debugInfo)))]
+			if len(h) < 2 {
+				break
+			}
+			version = int(d.order.Uint16(h))
+			// DWARF 5 puts the unit type and the address size before the abbreviation offset
+			sizeOff := 2 + offSize
+			if version >= 5 {
+				sizeOff = 3
+			}
+			if uint64(len(h)) <= sizeOff || (h[sizeOff] != 4 && h[sizeOff] != 8) {
+				return version, 8
+			}
+			return version, int(h[sizeOff])
+		}
+		start = end
+	}
+	return 4, 8
+}
+
+// dwOpConstx is DW_OP_constx, the index of a constant in __debug_addr, e.g. the offset of a thread local variable
+const dwOpConstx = 0xa2
+
+// the operations of the DWARF expressions without operands, DW_OP_*
+var dwarfOpNames = map[byte]string{
+	0x06: "deref", 0x12: "dup", 0x13: "drop", 0x14: "over", 0x16: "swap", 0x17: "rot", 0x19: "abs", 0x1a: "and",
+	0x1b: "div", 0x1c: "minus", 0x1d: "mod", 0x1e: "mul", 0x1f: "neg", 0x20: "not", 0x21: "or", 0x22: "plus",
+	0x24: "shl", 0x25: "shr", 0x26: "shra", 0x27: "xor", 0x29: "eq", 0x2a: "ge", 0x2b: "gt", 0x2c: "le",
+	0x2d: "lt", 0x2e: "ne", 0x96: "nop", 0x9b: "form_tls_address", 0x9c: "call_frame_cfa", 0x9f: "stack_value",
+	0xe0: "GNU_push_tls_address",
+}
+
+// FormatLocation disassembles a DWARF location expression of a little-endian target, e.g. "DW_OP_fbreg -20"
+// or "DW_OP_reg5 rdi", the registers are named by the architecture
+func FormatLocation(expr []byte, arch Arch) string {
+	regName := func(reg uint64) string {
+		names := breakpadRegisterNames[arch.Cpu]
+		if reg < uint64(len(names)) {
+			return strings.TrimPrefix(names[reg], "$")
+		}
+		return "reg" + strconv.FormatUint(reg, 10)
+	}
+	order := binary.LittleEndian
+	r := newBytesReader(expr)
+	var ops []string
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		var (
+			s   string
+			err error
+		)
+		switch {
+		case dwarfOpNames[op] != "":
+			s = "DW_OP_" + dwarfOpNames[op]
+		case op >= 0x30 && op <= 0x4f:
+			s = fmt.Sprintf("DW_OP_lit%d", op-0x30)
+		case op >= 0x50 && op <= 0x6f:
+			s = fmt.Sprintf("DW_OP_reg%d %s", op-0x50, regName(uint64(op-0x50)))
+		case op >= 0x70 && op <= 0x8f:
+			var off int64
+			off, err = r.ReadSLEB128()
+			s = fmt.Sprintf("DW_OP_breg%d %s%+d", op-0x70, regName(uint64(op-0x70)), off)
+		case op == dwOpAddr:
+			var addr uint64
+			if arch.Cpu&cpuArch64 != 0 {
+				addr, err = r.Uint64(order)
+			} else {
+				var addr32 uint32
+				addr32, err = r.Uint32(order)
+				addr = uint64(addr32)
+			}
+			s = fmt.Sprintf("DW_OP_addr 0x%x", addr)
+		case op >= 0x08 && op <= 0x0f: // DW_OP_const1u ... DW_OP_const8s
+			size := 1 << ((op - 0x08) / 2)
+			var b []byte
+			if b, err = r.Bytes(size); err == nil {
+				v := uint64(0)
+				for i := size - 1; i >= 0; i-- {
+					v = v<<8 | uint64(b[i])
+				}
+				if op%2 == 1 { // the signed ones
+					shift := 64 - 8*size
+					s = fmt.Sprintf("DW_OP_const%ds %d", size, int64(v<<shift)>>shift)
+				} else {
+					s = fmt.Sprintf("DW_OP_const%du %d", size, v)
+				}
+			}
+		case op == 0x10 || op == 0x23 || op == 0x90 || op == 0x93: // DW_OP_constu, plus_uconst, regx, piece
+			var v uint64
+			v, err = r.ReadULEB128()
+			switch op {
+			case 0x10:
+				s = fmt.Sprintf("DW_OP_constu %d", v)
+			case 0x23:
+				s = fmt.Sprintf("DW_OP_plus_uconst 0x%x", v)
+			case 0x90:
+				s = fmt.Sprintf("DW_OP_regx %s", regName(v))
+			default:
+				s = fmt.Sprintf("DW_OP_piece 0x%x", v)
+			}
+		case op == 0x11 || op == 0x91: // DW_OP_consts, fbreg
+			var v int64
+			v, err = r.ReadSLEB128()
+			if op == 0x11 {
+				s = fmt.Sprintf("DW_OP_consts %d", v)
+			} else {
+				s = fmt.Sprintf("DW_OP_fbreg %d", v)
+			}
+		case op == 0x92: // DW_OP_bregx
+			var (
+				reg uint64
+				off int64
+			)
+			if reg, err = r.ReadULEB128(); err == nil {
+				off, err = r.ReadSLEB128()
+				s = fmt.Sprintf("DW_OP_bregx %s%+d", regName(reg), off)
+			}
+		case op == 0x15 || op == 0x94: // DW_OP_pick, deref_size
+			var v byte
+			v, err = r.ReadByte()
+			if op == 0x15 {
+				s = fmt.Sprintf("DW_OP_pick 0x%x", v)
+			} else {
+				s = fmt.Sprintf("DW_OP_deref_size 0x%x", v)
+			}
+		case op == dwOpAddrx || op == dwOpConstx: // the unresolved indexes of __debug_addr
+			var idx uint64
+			idx, err = r.ReadULEB128()
+			if op == dwOpAddrx {
+				s = fmt.Sprintf("DW_OP_addrx %d", idx)
+			} else {
+				s = fmt.Sprintf("DW_OP_constx %d", idx)
+			}
+		case op == 0x9e: // DW_OP_implicit_value
+			var size uint64
+			var b []byte
+			if size, err = r.ReadULEB128(); err == nil {
+				b, err = r.Bytes(int(size))
+				s = fmt.Sprintf("DW_OP_implicit_value 0x%x", b)
+			}
+		case op == 0xa3 || op == 0xf3: // DW_OP_entry_value, GNU_entry_value
+			var size uint64
+			var b []byte
+			if size, err = r.ReadULEB128(); err == nil {
+				if b, err = r.Bytes(int(size)); err == nil {
+					s = fmt.Sprintf("DW_OP_entry_value(%s)", FormatLocation(b, arch))
+				}
+			}
+		default:
+			// the operands of an unknown operation can't be skipped, stop here
+			return strings.Join(append(ops, fmt.Sprintf("DW_OP_0x%x", op)), ", ")
+		}
+		if err != nil {
+			return strings.Join(append(ops, "<truncated>"), ", ")
+		}
+		ops = append(ops, s)
+	}
+	return strings.Join(ops, ", ")
+}
@@ -0,0 +1,146 @@
+package atos
+
+import (
+	"debug/dwarf"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFrameVariables(t *testing.T) {
+	ef, err := OpenELF("testdata/inline.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ef.Close()
+	ef.SetLoadAddress(0x5550000000)
+
+	format := func(vars []FrameVariable) string {
+		var lines []string
+		for _, v := range vars {
+			kind := "var"
+			if v.Parameter {
+				kind = "param"
+			}
+			loc := "<optimized out>"
+			if v.Location != nil {
+				loc = FormatLocation(v.Location, ef.Arch())
+			}
+			lines = append(lines, fmt.Sprintf("%d %s %s %s %s %s:%d: %s", v.InlineDepth, v.Function, kind, v.Type, v.Name, v.DeclFile, v.DeclLine, loc))
+		}
+		return strings.Join(lines, "\n")
+	}
+
+	for pc, want := range map[uint64]string{
+		// compute after the inlined sum_squares, where s is in rbx and the parameters are their entry values
+		0x5550001160: `0 compute param int a /src/inline.c:13: DW_OP_entry_value(DW_OP_reg5 rdi), DW_OP_stack_value
+0 compute param int b /src/inline.c:13: DW_OP_entry_value(DW_OP_reg4 rsi), DW_OP_stack_value
+0 compute var int s /src/inline.c:15: DW_OP_reg3 rbx`,
+		// square inlined into sum_squares inlined into compute
+		0x5550001151: `0 square param int x /src/inline.c:3: <optimized out>
+1 sum_squares param int b /src/inline.c:8: DW_OP_reg4 rsi
+1 sum_squares param int a /src/inline.c:8: DW_OP_reg5 rdi
+2 compute param int a /src/inline.c:13: DW_OP_reg5 rdi
+2 compute param int b /src/inline.c:13: DW_OP_reg4 rsi
+2 compute var int s /src/inline.c:15: <optimized out>`,
+		0x5550001050: `0 main param int argc /src/inline.c:20: DW_OP_reg5 rdi
+0 main param char ** argv /src/inline.c:20: DW_OP_reg4 rsi`,
+	} {
+		vars, err := ef.FrameVariables(pc)
+		if err != nil {
+			t.Fatalf("FrameVariables(0x%x): %v", pc, err)
+		}
+		if got := format(vars); got != want {
+			t.Errorf("FrameVariables(0x%x):\n%s\nwant:\n%s", pc, got, want)
+		}
+	}
+}
+
+func TestFormatLocation(t *testing.T) {
+	for _, tc := range []struct {
+		expr []byte
+		arch Arch
+		want string
+	}{
+		{[]byte{0x91, 0x6c}, ArchARM64, "DW_OP_fbreg -20"},
+		{[]byte{0x8f, 0x10}, ArchARM64, "DW_OP_breg31 sp+16"},
+		{[]byte{0x50, 0x93, 0x04, 0x51, 0x93, 0x04}, ArchARM64, "DW_OP_reg0 x0, DW_OP_piece 0x4, DW_OP_reg1 x1, DW_OP_piece 0x4"},
+		{[]byte{0x03, 0x00, 0x40, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00}, ArchARM64, "DW_OP_addr 0x100004000"},
+		{[]byte{0x03, 0x00, 0x40, 0x00, 0x00, 0x9f}, ArchARMv7, "DW_OP_addr 0x4000, DW_OP_stack_value"},
+		{[]byte{0xa1, 0x02, 0x9f}, ArchARM64, "DW_OP_addrx 2, DW_OP_stack_value"},
+		{[]byte{0x09, 0xff, 0x9f}, ArchX64, "DW_OP_const1s -1, DW_OP_stack_value"},
+		{[]byte{0x03, 0x00}, ArchX64, "<truncated>"},
+	} {
+		if got := FormatLocation(tc.expr, tc.arch); got != tc.want {
+			t.Errorf("FormatLocation(%x) = %q, want %q", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestLocationLists(t *testing.T) {
+	cu := &dwarf.Entry{Field: []dwarf.Field{{Attr: dwarf.AttrLowpc, Val: uint64(0x1000)}}}
+	d := &dwarfImage{order: binary.LittleEndian, rawSections: map[string][]byte{
+		// a 32-bit list: [0x10, 0x20) of the CU base, a base address selection of 0x2000, then [0x10, 0x20) of it
+		"debug_loc": {
+			0x10, 0, 0, 0, 0x20, 0, 0, 0, 1, 0, 0x50,
+			0xff, 0xff, 0xff, 0xff, 0x00, 0x20, 0, 0,
+			0x10, 0, 0, 0, 0x20, 0, 0, 0, 1, 0, 0x51,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+		// DW_LLE_default_location before DW_LLE_start_end [0x3000, 0x3010) of 32-bit addresses
+		"debug_loclists": {
+			dwLLEDefaultLocation, 1, 0x52,
+			dwLLEStartEnd, 0x00, 0x30, 0, 0, 0x10, 0x30, 0, 0, 1, 0x53,
+			dwLLEEndOfList,
+		},
+	}}
+	for _, tc := range []struct {
+		version int
+		vmAddr  uint64
+		want    []byte
+	}{
+		{4, 0x1018, []byte{0x50}},
+		{4, 0x2018, []byte{0x51}},
+		{4, 0x3000, nil},
+		{5, 0x3008, []byte{0x53}},
+		{5, 0x4000, []byte{0x52}},
+	} {
+		l := &locationLists{d: d, cu: cu, version: tc.version, addrSize: 4}
+		got, err := l.find(0, false, tc.vmAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(tc.want) {
+			t.Errorf("DWARF %d find(0x%x) = %x, want %x", tc.version, tc.vmAddr, got, tc.want)
+		}
+	}
+}
+
+func TestResolveAddrx(t *testing.T) {
+	le := binary.LittleEndian
+	cu := &dwarf.Entry{Field: []dwarf.Field{{Attr: dwarf.AttrAddrBase, Val: int64(8), Class: dwarf.ClassAddrPtr}}}
+	addrs64 := le.AppendUint64(make([]byte, 8), 0x100004000)
+	addrs64 = le.AppendUint64(addrs64, 0x100004040)
+	addrs32 := le.AppendUint32(make([]byte, 8), 0x4000)
+	addrs32 = le.AppendUint32(addrs32, 0x4040)
+
+	for _, tc := range []struct {
+		addrs    []byte
+		addrSize int
+		arch     Arch
+		expr     []byte
+		want     string
+	}{
+		{addrs64, 8, ArchARM64, []byte{dwOpAddrx, 1}, "DW_OP_addr 0x100004040"},
+		{addrs64, 8, ArchARM64, []byte{dwOpConstx, 0, 0xe0}, "DW_OP_const8u 4294983680, DW_OP_GNU_push_tls_address"},
+		{addrs32, 4, ArchARMv7, []byte{dwOpAddrx, 1, 0x9f}, "DW_OP_addr 0x4040, DW_OP_stack_value"},
+		{addrs32, 4, ArchARMv7, []byte{dwOpAddrx, 2}, "DW_OP_addrx 2"}, // out of __debug_addr
+	} {
+		d := &dwarfImage{order: le, rawSections: map[string][]byte{"debug_addr": tc.addrs}}
+		l := &locationLists{d: d, cu: cu, version: 5, addrSize: tc.addrSize}
+		if got := FormatLocation(l.resolveAddrx(tc.expr), tc.arch); got != tc.want {
+			t.Errorf("resolveAddrx(%x) = %q, want %q", tc.expr, got, tc.want)
+		}
+	}
+}